@@ -0,0 +1,674 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/shopspring/decimal"
+	investgo "github.com/tinkoff/invest-api-go-sdk/investgo"
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+)
+
+const (
+	// alertPollInterval — период опроса цен для алертов без подписки на стрим
+	alertPollInterval = 30 * time.Second
+	// alertRSIInterval — как часто пересчитывать RSI: свечи меняются не чаще раза в минуту
+	alertRSIInterval    = 5 * time.Minute
+	alertWebhookTimeout = 10 * time.Second
+	// alertWebhookHostsEnv — переменная окружения со списком хостов, на которые разрешены webhook алертов;
+	// без неё webhook отключены, чтобы сервер нельзя было заставить слать запросы во внутреннюю сеть
+	alertWebhookHostsEnv = "TINKOFF_ALERT_WEBHOOK_HOSTS"
+)
+
+// Условия алертов
+const (
+	alertPriceAbove  = "price_above"
+	alertPriceBelow  = "price_below"
+	alertPriceCross  = "price_cross"
+	alertChangeAbove = "change_above"
+	alertChangeBelow = "change_below"
+	alertRSIAbove    = "rsi_above"
+	alertRSIBelow    = "rsi_below"
+)
+
+var alertConditions = []string{alertPriceAbove, alertPriceBelow, alertPriceCross,
+	alertChangeAbove, alertChangeBelow, alertRSIAbove, alertRSIBelow}
+
+// Alert — правило оповещения; хранится в $TINKOFF_DATA_DIR/alerts.json
+type Alert struct {
+	ID        string    `json:"id"`
+	Figi      string    `json:"figi"`
+	Uid       string    `json:"uid"`
+	Ticker    string    `json:"ticker"`
+	ClassCode string    `json:"class_code"`
+	Name      string    `json:"name"`
+	Condition string    `json:"condition"`
+	Value     string    `json:"value"`
+	Interval  string    `json:"interval,omitempty"` // интервал свечей для RSI
+	Period    int       `json:"period,omitempty"`   // период RSI
+	Repeat    bool      `json:"repeat"`
+	Webhook   string    `json:"webhook,omitempty"`
+	Active    bool      `json:"active"`
+	Created   time.Time `json:"created"`
+
+	// состояние проверки: срабатывание происходит по фронту, когда условие начинает выполняться;
+	// первая проверка после создания или запуска сервера только фиксирует исходное состояние
+	// (состояние сохраняется лишь при срабатываниях и после перезапуска могло устареть)
+	LastCheck time.Time `json:"last_check,omitempty"`
+	Observed  string    `json:"observed,omitempty"`
+	// ObservedAt — время данных (котировки или расчёта RSI), из которых получено Observed;
+	// более старые значения отбрасываются, чтобы опрос не перебивал свежую цену из стрима
+	ObservedAt time.Time `json:"observed_at,omitempty"`
+	Met        bool      `json:"met"`
+	Side       int       `json:"side,omitempty"` // для price_cross: -1 ниже уровня, 1 не ниже
+
+	TriggeredAt    *time.Time `json:"triggered_at,omitempty"`
+	TriggeredValue string     `json:"triggered_value,omitempty"`
+	Triggers       int        `json:"triggers"`
+
+	primed bool // состояние зафиксировано в этом процессе
+}
+
+func (a *Alert) ref() *InstrumentRef {
+	return &InstrumentRef{Figi: a.Figi, Uid: a.Uid, Ticker: a.Ticker, ClassCode: a.ClassCode, Name: a.Name}
+}
+
+func (a *Alert) isPrice() bool {
+	return a.Condition == alertPriceAbove || a.Condition == alertPriceBelow || a.Condition == alertPriceCross
+}
+
+func (a *Alert) isChange() bool {
+	return a.Condition == alertChangeAbove || a.Condition == alertChangeBelow
+}
+
+func (a *Alert) isRSI() bool {
+	return a.Condition == alertRSIAbove || a.Condition == alertRSIBelow
+}
+
+// describe — условие человеческим языком, напр. «цена выше 300»
+func (a *Alert) describe() string {
+	switch a.Condition {
+	case alertPriceAbove:
+		return "цена не ниже " + a.Value
+	case alertPriceBelow:
+		return "цена не выше " + a.Value
+	case alertPriceCross:
+		return "цена пересекает " + a.Value
+	case alertChangeAbove:
+		return fmt.Sprintf("изменение за день не меньше %s%%", a.Value)
+	case alertChangeBelow:
+		return fmt.Sprintf("изменение за день не больше %s%%", a.Value)
+	case alertRSIAbove:
+		return fmt.Sprintf("RSI(%d, %s) не ниже %s", a.Period, a.Interval, a.Value)
+	case alertRSIBelow:
+		return fmt.Sprintf("RSI(%d, %s) не выше %s", a.Period, a.Interval, a.Value)
+	}
+	return a.Condition
+}
+
+// evaluate применяет значение v, наблюдённое в момент at; возвращает true, если алерт сработал.
+// Значение старше уже применённого игнорируется
+func (a *Alert) evaluate(v decimal.Decimal, at, now time.Time) bool {
+	threshold, err := decimal.NewFromString(a.Value)
+	if err != nil || at.Before(a.ObservedAt) {
+		return false
+	}
+	first := !a.primed
+	a.primed = true
+	a.LastCheck, a.ObservedAt = now, at
+	a.Observed = v.String()
+	var fire bool
+	switch a.Condition {
+	case alertPriceCross:
+		side := 1
+		if v.LessThan(threshold) {
+			side = -1
+		}
+		fire = side != a.Side && !first
+		a.Side = side
+	case alertPriceAbove, alertChangeAbove, alertRSIAbove:
+		met := v.GreaterThanOrEqual(threshold)
+		fire = met && !a.Met && !first
+		a.Met = met
+	case alertPriceBelow, alertChangeBelow, alertRSIBelow:
+		met := v.LessThanOrEqual(threshold)
+		fire = met && !a.Met && !first
+		a.Met = met
+	}
+	if fire {
+		a.TriggeredAt = &now
+		a.TriggeredValue = a.Observed
+		a.Triggers++
+		if !a.Repeat {
+			a.Active = false
+		}
+	}
+	return fire
+}
+
+// alertEvent — сообщение о срабатывании, уходит в MCP-лог и на webhook
+type alertEvent struct {
+	ID        string    `json:"id"`
+	Figi      string    `json:"figi"`
+	Ticker    string    `json:"ticker"`
+	Name      string    `json:"name"`
+	Condition string    `json:"condition"`
+	Value     string    `json:"value"`
+	Observed  string    `json:"observed"`
+	Time      time.Time `json:"time"`
+	Message   string    `json:"message"`
+	webhook   string
+}
+
+func newAlertEvent(a *Alert) alertEvent {
+	return alertEvent{
+		ID: a.ID, Figi: a.Figi, Ticker: a.Ticker, Name: a.Name,
+		Condition: a.Condition, Value: a.Value, Observed: a.TriggeredValue, Time: a.TriggeredAt.UTC(),
+		Message: fmt.Sprintf("Алерт %s: %s (%s) — %s, значение %s", a.ID, a.Name, a.Ticker, a.describe(), a.TriggeredValue),
+		webhook: a.Webhook,
+	}
+}
+
+// alertEngine проверяет алерты по данным стрима (если на инструмент оформлена подписка)
+// и периодическим опросом последних цен и свечей
+type alertEngine struct {
+	// pollMu не даёт опросам (по таймеру и внеочередному из Create) идти параллельно
+	pollMu sync.Mutex
+	mu     sync.Mutex
+	ic     *InvestClient
+	srv    *server.MCPServer
+	alerts []*Alert
+	closes map[string]*pb.Quotation // UID → цена закрытия для change_* по данным стрима
+	client *http.Client
+	// webhookHosts — хосты из TINKOFF_ALERT_WEBHOOK_HOSTS; пусто — webhook отключены
+	webhookHosts map[string]bool
+}
+
+func alertsPath(ic *InvestClient) string {
+	return filepath.Join(ic.dataDir, "alerts.json")
+}
+
+func newAlertEngine(ic *InvestClient, srv *server.MCPServer, ms *marketStreamer) (*alertEngine, error) {
+	e := &alertEngine{
+		ic:           ic,
+		srv:          srv,
+		closes:       make(map[string]*pb.Quotation),
+		webhookHosts: make(map[string]bool),
+	}
+	for _, h := range strings.Split(os.Getenv(alertWebhookHostsEnv), ",") {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			e.webhookHosts[h] = true
+		}
+	}
+	e.client = &http.Client{
+		Timeout: alertWebhookTimeout,
+		// перенаправление не должно уводить запрос за пределы разрешённых хостов
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if err := e.checkWebhook(req.URL.String()); err != nil {
+				return err
+			}
+			if len(via) >= 5 {
+				return fmt.Errorf("слишком много перенаправлений")
+			}
+			return nil
+		},
+	}
+	if err := readJSONFile(alertsPath(ic), &e.alerts); err != nil {
+		return nil, err
+	}
+	ms.AddListener(e.onMarket)
+	go e.pollLoop()
+	return e, nil
+}
+
+// saveLocked сохраняет алерты; вызывается под e.mu
+func (e *alertEngine) saveLocked() error {
+	if e.alerts == nil {
+		e.alerts = []*Alert{}
+	}
+	return writeJSONFile(alertsPath(e.ic), e.alerts)
+}
+
+func (e *alertEngine) pollLoop() {
+	ticker := time.NewTicker(alertPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		e.poll()
+	}
+}
+
+// observation — значение для алерта и время данных, из которых оно получено
+type observation struct {
+	Value decimal.Decimal
+	At    time.Time
+}
+
+// poll проверяет все активные алерты: цены — одним пакетным запросом, RSI — не чаще alertRSIInterval
+func (e *alertEngine) poll() {
+	e.pollMu.Lock()
+	defer e.pollMu.Unlock()
+	now := time.Now()
+	e.mu.Lock()
+	var refs []*InstrumentRef
+	seen := make(map[string]bool)
+	var rsi []Alert
+	for _, a := range e.alerts {
+		if !a.Active {
+			continue
+		}
+		if a.isRSI() {
+			if now.Sub(a.LastCheck) >= alertRSIInterval {
+				rsi = append(rsi, *a)
+			}
+			continue
+		}
+		if !seen[a.Uid] {
+			seen[a.Uid] = true
+			refs = append(refs, a.ref())
+		}
+	}
+	e.mu.Unlock()
+
+	values := make(map[string]observation) // ID алерта → наблюдённое значение
+	if len(refs) > 0 {
+		rows, closeErr, err := loadQuotes(e.ic, refs)
+		if err != nil {
+			log.Printf("Алерты: %v", err)
+		}
+		if closeErr != nil {
+			log.Printf("Алерты: %v", closeErr)
+		}
+		quotes := make(map[string]QuoteRow, len(rows))
+		for _, r := range rows {
+			quotes[r.Ref.Uid] = r
+		}
+		e.mu.Lock()
+		for uid, r := range quotes {
+			if r.HasClose() {
+				e.closes[uid] = r.ClosePrice
+			}
+		}
+		for _, a := range e.alerts {
+			r, ok := quotes[a.Uid]
+			if !a.Active || !ok || !r.HasLast() {
+				continue
+			}
+			if v, ok := e.observe(a, r.LastPrice); ok {
+				values[a.ID] = observation{Value: v, At: r.LastTime}
+			}
+		}
+		e.mu.Unlock()
+	}
+	for _, a := range rsi {
+		v, err := alertRSI(context.Background(), e.ic, &a)
+		if err != nil {
+			log.Printf("Алерт %s: %v", a.ID, err)
+			continue
+		}
+		values[a.ID] = observation{Value: v, At: time.Now()}
+	}
+	if len(values) == 0 {
+		return
+	}
+
+	e.mu.Lock()
+	var events []alertEvent
+	for _, a := range e.alerts {
+		if v, ok := values[a.ID]; ok && a.Active && a.evaluate(v.Value, v.At, now) {
+			events = append(events, newAlertEvent(a))
+		}
+	}
+	if len(events) > 0 {
+		if err := e.saveLocked(); err != nil {
+			log.Printf("Алерты: ошибка сохранения: %v", err)
+		}
+	}
+	e.mu.Unlock()
+	e.deliver(events)
+}
+
+// observe — значение для ценового алерта: сама цена или изменение к закрытию в процентах;
+// вызывается под e.mu
+func (e *alertEngine) observe(a *Alert, price *pb.Quotation) (decimal.Decimal, bool) {
+	last := quotationDecimal(price)
+	if a.isPrice() {
+		return last, true
+	}
+	if !a.isChange() {
+		return decimal.Decimal{}, false
+	}
+	cp, ok := e.closes[a.Uid]
+	if !ok {
+		return decimal.Decimal{}, false
+	}
+	c := quotationDecimal(cp)
+	return last.Sub(c).Mul(decimal.NewFromInt(100)).DivRound(c, 4), true
+}
+
+// onMarket проверяет ценовые алерты на каждой последней цене из стрима
+func (e *alertEngine) onMarket(st MarketState) {
+	if st.LastPrice == nil {
+		return
+	}
+	now := time.Now()
+	at := now
+	if t := st.LastPrice.GetTime(); t != nil {
+		at = t.AsTime()
+	}
+	e.mu.Lock()
+	var events []alertEvent
+	for _, a := range e.alerts {
+		if !a.Active || a.Uid != st.Ref.Uid {
+			continue
+		}
+		if v, ok := e.observe(a, st.LastPrice.GetPrice()); ok && a.evaluate(v, at, now) {
+			events = append(events, newAlertEvent(a))
+		}
+	}
+	if len(events) > 0 {
+		if err := e.saveLocked(); err != nil {
+			log.Printf("Алерты: ошибка сохранения: %v", err)
+		}
+	}
+	e.mu.Unlock()
+	e.deliver(events)
+}
+
+// deliver отправляет срабатывания MCP-клиентам как notifications/message и на webhook
+func (e *alertEngine) deliver(events []alertEvent) {
+	for _, ev := range events {
+		log.Print(ev.Message)
+		e.srv.SendNotificationToAllClients("notifications/message", map[string]any{
+			"level":  mcp.LoggingLevelWarning,
+			"logger": "alerts",
+			"data":   ev,
+		})
+		if ev.webhook != "" {
+			go e.postWebhook(ev)
+		}
+	}
+}
+
+// checkWebhook проверяет, что webhook — http(s) URL на хост из TINKOFF_ALERT_WEBHOOK_HOSTS
+// (совпадение по имени хоста или по host:port)
+func (e *alertEngine) checkWebhook(raw string) error {
+	if len(e.webhookHosts) == 0 {
+		return fmt.Errorf("webhook отключены: разрешённые хосты задаются переменной окружения %s", alertWebhookHostsEnv)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook должен быть http(s) URL")
+	}
+	if !e.webhookHosts[strings.ToLower(u.Hostname())] && !e.webhookHosts[strings.ToLower(u.Host)] {
+		return fmt.Errorf("хост %s не входит в %s", u.Host, alertWebhookHostsEnv)
+	}
+	return nil
+}
+
+func (e *alertEngine) postWebhook(ev alertEvent) {
+	// список хостов мог измениться после создания алерта
+	if err := e.checkWebhook(ev.webhook); err != nil {
+		log.Printf("Алерт %s: webhook не отправлен: %v", ev.ID, err)
+		return
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	resp, err := e.client.Post(ev.webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Алерт %s: ошибка webhook: %v", ev.ID, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Алерт %s: webhook ответил %s", ev.ID, resp.Status)
+	}
+}
+
+// alertRSI — последнее значение RSI по свечам интервала алерта (включая формирующуюся свечу)
+func alertRSI(ctx context.Context, ic *InvestClient, a *Alert) (decimal.Decimal, error) {
+	spec, err := parseCandleSpec(a.Interval)
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+	is := indicatorSpec{Kind: "rsi", Params: []int{a.Period}}
+	candles, err := loadLookback(ctx, ic, a.ref(), spec, is.warmup()+1, time.Now().UTC(), func(int, int, string) {})
+	if err != nil {
+		return decimal.Decimal{}, fmt.Errorf("ошибка получения свечей: %w", err)
+	}
+	if len(candles) == 0 {
+		return decimal.Decimal{}, fmt.Errorf("нет свечей для расчёта RSI")
+	}
+	values := is.compute(candles, false)[0].Values
+	last := values[len(values)-1]
+	if !last.Valid {
+		return decimal.Decimal{}, fmt.Errorf("недостаточно свечей для RSI(%d)", a.Period)
+	}
+	return last.Decimal.Round(2), nil
+}
+
+// Create добавляет алерт и сразу запускает внеочередную проверку
+func (e *alertEngine) Create(a *Alert) error {
+	e.mu.Lock()
+	e.alerts = append(e.alerts, a)
+	err := e.saveLocked()
+	e.mu.Unlock()
+	if err == nil {
+		go e.poll()
+	}
+	return err
+}
+
+// Delete удаляет алерты по ID (все — при all); возвращает ID, которые не нашлись
+func (e *alertEngine) Delete(ids []string, all bool) (int, []string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	want := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		want[id] = true
+	}
+	kept := e.alerts[:0]
+	deleted := 0
+	for _, a := range e.alerts {
+		if all || want[a.ID] {
+			delete(want, a.ID)
+			deleted++
+			continue
+		}
+		kept = append(kept, a)
+	}
+	e.alerts = kept
+	var missing []string
+	for id := range want {
+		missing = append(missing, id)
+	}
+	sort.Strings(missing)
+	if deleted == 0 {
+		return 0, missing, nil
+	}
+	return deleted, missing, e.saveLocked()
+}
+
+// List — копии алертов: сначала активные, затем по времени создания
+func (e *alertEngine) List() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make([]Alert, 0, len(e.alerts))
+	for _, a := range e.alerts {
+		out = append(out, *a)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Active != out[j].Active {
+			return out[i].Active
+		}
+		return out[i].Created.Before(out[j].Created)
+	})
+	return out
+}
+
+// AlertJSON — алерт в структурированном выводе
+type AlertJSON struct {
+	ID             string         `json:"id"`
+	Instrument     InstrumentJSON `json:"instrument"`
+	Condition      string         `json:"condition"`
+	Value          string         `json:"value"`
+	Interval       string         `json:"interval,omitempty"`
+	Period         int            `json:"period,omitempty"`
+	Repeat         bool           `json:"repeat"`
+	Webhook        string         `json:"webhook,omitempty"`
+	Active         bool           `json:"active"`
+	Created        string         `json:"created"`
+	LastCheck      string         `json:"last_check,omitempty"`
+	Observed       string         `json:"observed,omitempty"`
+	Triggers       int            `json:"triggers"`
+	TriggeredAt    string         `json:"triggered_at,omitempty"`
+	TriggeredValue string         `json:"triggered_value,omitempty"`
+}
+
+// AlertsOutput — структурированный результат alert_create и alert_list
+type AlertsOutput struct {
+	Alerts []AlertJSON `json:"alerts"`
+}
+
+// AlertDeleteOutput — структурированный результат alert_delete
+type AlertDeleteOutput struct {
+	Deleted  int      `json:"deleted"`
+	NotFound []string `json:"not_found,omitempty"`
+}
+
+func (a *Alert) JSON() AlertJSON {
+	out := AlertJSON{
+		ID: a.ID, Instrument: a.ref().JSON(), Condition: a.Condition, Value: a.Value,
+		Interval: a.Interval, Period: a.Period, Repeat: a.Repeat, Webhook: a.Webhook, Active: a.Active,
+		Created: timeJSON(a.Created), LastCheck: timeJSON(a.LastCheck), Observed: a.Observed,
+		Triggers: a.Triggers, TriggeredValue: a.TriggeredValue,
+	}
+	if a.TriggeredAt != nil {
+		out.TriggeredAt = timeJSON(*a.TriggeredAt)
+	}
+	return out
+}
+
+func formatAlert(a Alert) string {
+	status := "активен"
+	if !a.Active {
+		status = "отключён"
+	}
+	line := fmt.Sprintf("%s: %s (%s) — %s [%s", a.ID, a.Name, a.Ticker, a.describe(), status)
+	if a.Repeat {
+		line += ", повторяющийся"
+	}
+	line += "]"
+	if a.Observed != "" {
+		line += fmt.Sprintf(", последнее значение %s (%s)", a.Observed, a.LastCheck.UTC().Format(time.RFC3339))
+	}
+	if a.TriggeredAt != nil {
+		line += fmt.Sprintf(", сработал %d раз, последний %s при %s",
+			a.Triggers, a.TriggeredAt.UTC().Format(time.RFC3339), a.TriggeredValue)
+	}
+	if a.Webhook != "" {
+		line += ", webhook " + a.Webhook
+	}
+	return line
+}
+
+func alertCreateHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient, ae *alertEngine) (*mcp.CallToolResult, error) {
+	q, _ := req.RequireString("query")
+	cond := strings.ToLower(strings.TrimSpace(req.GetString("condition", "")))
+	known := false
+	for _, c := range alertConditions {
+		known = known || c == cond
+	}
+	if !known {
+		return mcp.NewToolResultError(fmt.Sprintf("Неизвестное условие %q. Допустимо: %s", cond, strings.Join(alertConditions, ","))), nil
+	}
+	value, err := req.RequireFloat("value")
+	if err != nil {
+		return mcp.NewToolResultError("Не указано пороговое значение (value)"), nil
+	}
+	a := &Alert{
+		ID:        investgo.CreateUid()[:8],
+		Condition: cond,
+		Value:     decimal.NewFromFloat(value).String(),
+		Repeat:    req.GetBool("repeat", false),
+		Webhook:   strings.TrimSpace(req.GetString("webhook", "")),
+		Active:    true,
+		Created:   time.Now().UTC(),
+	}
+	if a.isPrice() && value <= 0 {
+		return mcp.NewToolResultError("Цена в value должна быть положительной"), nil
+	}
+	if a.isRSI() {
+		if value < 0 || value > 100 {
+			return mcp.NewToolResultError("Уровень RSI должен быть в диапазоне 0-100"), nil
+		}
+		a.Interval = strings.ToLower(strings.TrimSpace(req.GetString("interval", "1h")))
+		if _, err := parseCandleSpec(a.Interval); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		a.Period = req.GetInt("period", 14)
+		if a.Period < 2 || a.Period > 100 {
+			return mcp.NewToolResultError("period должен быть в диапазоне 2-100"), nil
+		}
+	}
+	if a.Webhook != "" {
+		if err := ae.checkWebhook(a.Webhook); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	}
+	inst, err := findInstrumentRef(ic, q)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	a.Figi, a.Uid, a.Ticker, a.ClassCode, a.Name = inst.Figi, inst.Uid, inst.Ticker, inst.ClassCode, inst.Name
+	if err := ae.Create(a); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка сохранения алерта: %v", err)), nil
+	}
+	result := AlertsOutput{Alerts: []AlertJSON{a.JSON()}}
+	return mcp.NewToolResultStructured(result, "Алерт создан: "+formatAlert(*a)), nil
+}
+
+func alertListHandler(ctx context.Context, req mcp.CallToolRequest, ae *alertEngine) (*mcp.CallToolResult, error) {
+	alerts := ae.List()
+	result := AlertsOutput{Alerts: make([]AlertJSON, 0, len(alerts))}
+	if len(alerts) == 0 {
+		return mcp.NewToolResultStructured(result, "Алертов нет"), nil
+	}
+	lines := make([]string, 0, len(alerts))
+	for _, a := range alerts {
+		lines = append(lines, formatAlert(a))
+		result.Alerts = append(result.Alerts, a.JSON())
+	}
+	return mcp.NewToolResultStructured(result, "Алерты:\n"+formatList(lines)), nil
+}
+
+func alertDeleteHandler(ctx context.Context, req mcp.CallToolRequest, ae *alertEngine) (*mcp.CallToolResult, error) {
+	all := req.GetBool("all", false)
+	ids := stringListArg(req, "id")
+	if !all && len(ids) == 0 {
+		return mcp.NewToolResultError("Укажите id алерта или all=true"), nil
+	}
+	deleted, missing, err := ae.Delete(ids, all)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка сохранения алертов: %v", err)), nil
+	}
+	text := fmt.Sprintf("Удалено алертов: %d", deleted)
+	if len(missing) > 0 {
+		text += "\nНе найдены: " + strings.Join(missing, ", ")
+	}
+	return mcp.NewToolResultStructured(AlertDeleteOutput{Deleted: deleted, NotFound: missing}, text), nil
+}
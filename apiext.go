@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"sync"
+	"time"
+
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Методы InvestAPI, которых нет в SDK v1.4.6: GetAssetFundamentals (InstrumentsService) и GetTechAnalysis
+// (MarketDataService). Сообщения описаны по публичным proto-файлам API (instruments.proto, marketdata.proto)
+// и собираются в дескрипторы при первом вызове; запросы идут через отдельное gRPC-соединение с тем же
+// токеном, endpoint и x-app-name, что и у клиента SDK. После обновления SDK их стоит заменить методами клиента.
+const (
+	apiExtPackage              = "tinkoff.public.invest.api.contract.v1"
+	methodGetAssetFundamentals = "/" + apiExtPackage + ".InstrumentsService/GetAssetFundamentals"
+	methodGetTechAnalysis      = "/" + apiExtPackage + ".MarketDataService/GetTechAnalysis"
+)
+
+// apiExtProto — описание сообщений в текстовом формате FileDescriptorProto; поля, которые сервер
+// не использует в этой программе, опущены (при разборе ответа они попадают в неизвестные поля)
+const apiExtProto = `
+name: "tinvest_ext.proto"
+package: "tinkoff.public.invest.api.contract.v1"
+dependency: "common.proto"
+dependency: "google/protobuf/timestamp.proto"
+syntax: "proto3"
+
+message_type {
+  name: "GetAssetFundamentalsRequest"
+  field { name: "assets" number: 1 label: LABEL_REPEATED type: TYPE_STRING }
+}
+message_type {
+  name: "GetAssetFundamentalsResponse"
+  field { name: "fundamentals" number: 1 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".tinkoff.public.invest.api.contract.v1.GetAssetFundamentalsResponse.StatisticResponse" }
+  nested_type {
+    name: "StatisticResponse"
+    field { name: "asset_uid" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+    field { name: "currency" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING }
+    field { name: "market_capitalization" number: 3 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "high_price_last_52_weeks" number: 4 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "low_price_last_52_weeks" number: 5 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "average_daily_volume_last_10_days" number: 6 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "beta" number: 8 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "free_float" number: 9 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "forward_annual_dividend_yield" number: 10 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "shares_outstanding" number: 11 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "revenue_ttm" number: 12 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "ebitda_ttm" number: 13 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "net_income_ttm" number: 14 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "eps_ttm" number: 15 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "free_cash_flow_ttm" number: 17 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "pe_ratio_ttm" number: 20 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "price_to_sales_ttm" number: 21 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "price_to_book_ttm" number: 22 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "total_enterprise_value_mrq" number: 24 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "ev_to_ebitda_mrq" number: 25 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "net_margin_mrq" number: 26 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "roe" number: 28 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "roa" number: 29 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "roic" number: 30 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "total_debt_mrq" number: 31 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "total_debt_to_equity_mrq" number: 32 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "net_debt_to_ebitda" number: 35 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+    field { name: "dividend_yield_daily_ttm" number: 38 label: LABEL_OPTIONAL type: TYPE_DOUBLE }
+  }
+}
+
+message_type {
+  name: "GetTechAnalysisRequest"
+  field { name: "indicator_type" number: 1 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".tinkoff.public.invest.api.contract.v1.GetTechAnalysisRequest.IndicatorType" }
+  field { name: "instrument_uid" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING }
+  field { name: "from" number: 3 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.Timestamp" }
+  field { name: "to" number: 4 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.Timestamp" }
+  field { name: "interval" number: 5 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".tinkoff.public.invest.api.contract.v1.GetTechAnalysisRequest.IndicatorInterval" }
+  field { name: "type_of_price" number: 6 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".tinkoff.public.invest.api.contract.v1.GetTechAnalysisRequest.TypeOfPrice" }
+  field { name: "length" number: 7 label: LABEL_OPTIONAL type: TYPE_INT32 }
+  field { name: "deviation" number: 8 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".tinkoff.public.invest.api.contract.v1.GetTechAnalysisRequest.Deviation" }
+  field { name: "smoothing" number: 9 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".tinkoff.public.invest.api.contract.v1.GetTechAnalysisRequest.Smoothing" }
+  nested_type {
+    name: "Smoothing"
+    field { name: "fast_length" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 }
+    field { name: "slow_length" number: 2 label: LABEL_OPTIONAL type: TYPE_INT32 }
+    field { name: "signal_smoothing" number: 3 label: LABEL_OPTIONAL type: TYPE_INT32 }
+  }
+  nested_type {
+    name: "Deviation"
+    field { name: "deviation_multiplier" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".tinkoff.public.invest.api.contract.v1.Quotation" }
+  }
+  enum_type {
+    name: "IndicatorInterval"
+    value { name: "INDICATOR_INTERVAL_UNSPECIFIED" number: 0 }
+    value { name: "INDICATOR_INTERVAL_ONE_MINUTE" number: 1 }
+    value { name: "INDICATOR_INTERVAL_FIVE_MINUTES" number: 2 }
+    value { name: "INDICATOR_INTERVAL_FIFTEEN_MINUTES" number: 3 }
+    value { name: "INDICATOR_INTERVAL_ONE_HOUR" number: 4 }
+    value { name: "INDICATOR_INTERVAL_ONE_DAY" number: 5 }
+    value { name: "INDICATOR_INTERVAL_2_MIN" number: 6 }
+    value { name: "INDICATOR_INTERVAL_3_MIN" number: 7 }
+    value { name: "INDICATOR_INTERVAL_10_MIN" number: 8 }
+    value { name: "INDICATOR_INTERVAL_30_MIN" number: 9 }
+    value { name: "INDICATOR_INTERVAL_2_HOUR" number: 10 }
+    value { name: "INDICATOR_INTERVAL_4_HOUR" number: 11 }
+    value { name: "INDICATOR_INTERVAL_WEEK" number: 12 }
+    value { name: "INDICATOR_INTERVAL_MONTH" number: 13 }
+  }
+  enum_type {
+    name: "TypeOfPrice"
+    value { name: "TYPE_OF_PRICE_UNSPECIFIED" number: 0 }
+    value { name: "TYPE_OF_PRICE_CLOSE" number: 1 }
+    value { name: "TYPE_OF_PRICE_OPEN" number: 2 }
+    value { name: "TYPE_OF_PRICE_HIGH" number: 3 }
+    value { name: "TYPE_OF_PRICE_LOW" number: 4 }
+    value { name: "TYPE_OF_PRICE_AVG" number: 5 }
+  }
+  enum_type {
+    name: "IndicatorType"
+    value { name: "INDICATOR_TYPE_UNSPECIFIED" number: 0 }
+    value { name: "INDICATOR_TYPE_BB" number: 1 }
+    value { name: "INDICATOR_TYPE_EMA" number: 2 }
+    value { name: "INDICATOR_TYPE_RSI" number: 3 }
+    value { name: "INDICATOR_TYPE_MACD" number: 4 }
+    value { name: "INDICATOR_TYPE_SMA" number: 5 }
+  }
+}
+message_type {
+  name: "GetTechAnalysisResponse"
+  field { name: "technical_indicators" number: 1 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".tinkoff.public.invest.api.contract.v1.GetTechAnalysisResponse.TechAnalysisItem" }
+  nested_type {
+    name: "TechAnalysisItem"
+    field { name: "timestamp" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.Timestamp" }
+    field { name: "middle_band" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".tinkoff.public.invest.api.contract.v1.Quotation" }
+    field { name: "upper_band" number: 3 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".tinkoff.public.invest.api.contract.v1.Quotation" }
+    field { name: "lower_band" number: 4 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".tinkoff.public.invest.api.contract.v1.Quotation" }
+    field { name: "signal" number: 5 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".tinkoff.public.invest.api.contract.v1.Quotation" }
+    field { name: "macd" number: 6 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".tinkoff.public.invest.api.contract.v1.Quotation" }
+  }
+}
+`
+
+var apiExtFile = sync.OnceValues(func() (protoreflect.FileDescriptor, error) {
+	var fd descriptorpb.FileDescriptorProto
+	if err := prototext.Unmarshal([]byte(apiExtProto), &fd); err != nil {
+		return nil, err
+	}
+	return protodesc.NewFile(&fd, protoregistry.GlobalFiles)
+})
+
+// apiExtMessage создаёт пустое сообщение по имени из apiExtProto, напр. "GetTechAnalysisRequest"
+func apiExtMessage(name string) (*dynamicpb.Message, error) {
+	fd, err := apiExtFile()
+	if err != nil {
+		return nil, fmt.Errorf("описание методов API: %w", err)
+	}
+	md := fd.Messages().ByName(protoreflect.Name(name))
+	if md == nil {
+		return nil, fmt.Errorf("описание методов API: нет сообщения %s", name)
+	}
+	return dynamicpb.NewMessage(md), nil
+}
+
+// bearerToken — токен InvestAPI для каждого запроса отдельного соединения
+type bearerToken string
+
+func (t bearerToken) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (bearerToken) RequireTransportSecurity() bool { return true }
+
+// apiExtConn — соединение для методов, которых нет в SDK; открывается при первом вызове
+type apiExtConn struct {
+	once     sync.Once
+	conn     *grpc.ClientConn
+	err      error
+	endpoint string
+	token    string
+	appName  string
+}
+
+// invoke выполняет унарный вызов method; заголовки ответа нужны для учёта лимита запросов
+func (c *apiExtConn) invoke(ctx context.Context, method string, req, resp *dynamicpb.Message) (metadata.MD, error) {
+	c.once.Do(func() {
+		c.conn, c.err = grpc.Dial(c.endpoint,
+			grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})),
+			grpc.WithPerRPCCredentials(bearerToken(c.token)))
+	})
+	if c.err != nil {
+		return nil, c.err
+	}
+	var header metadata.MD
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-app-name", c.appName)
+	err := c.conn.Invoke(ctx, method, req, resp, grpc.Header(&header))
+	return header, err
+}
+
+func (c *apiExtConn) Close() {
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+}
+
+// dynField — значение поля динамического сообщения по имени
+func dynField(m protoreflect.Message, name string) protoreflect.Value {
+	return m.Get(m.Descriptor().Fields().ByName(protoreflect.Name(name)))
+}
+
+// dynQuotation — поле типа Quotation; nil, если поле не задано
+func dynQuotation(m protoreflect.Message, name string) *pb.Quotation {
+	fd := m.Descriptor().Fields().ByName(protoreflect.Name(name))
+	if !m.Has(fd) {
+		return nil
+	}
+	q := m.Get(fd).Message()
+	return &pb.Quotation{Units: dynField(q, "units").Int(), Nano: int32(dynField(q, "nano").Int())}
+}
+
+// setDynQuotation заполняет поле типа Quotation
+func setDynQuotation(m protoreflect.Message, name string, q *pb.Quotation) {
+	fd := m.Descriptor().Fields().ByName(protoreflect.Name(name))
+	v := m.NewField(fd).Message()
+	v.Set(v.Descriptor().Fields().ByName("units"), protoreflect.ValueOfInt64(q.GetUnits()))
+	v.Set(v.Descriptor().Fields().ByName("nano"), protoreflect.ValueOfInt32(q.GetNano()))
+	m.Set(fd, protoreflect.ValueOfMessage(v))
+}
+
+// dynTime — поле типа google.protobuf.Timestamp
+func dynTime(m protoreflect.Message, name string) time.Time {
+	ts := dynField(m, name).Message()
+	return time.Unix(dynField(ts, "seconds").Int(), dynField(ts, "nanos").Int()).UTC()
+}
+
+// setDynTime заполняет поле типа google.protobuf.Timestamp
+func setDynTime(m protoreflect.Message, name string, t time.Time) {
+	fd := m.Descriptor().Fields().ByName(protoreflect.Name(name))
+	v := m.NewField(fd).Message()
+	v.Set(v.Descriptor().Fields().ByName("seconds"), protoreflect.ValueOfInt64(t.Unix()))
+	v.Set(v.Descriptor().Fields().ByName("nanos"), protoreflect.ValueOfInt32(int32(t.Nanosecond())))
+	m.Set(fd, protoreflect.ValueOfMessage(v))
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+)
+
+// assetListTTL — как долго список активов (GetAssets) считается актуальным
+const assetListTTL = time.Hour
+
+// assetListCache хранит полный список активов в памяти процесса: в API нет поиска активов,
+// а связь инструмент → актив есть только в этом списке
+type assetListCache struct {
+	mu     sync.Mutex
+	loaded time.Time
+	assets []*pb.Asset
+}
+
+func (c *assetListCache) list(ic *InvestClient) ([]*pb.Asset, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.assets != nil && time.Since(c.loaded) < assetListTTL {
+		return c.assets, nil
+	}
+	resp, err := ic.sdk.NewInstrumentsServiceClient().GetAssets()
+	if err != nil {
+		return nil, err
+	}
+	c.assets = resp.GetAssets()
+	c.loaded = time.Now()
+	return c.assets, nil
+}
+
+// assetByInstrument находит актив, к которому относится инструмент с данным UID
+func assetByInstrument(assets []*pb.Asset, instrumentUid string) *pb.Asset {
+	for _, a := range assets {
+		for _, it := range a.GetInstruments() {
+			if it.GetUid() == instrumentUid {
+				return a
+			}
+		}
+	}
+	return nil
+}
+
+// matchAsset — совпадение по названию актива или тикеру/FIGI любого его инструмента
+func matchAsset(a *pb.Asset, q string) bool {
+	q = strings.ToLower(q)
+	if strings.Contains(strings.ToLower(a.GetName()), q) {
+		return true
+	}
+	for _, it := range a.GetInstruments() {
+		if strings.EqualFold(it.GetTicker(), q) || strings.EqualFold(it.GetFigi(), q) {
+			return true
+		}
+	}
+	return false
+}
+
+// AssetInstrumentJSON — инструмент актива
+type AssetInstrumentJSON struct {
+	Ticker         string `json:"ticker"`
+	InstrumentType string `json:"instrument_type,omitempty"`
+	ClassCode      string `json:"class_code"`
+	Figi           string `json:"figi,omitempty"`
+	Uid            string `json:"uid"`
+}
+
+// AssetJSON — актив и его инструменты
+type AssetJSON struct {
+	Uid         string                `json:"uid"`
+	Name        string                `json:"name"`
+	Type        string                `json:"type"`
+	Instruments []AssetInstrumentJSON `json:"instruments"`
+}
+
+// BrandJSON — бренд (эмитент) актива
+type BrandJSON struct {
+	Uid     string `json:"uid"`
+	Name    string `json:"name"`
+	Company string `json:"company,omitempty"`
+	Sector  string `json:"sector,omitempty"`
+	Country string `json:"country_of_risk,omitempty"`
+}
+
+// AssetsOutput — структурированный результат assets
+type AssetsOutput struct {
+	Total  int         `json:"total"`
+	Assets []AssetJSON `json:"assets"`
+}
+
+// AssetInfoOutput — структурированный результат asset_info
+type AssetInfoOutput struct {
+	AssetJSON
+	NameBrief    string     `json:"name_brief,omitempty"`
+	Status       string     `json:"status,omitempty"`
+	Cfi          string     `json:"cfi,omitempty"`
+	GosRegCode   string     `json:"gos_reg_code,omitempty"`
+	Isin         string     `json:"isin,omitempty"`
+	SecurityType string     `json:"security_type,omitempty"`
+	Currency     string     `json:"currency,omitempty"`
+	Brand        *BrandJSON `json:"brand,omitempty"`
+	Description  string     `json:"description,omitempty"`
+}
+
+// BrandsOutput — структурированный результат brands
+type BrandsOutput struct {
+	Total  int         `json:"total"`
+	Brands []BrandJSON `json:"brands"`
+}
+
+func assetJSON(a *pb.Asset) AssetJSON {
+	out := AssetJSON{Uid: a.GetUid(), Name: a.GetName(), Type: assetTypeName(a.GetType()), Instruments: []AssetInstrumentJSON{}}
+	for _, it := range a.GetInstruments() {
+		out.Instruments = append(out.Instruments, AssetInstrumentJSON{
+			Ticker: it.GetTicker(), InstrumentType: it.GetInstrumentType(), ClassCode: it.GetClassCode(),
+			Figi: it.GetFigi(), Uid: it.GetUid(),
+		})
+	}
+	return out
+}
+
+func assetTypeName(t pb.AssetType) string {
+	return strings.ToLower(strings.TrimPrefix(t.String(), "ASSET_TYPE_"))
+}
+
+func brandJSON(b *pb.Brand) BrandJSON {
+	return BrandJSON{Uid: b.GetUid(), Name: b.GetName(), Company: b.GetCompany(), Sector: b.GetSector(), Country: b.GetCountryOfRiskName()}
+}
+
+func formatAssetInstrument(it *pb.AssetInstrument) string {
+	return fmt.Sprintf("%s [%s, %s] – FIGI: %s, UID: %s",
+		it.GetTicker(), valueOrDash(it.GetInstrumentType()), it.GetClassCode(), valueOrDash(it.GetFigi()), it.GetUid())
+}
+
+func assetsHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	q, _ := req.RequireString("query")
+	q = strings.TrimSpace(q)
+	limit := req.GetInt("limit", 20)
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	all, err := ic.assets.list(ic)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка получения списка активов: %v", err)), nil
+	}
+	var found []*pb.Asset
+	for _, a := range all {
+		if matchAsset(a, q) {
+			found = append(found, a)
+		}
+	}
+	result := AssetsOutput{Total: len(found), Assets: []AssetJSON{}}
+	if len(found) == 0 {
+		return mcp.NewToolResultStructured(result, "Активы по запросу не найдены"), nil
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].GetName() < found[j].GetName() })
+
+	var lines []string
+	for i, a := range found {
+		if i >= limit {
+			lines = append(lines, fmt.Sprintf("... и ещё %d активов", len(found)-limit))
+			break
+		}
+		result.Assets = append(result.Assets, assetJSON(a))
+		lines = append(lines, fmt.Sprintf("%s (%s) – UID: %s", a.GetName(), assetTypeName(a.GetType()), a.GetUid()))
+		for _, it := range a.GetInstruments() {
+			lines = append(lines, "    "+formatAssetInstrument(it))
+		}
+	}
+	return mcp.NewToolResultStructured(result, fmt.Sprintf("Найдено активов: %d\n%s", len(found), formatList(lines))), nil
+}
+
+func assetInfoHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	q, _ := req.RequireString("query")
+	q = strings.TrimSpace(q)
+	instruments := ic.sdk.NewInstrumentsServiceClient()
+
+	// query может быть UID актива; иначе ищем инструмент и его актив в общем списке
+	assetUid := ""
+	if resp, err := instruments.GetAssetBy(q); err == nil && resp.GetAsset() != nil {
+		assetUid = q
+	} else {
+		inst, err := findInstrumentRef(ic, q)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		all, err := ic.assets.list(ic)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Ошибка получения списка активов: %v", err)), nil
+		}
+		a := assetByInstrument(all, inst.Uid)
+		if a == nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Актив для %s (%s) не найден", inst.Name, inst.Ticker)), nil
+		}
+		assetUid = a.GetUid()
+	}
+
+	resp, err := instruments.GetAssetBy(assetUid)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка получения актива: %v", err)), nil
+	}
+	a := resp.GetAsset()
+	result := AssetInfoOutput{
+		AssetJSON: assetJSON(&pb.Asset{Uid: a.GetUid(), Name: a.GetName(), Type: a.GetType(), Instruments: a.GetInstruments()}),
+		NameBrief: a.GetNameBrief(), Status: a.GetStatus(), Cfi: a.GetCfi(), GosRegCode: a.GetGosRegCode(),
+		Description: strings.TrimSpace(a.GetDescription()),
+	}
+	lines := []string{
+		fmt.Sprintf("%s (%s), тип: %s, UID: %s", a.GetName(), valueOrDash(a.GetNameBrief()), assetTypeName(a.GetType()), a.GetUid()),
+		fmt.Sprintf("Статус: %s, CFI: %s, рег. номер: %s", valueOrDash(a.GetStatus()), valueOrDash(a.GetCfi()), valueOrDash(a.GetGosRegCode())),
+	}
+	if sec := a.GetSecurity(); sec != nil {
+		result.Isin, result.SecurityType = sec.GetIsin(), sec.GetType()
+		lines = append(lines, fmt.Sprintf("ISIN: %s, вид бумаги: %s (%s)", valueOrDash(sec.GetIsin()), valueOrDash(sec.GetType()), kindName(sec.GetInstrumentKind())))
+	}
+	if cur := a.GetCurrency(); cur != nil {
+		result.Currency = strings.ToLower(cur.GetBaseCurrency())
+		lines = append(lines, fmt.Sprintf("Валюта: %s", strings.ToUpper(cur.GetBaseCurrency())))
+	}
+	if b := a.GetBrand(); b != nil && b.GetUid() != "" {
+		brand := brandJSON(b)
+		result.Brand = &brand
+		lines = append(lines, fmt.Sprintf("Бренд: %s, компания: %s, сектор: %s, страна риска: %s, UID бренда: %s",
+			b.GetName(), valueOrDash(b.GetCompany()), valueOrDash(b.GetSector()), valueOrDash(b.GetCountryOfRiskName()), b.GetUid()))
+	}
+	if d := strings.TrimSpace(a.GetDescription()); d != "" {
+		lines = append(lines, "Описание: "+truncateRunes(d, 500))
+	}
+	lines = append(lines, fmt.Sprintf("Инструменты (%d):", len(a.GetInstruments())))
+	for _, it := range a.GetInstruments() {
+		lines = append(lines, "    "+formatAssetInstrument(it))
+	}
+	return mcp.NewToolResultStructured(result, "Актив:\n"+formatList(lines)), nil
+}
+
+func brandsHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	q := strings.ToLower(strings.TrimSpace(req.GetString("query", "")))
+	limit := req.GetInt("limit", 50)
+	if limit < 1 {
+		limit = 1
+	}
+	resp, err := ic.sdk.NewInstrumentsServiceClient().GetBrands()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка получения брендов: %v", err)), nil
+	}
+	var lines []string
+	total := 0
+	result := BrandsOutput{Brands: []BrandJSON{}}
+	for _, b := range resp.GetBrands() {
+		if q != "" && !strings.Contains(strings.ToLower(b.GetName()), q) && !strings.Contains(strings.ToLower(b.GetCompany()), q) {
+			continue
+		}
+		total++
+		if len(lines) < limit {
+			result.Brands = append(result.Brands, brandJSON(b))
+			lines = append(lines, fmt.Sprintf("%s – компания: %s, сектор: %s, страна: %s, UID: %s",
+				b.GetName(), valueOrDash(b.GetCompany()), valueOrDash(b.GetSector()), valueOrDash(b.GetCountryOfRiskName()), b.GetUid()))
+		}
+	}
+	result.Total = total
+	if total == 0 {
+		return mcp.NewToolResultStructured(result, "Бренды не найдены"), nil
+	}
+	text := fmt.Sprintf("Найдено брендов: %d\n%s", total, formatList(lines))
+	if total > len(lines) {
+		text += fmt.Sprintf(" ... и ещё %d\n", total-len(lines))
+	}
+	return mcp.NewToolResultStructured(result, text), nil
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+)
+
+// couponsTTL — сколько сохранённый купонный график считается актуальным: размеры плавающих купонов объявляются по ходу обращения
+const couponsTTL = 24 * time.Hour
+
+// couponPayment — купон из сохранённого графика
+type couponPayment struct {
+	Date   time.Time `json:"date"`
+	Amount float64   `json:"amount"` // на одну облигацию; 0 — размер ещё не объявлен
+}
+
+// storedCoupons — купонный график облигации в $TINKOFF_DATA_DIR/coupons/{uid}.json
+type storedCoupons struct {
+	Fetched time.Time       `json:"fetched"`
+	Until   time.Time       `json:"until"`
+	Coupons []couponPayment `json:"coupons"`
+}
+
+func couponStorePath(ic *InvestClient, bond *pb.Bond) string {
+	return filepath.Join(ic.dataDir, "coupons", bond.GetUid()+".json")
+}
+
+// couponHorizon — до какой даты запрашивается график: погашение, а для бессрочных — горизонт расчёта
+func couponHorizon(bond *pb.Bond, until time.Time) time.Time {
+	if m := bond.GetMaturityDate().AsTime(); m.After(until) {
+		return m
+	}
+	return until
+}
+
+// cachedCoupons возвращает сохранённый график, если он свежий и покрывает until
+func cachedCoupons(ic *InvestClient, bond *pb.Bond, until time.Time) ([]couponPayment, bool) {
+	var st storedCoupons
+	if err := readJSONFile(couponStorePath(ic, bond), &st); err != nil || st.Fetched.IsZero() {
+		return nil, false
+	}
+	if time.Since(st.Fetched) >= couponsTTL || st.Until.Before(until) {
+		return nil, false
+	}
+	return st.Coupons, true
+}
+
+// fetchCoupons запрашивает купоны через GetBondCoupons и сохраняет график; заголовки ответа нужны для учёта лимита
+func fetchCoupons(ic *InvestClient, bond *pb.Bond, now, until time.Time) ([]couponPayment, map[string][]string, error) {
+	until = couponHorizon(bond, until)
+	resp, err := ic.sdk.NewInstrumentsServiceClient().GetBondCoupons(bond.GetFigi(), now, until)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка получения купонов: %w", err)
+	}
+	coupons := make([]couponPayment, 0, len(resp.GetEvents()))
+	for _, c := range resp.GetEvents() {
+		coupons = append(coupons, couponPayment{Date: c.GetCouponDate().AsTime(), Amount: moneyToFloat(c.GetPayOneBond())})
+	}
+	sort.Slice(coupons, func(i, j int) bool { return coupons[i].Date.Before(coupons[j].Date) })
+	st := storedCoupons{Fetched: time.Now().UTC(), Until: until, Coupons: coupons}
+	if err := writeJSONFile(couponStorePath(ic, bond), st); err != nil {
+		log.Printf("Не удалось сохранить купоны %s: %v", bond.GetTicker(), err)
+	}
+	return coupons, resp.Header, nil
+}
+
+// bondCoupons — купонный график до until: из сохранённого файла или через API
+func bondCoupons(ic *InvestClient, bond *pb.Bond, now, until time.Time) ([]couponPayment, error) {
+	if coupons, ok := cachedCoupons(ic, bond, until); ok {
+		return coupons, nil
+	}
+	coupons, _, err := fetchCoupons(ic, bond, now, until)
+	return coupons, err
+}
+
+// cashFlow — будущая выплата по облигации на одну бумагу
+type cashFlow struct {
+	Date      time.Time
+	Coupon    float64
+	Principal float64
+}
+
+func (c cashFlow) Amount() float64 { return c.Coupon + c.Principal }
+
+// BondAnalytics — результат расчёта доходности и дюрации облигации
+type BondAnalytics struct {
+	Bond              *pb.Bond
+	Horizon           time.Time // дата погашения или оферты, до которой считаются потоки
+	ToOffer           bool
+	Nominal           float64
+	CleanPercent      float64
+	CleanPrice        float64
+	AccruedInterest   float64
+	DirtyPrice        float64
+	AnnualCoupon      float64
+	CurrentYield      float64
+	YTM               float64
+	Duration          float64 // дюрация Маколея, лет
+	ModifiedDuration  float64
+	Flows             []cashFlow
+	EstimatedCoupons  int // число купонов с неизвестным размером, взятых по последнему известному
+	PriceTime         time.Time
+	AccruedFromServer bool
+}
+
+// CashFlowJSON — будущая выплата на одну облигацию
+type CashFlowJSON struct {
+	Date      string `json:"date"`
+	Coupon    string `json:"coupon"`
+	Principal string `json:"principal"`
+}
+
+// BondAnalyticsOutput — структурированный результат bond_analytics; суммы — в валюте номинала,
+// доходности — в процентах годовых
+type BondAnalyticsOutput struct {
+	Instrument       InstrumentJSON `json:"instrument"`
+	Currency         string         `json:"currency"`
+	Nominal          string         `json:"nominal"`
+	HorizonDate      string         `json:"horizon_date"`
+	ToOffer          bool           `json:"to_offer"`
+	CleanPercent     string         `json:"clean_price_percent"`
+	CleanPrice       string         `json:"clean_price"`
+	AccruedInterest  string         `json:"accrued_interest"`
+	DirtyPrice       string         `json:"dirty_price"`
+	AnnualCoupon     string         `json:"annual_coupon"`
+	CurrentYield     float64        `json:"current_yield_pct"`
+	YTM              float64        `json:"ytm_pct"`
+	Duration         float64        `json:"macaulay_duration_years"`
+	ModifiedDuration float64        `json:"modified_duration"`
+	PriceTime        string         `json:"price_time"`
+	CashFlows        []CashFlowJSON `json:"cash_flows"`
+	Warnings         []string       `json:"warnings,omitempty"`
+}
+
+func roundTo(v float64, prec int) float64 {
+	p := math.Pow(10, float64(prec))
+	return math.Round(v*p) / p
+}
+
+// bondAnalyticsParams — необязательные параметры расчёта
+type bondAnalyticsParams struct {
+	OfferDate     time.Time // дата оферты; если задана, доходность считается к оферте
+	OfferPercent  float64   // цена выкупа по оферте в % от номинала
+	Amortizations []cashFlow
+}
+
+// computeBondAnalytics загружает параметры облигации, последнюю цену и НКД и
+// рассчитывает доходности. Цена облигации в API задаётся в процентах от номинала.
+func computeBondAnalytics(ic *InvestClient, ref *InstrumentRef, params bondAnalyticsParams) (*BondAnalytics, error) {
+	instruments := ic.sdk.NewInstrumentsServiceClient()
+	bondResp, err := instruments.BondByUid(ref.Uid)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения облигации: %w", err)
+	}
+	bond := bondResp.GetInstrument()
+	now := time.Now().UTC()
+
+	md := ic.sdk.NewMarketDataServiceClient()
+	lpResp, err := md.GetLastPrices([]string{bond.GetFigi()})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения последней цены: %w", err)
+	}
+	if len(lpResp.GetLastPrices()) == 0 {
+		return nil, fmt.Errorf("нет данных о последней цене")
+	}
+	lp := lpResp.GetLastPrices()[0]
+	a := newBondAnalytics(bond, quotationToFloat(lp.GetPrice()), lp.GetTime().AsTime())
+
+	// НКД на сегодня: запись GetAccruedInterests за текущую дату, иначе aci_value из карточки
+	aciResp, err := instruments.GetAccruedInterests(bond.GetFigi(), now.AddDate(0, 0, -1), now)
+	if err == nil {
+		items := aciResp.GetAccruedInterests()
+		if len(items) > 0 {
+			a.AccruedInterest = quotationToFloat(items[len(items)-1].GetValue())
+			a.AccruedFromServer = true
+		}
+	}
+
+	if err := a.evaluate(ic, params, now); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// newBondAnalytics подготавливает расчёт по карточке облигации и чистой цене в % от номинала
+func newBondAnalytics(bond *pb.Bond, cleanPercent float64, priceTime time.Time) *BondAnalytics {
+	a := &BondAnalytics{
+		Bond:            bond,
+		Horizon:         bond.GetMaturityDate().AsTime(),
+		Nominal:         moneyToFloat(bond.GetNominal()),
+		CleanPercent:    cleanPercent,
+		PriceTime:       priceTime,
+		AccruedInterest: moneyToFloat(bond.GetAciValue()),
+	}
+	a.CleanPrice = a.CleanPercent / 100 * a.Nominal
+	return a
+}
+
+// evaluate берёт купонный график (сохранённый или через GetBondCoupons), строит денежные потоки и считает YTM и дюрацию
+func (a *BondAnalytics) evaluate(ic *InvestClient, params bondAnalyticsParams, now time.Time) error {
+	bond := a.Bond
+	if bond.GetPerpetualFlag() && params.OfferDate.IsZero() {
+		return fmt.Errorf("облигация бессрочная: для расчёта доходности укажите дату оферты (offer_date)")
+	}
+	if !params.OfferDate.IsZero() {
+		if !params.OfferDate.After(now) {
+			return fmt.Errorf("дата оферты должна быть в будущем")
+		}
+		a.Horizon = params.OfferDate
+		a.ToOffer = true
+	}
+	if !a.Horizon.After(now) {
+		return fmt.Errorf("облигация погашена %s", a.Horizon.Format("2006-01-02"))
+	}
+	if a.CleanPercent <= 0 {
+		return fmt.Errorf("нет сделок: последняя цена равна нулю")
+	}
+	a.DirtyPrice = a.CleanPrice + a.AccruedInterest
+
+	coupons, err := bondCoupons(ic, bond, now, a.Horizon)
+	if err != nil {
+		return err
+	}
+
+	var lastKnown float64
+	for _, c := range coupons {
+		d := c.Date
+		if !d.After(now) || d.After(a.Horizon) {
+			continue
+		}
+		amount := c.Amount
+		if amount > 0 {
+			lastKnown = amount
+		} else if lastKnown > 0 {
+			// размер плавающего/переменного купона ещё не объявлен — берём последний известный
+			amount = lastKnown
+			a.EstimatedCoupons++
+		}
+		a.Flows = append(a.Flows, cashFlow{Date: d, Coupon: amount})
+	}
+
+	// Погашение номинала: явный график амортизации, остаток — в дату погашения/оферты
+	remaining := a.Nominal
+	for _, am := range params.Amortizations {
+		if !am.Date.After(now) || am.Date.After(a.Horizon) {
+			continue
+		}
+		a.Flows = append(a.Flows, am)
+		remaining -= am.Principal
+	}
+	if remaining < 0 {
+		return fmt.Errorf("сумма амортизаций превышает текущий номинал %.2f", a.Nominal)
+	}
+	redemption := remaining
+	if a.ToOffer {
+		redemption = remaining * params.OfferPercent / 100
+	}
+	a.Flows = append(a.Flows, cashFlow{Date: a.Horizon, Principal: redemption})
+	a.Flows = mergeCashFlows(a.Flows)
+
+	if n := bond.GetCouponQuantityPerYear(); n > 0 && lastKnown > 0 {
+		a.AnnualCoupon = lastKnown * float64(n)
+	}
+	if a.CleanPrice > 0 {
+		a.CurrentYield = a.AnnualCoupon / a.CleanPrice
+	}
+
+	a.YTM, err = solveYield(a.DirtyPrice, a.Flows, now)
+	if err != nil {
+		return err
+	}
+	a.Duration = macaulayDuration(a.YTM, a.DirtyPrice, a.Flows, now)
+	a.ModifiedDuration = a.Duration / (1 + a.YTM)
+	return nil
+}
+
+// mergeCashFlows сортирует потоки и объединяет выплаты в одну дату
+func mergeCashFlows(flows []cashFlow) []cashFlow {
+	sort.Slice(flows, func(i, j int) bool { return flows[i].Date.Before(flows[j].Date) })
+	var out []cashFlow
+	for _, f := range flows {
+		if n := len(out); n > 0 && out[n-1].Date.Equal(f.Date) {
+			out[n-1].Coupon += f.Coupon
+			out[n-1].Principal += f.Principal
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+func yearFraction(from, to time.Time) float64 {
+	return to.Sub(from).Hours() / 24 / 365
+}
+
+// presentValue — приведённая стоимость потоков при эффективной годовой ставке y
+func presentValue(y float64, flows []cashFlow, now time.Time) float64 {
+	var pv float64
+	for _, f := range flows {
+		pv += f.Amount() / math.Pow(1+y, yearFraction(now, f.Date))
+	}
+	return pv
+}
+
+// solveYield находит эффективную доходность к погашению (оферте) методом бисекции
+func solveYield(dirtyPrice float64, flows []cashFlow, now time.Time) (float64, error) {
+	lo, hi := -0.99, 10.0
+	if presentValue(lo, flows, now) < dirtyPrice || presentValue(hi, flows, now) > dirtyPrice {
+		return 0, fmt.Errorf("не удалось рассчитать доходность: цена вне допустимого диапазона")
+	}
+	for i := 0; i < 200; i++ {
+		mid := (lo + hi) / 2
+		if presentValue(mid, flows, now) > dirtyPrice {
+			lo = mid
+		} else {
+			hi = mid
+		}
+		if hi-lo < 1e-10 {
+			break
+		}
+	}
+	return (lo + hi) / 2, nil
+}
+
+// macaulayDuration — средневзвешенный срок потоков в годах
+func macaulayDuration(y, dirtyPrice float64, flows []cashFlow, now time.Time) float64 {
+	if dirtyPrice <= 0 {
+		return 0
+	}
+	var sum float64
+	for _, f := range flows {
+		t := yearFraction(now, f.Date)
+		sum += t * f.Amount() / math.Pow(1+y, t)
+	}
+	return sum / dirtyPrice
+}
+
+// parseAmortizations разбирает график амортизации в формате "YYYY-MM-DD:сумма"
+func parseAmortizations(items []string) ([]cashFlow, error) {
+	var out []cashFlow
+	for _, it := range items {
+		parts := strings.SplitN(it, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("некорректная амортизация %q, ожидается YYYY-MM-DD:сумма", it)
+		}
+		d, err := time.Parse("2006-01-02", strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, fmt.Errorf("некорректная дата амортизации %q: %v", parts[0], err)
+		}
+		amount, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || amount <= 0 {
+			return nil, fmt.Errorf("некорректная сумма амортизации %q", parts[1])
+		}
+		out = append(out, cashFlow{Date: d, Principal: amount})
+	}
+	return out, nil
+}
+
+func bondAnalyticsHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	q, _ := req.RequireString("query")
+	params := bondAnalyticsParams{OfferPercent: req.GetFloat("offer_price", 100)}
+	if s := strings.TrimSpace(req.GetString("offer_date", "")); s != "" {
+		d, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Некорректный формат offer_date: %v", err)), nil
+		}
+		params.OfferDate = d
+	}
+	amort, err := parseAmortizations(stringListArg(req, "amortizations"))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	params.Amortizations = amort
+
+	inst, err := findInstrumentRef(ic, q)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if inst.Kind != pb.InstrumentType_INSTRUMENT_TYPE_BOND {
+		return mcp.NewToolResultError(fmt.Sprintf("%s (%s) не является облигацией", inst.Name, inst.Ticker)), nil
+	}
+
+	a, err := computeBondAnalytics(ic, inst, params)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка расчёта аналитики облигации: %v", err)), nil
+	}
+	b := a.Bond
+	cur := strings.ToUpper(b.GetCurrency())
+	horizon := "погашения"
+	if a.ToOffer {
+		horizon = "оферты"
+	}
+	lines := []string{
+		fmt.Sprintf("%s (%s), FIGI %s", b.GetName(), b.GetTicker(), b.GetFigi()),
+		fmt.Sprintf("Номинал: %.2f %s (начальный %s), дата %s: %s",
+			a.Nominal, cur, moneyToStr(b.GetInitialNominal()), horizon, a.Horizon.Format("2006-01-02")),
+		fmt.Sprintf("Чистая цена: %.4f%% = %.2f %s (время котировки %s)",
+			a.CleanPercent, a.CleanPrice, cur, a.PriceTime.UTC().Format(time.RFC3339)),
+		fmt.Sprintf("НКД: %.2f %s, грязная цена: %.2f %s", a.AccruedInterest, cur, a.DirtyPrice, cur),
+		fmt.Sprintf("Годовой купон: %.2f %s, текущая доходность: %.2f%%", a.AnnualCoupon, cur, a.CurrentYield*100),
+		fmt.Sprintf("Доходность к %s (эфф.): %.2f%%", horizon, a.YTM*100),
+		fmt.Sprintf("Дюрация Маколея: %.2f лет (%.0f дн.), модифицированная дюрация: %.2f",
+			a.Duration, a.Duration*365, a.ModifiedDuration),
+		fmt.Sprintf("Будущих выплат: %d", len(a.Flows)),
+	}
+	result := BondAnalyticsOutput{
+		Instrument: InstrumentJSON{Figi: b.GetFigi(), Uid: b.GetUid(), Ticker: b.GetTicker(), ClassCode: b.GetClassCode(), Name: b.GetName(), Kind: "bond"},
+		Currency:   strings.ToLower(b.GetCurrency()), Nominal: floatJSON(a.Nominal, 2),
+		HorizonDate: a.Horizon.Format("2006-01-02"), ToOffer: a.ToOffer,
+		CleanPercent: floatJSON(a.CleanPercent, 4), CleanPrice: floatJSON(a.CleanPrice, 2),
+		AccruedInterest: floatJSON(a.AccruedInterest, 2), DirtyPrice: floatJSON(a.DirtyPrice, 2),
+		AnnualCoupon: floatJSON(a.AnnualCoupon, 2), CurrentYield: roundTo(a.CurrentYield*100, 4),
+		YTM: roundTo(a.YTM*100, 4), Duration: roundTo(a.Duration, 4), ModifiedDuration: roundTo(a.ModifiedDuration, 4),
+		PriceTime: timeJSON(a.PriceTime), CashFlows: make([]CashFlowJSON, 0, len(a.Flows)),
+	}
+	for _, f := range a.Flows {
+		result.CashFlows = append(result.CashFlows, CashFlowJSON{
+			Date: f.Date.Format("2006-01-02"), Coupon: floatJSON(f.Coupon, 2), Principal: floatJSON(f.Principal, 2),
+		})
+	}
+	warnings := len(lines)
+	if b.GetAmortizationFlag() && len(params.Amortizations) == 0 {
+		lines = append(lines, "Внимание: облигация амортизируемая, график амортизации API не предоставляет — остаток номинала учтён в дату "+horizon+". Передайте amortizations для точного расчёта")
+	}
+	if a.EstimatedCoupons > 0 {
+		lines = append(lines, fmt.Sprintf("Внимание: размер %d купонов не объявлен, использован последний известный купон", a.EstimatedCoupons))
+	}
+	if !a.AccruedFromServer {
+		lines = append(lines, "НКД взят из карточки облигации (aci_value)")
+	}
+	result.Warnings = lines[warnings:]
+	return mcp.NewToolResultStructured(result, "Аналитика облигации:\n"+formatList(lines)), nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestBondYieldReferenceValues(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// годы по 365 дней, как в yearFraction, чтобы эталоны считались в целых периодах
+	year := func(n int) time.Time { return now.AddDate(0, 0, 365*n) }
+	tests := []struct {
+		name      string
+		clean     float64 // % от номинала
+		maturity  time.Time
+		coupons   []couponPayment
+		params    bondAnalyticsParams
+		flows     int
+		estimated int
+		// эталоны: YTM из уравнения цены, дюрация Маколея — Σ t·CF/(1+y)^t / цена
+		ytm, duration, modified float64
+	}{
+		{
+			name: "bullet", clean: 100, maturity: year(3),
+			coupons: []couponPayment{{year(1), 100}, {year(2), 100}, {year(3), 100}},
+			flows:   3, ytm: 0.1, duration: 2.735537, modified: 2.486852,
+		},
+		{
+			name: "amortizing", clean: 100, maturity: year(2),
+			coupons: []couponPayment{{year(1), 100}, {year(2), 50}},
+			params:  bondAnalyticsParams{Amortizations: []cashFlow{{Date: year(1), Principal: 500}}},
+			flows:   2, ytm: 0.1, duration: 1.454545, modified: 1.322314,
+		},
+		{
+			// 980 = 100/(1+y) + 1100/(1+y)²; второй купон не объявлен и берётся равным последнему известному,
+			// купоны после оферты не учитываются
+			name: "offer", clean: 98, maturity: year(5),
+			coupons: []couponPayment{{year(1), 100}, {year(2), 0}, {year(3), 100}, {year(4), 100}, {year(5), 100}},
+			params:  bondAnalyticsParams{OfferDate: year(2), OfferPercent: 100},
+			flows:   2, estimated: 1, ytm: 0.111705, duration: 1.908212, modified: 1.716473,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ic := &InvestClient{dataDir: t.TempDir()}
+			bond := &pb.Bond{
+				Uid: "bond-" + tt.name, Ticker: tt.name, CouponQuantityPerYear: 1,
+				Nominal:      &pb.MoneyValue{Currency: "rub", Units: 1000},
+				MaturityDate: timestamppb.New(tt.maturity),
+			}
+			// купоны берутся из сохранённого графика, без обращения к API
+			st := storedCoupons{Fetched: time.Now().UTC(), Until: tt.maturity, Coupons: tt.coupons}
+			if err := writeJSONFile(couponStorePath(ic, bond), st); err != nil {
+				t.Fatal(err)
+			}
+			a := newBondAnalytics(bond, tt.clean, now)
+			a.AccruedInterest = 0
+			if err := a.evaluate(ic, tt.params, now); err != nil {
+				t.Fatal(err)
+			}
+			if len(a.Flows) != tt.flows || a.EstimatedCoupons != tt.estimated {
+				t.Errorf("потоков %d, оценённых купонов %d, ожидалось %d и %d", len(a.Flows), a.EstimatedCoupons, tt.flows, tt.estimated)
+			}
+			for _, c := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"YTM", a.YTM, tt.ytm},
+				{"дюрация", a.Duration, tt.duration},
+				{"модифицированная дюрация", a.ModifiedDuration, tt.modified},
+			} {
+				if math.Abs(c.got-c.want) > 1e-6 {
+					t.Errorf("%s = %.7f, ожидалось %.6f", c.name, c.got, c.want)
+				}
+			}
+			// при найденной ставке приведённая стоимость потоков равна грязной цене
+			if pv := presentValue(a.YTM, a.Flows, now); math.Abs(pv-a.DirtyPrice) > 1e-6 {
+				t.Errorf("PV = %.7f, грязная цена %.2f", pv, a.DirtyPrice)
+			}
+		})
+	}
+}
+
+func TestSolveYieldOutOfRange(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	flows := []cashFlow{{Date: now.AddDate(1, 0, 0), Principal: 1000}}
+	if _, err := solveYield(0.001, flows, now); err == nil {
+		t.Error("ожидалась ошибка для цены вне диапазона")
+	}
+}
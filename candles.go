@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/tinkoff/invest-api-go-sdk/investgo"
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// candleWindow — максимальный период одного запроса GetCandles для интервала (лимиты API)
+func candleWindow(interval pb.CandleInterval) time.Duration {
+	const day = 24 * time.Hour
+	switch interval {
+	case pb.CandleInterval_CANDLE_INTERVAL_30_MIN:
+		return 2 * day
+	case pb.CandleInterval_CANDLE_INTERVAL_HOUR:
+		return 7 * day
+	case pb.CandleInterval_CANDLE_INTERVAL_2_HOUR, pb.CandleInterval_CANDLE_INTERVAL_4_HOUR:
+		return 30 * day
+	case pb.CandleInterval_CANDLE_INTERVAL_DAY:
+		return 365 * day
+	case pb.CandleInterval_CANDLE_INTERVAL_WEEK, pb.CandleInterval_CANDLE_INTERVAL_MONTH:
+		return 2 * 365 * day
+	default:
+		// 1m, 2m, 3m, 5m, 10m, 15m
+		return day
+	}
+}
+
+// fixedIntervals — интервалы API фиксированной длины, от крупного к мелкому;
+// из них собираются свечи произвольного интервала (неделя и месяц переменной длины не подходят)
+var fixedIntervals = []struct {
+	Interval pb.CandleInterval
+	Duration time.Duration
+}{
+	{pb.CandleInterval_CANDLE_INTERVAL_DAY, 24 * time.Hour},
+	{pb.CandleInterval_CANDLE_INTERVAL_4_HOUR, 4 * time.Hour},
+	{pb.CandleInterval_CANDLE_INTERVAL_2_HOUR, 2 * time.Hour},
+	{pb.CandleInterval_CANDLE_INTERVAL_HOUR, time.Hour},
+	{pb.CandleInterval_CANDLE_INTERVAL_30_MIN, 30 * time.Minute},
+	{pb.CandleInterval_CANDLE_INTERVAL_15_MIN, 15 * time.Minute},
+	{pb.CandleInterval_CANDLE_INTERVAL_10_MIN, 10 * time.Minute},
+	{pb.CandleInterval_CANDLE_INTERVAL_5_MIN, 5 * time.Minute},
+	{pb.CandleInterval_CANDLE_INTERVAL_3_MIN, 3 * time.Minute},
+	{pb.CandleInterval_CANDLE_INTERVAL_2_MIN, 2 * time.Minute},
+	{pb.CandleInterval_CANDLE_INTERVAL_1_MIN, time.Minute},
+}
+
+// CandleSpec — запрошенный интервал свечей: интервал API и, если его нет в API,
+// шаг локальной пересборки из свечей Interval
+type CandleSpec struct {
+	Interval pb.CandleInterval
+	Resample time.Duration
+}
+
+var resampleRe = regexp.MustCompile(`^(\d+)\s*(m|min|h|d)$`)
+
+// parseCandleSpec разбирает интервал: сначала как интервал API, затем как произвольный N m/h/d
+func parseCandleSpec(s string) (CandleSpec, error) {
+	if iv, err := parseCandleInterval(s); err == nil {
+		return CandleSpec{Interval: iv}, nil
+	}
+	m := resampleRe.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if m == nil {
+		return CandleSpec{}, fmt.Errorf("неизвестный interval %q. Допустимо: 1m,2m,3m,5m,10m,15m,30m,1h,2h,4h,1d,week,month или N m/h/d, напр. 45m, 3d", s)
+	}
+	n, _ := strconv.Atoi(m[1])
+	unit := time.Minute
+	switch m[2] {
+	case "h":
+		unit = time.Hour
+	case "d":
+		unit = 24 * time.Hour
+	}
+	step := time.Duration(n) * unit
+	if n <= 0 || step > 365*24*time.Hour {
+		return CandleSpec{}, fmt.Errorf("interval %q вне допустимого диапазона", s)
+	}
+	for _, fi := range fixedIntervals {
+		if fi.Duration < step && step%fi.Duration == 0 {
+			return CandleSpec{Interval: fi.Interval, Resample: step}, nil
+		}
+	}
+	return CandleSpec{}, fmt.Errorf("interval %q нельзя собрать из интервалов API", s)
+}
+
+// step — длительность одной итоговой свечи
+func (s CandleSpec) step() time.Duration {
+	if s.Resample > 0 {
+		return s.Resample
+	}
+	return candleDuration(s.Interval)
+}
+
+// alignFrom выравнивает начало периода на границу корзины пересборки, чтобы первая свеча была полной
+func (s CandleSpec) alignFrom(from time.Time) time.Time {
+	if s.Resample == 0 {
+		return from
+	}
+	return truncateUnix(from, s.Resample)
+}
+
+// truncateUnix округляет t вниз до кратного step, считая от 1970-01-01 UTC
+// (time.Truncate отсчитывает от 0001-01-01, что сдвигает корзины в несколько дней)
+func truncateUnix(t time.Time, step time.Duration) time.Time {
+	d := time.Duration(t.UnixNano())
+	return time.Unix(0, int64(d-d%step)).UTC()
+}
+
+// resampleCandles собирает свечи шага step из более мелких: корзины отсчитываются от 1970-01-01 UTC,
+// open — первой свечи, close — последней, high/low — экстремумы, объём суммируется.
+// Свеча считается завершённой, только если завершены все входящие в неё свечи и её период истёк к now.
+func resampleCandles(candles []*pb.HistoricCandle, step time.Duration, now time.Time) []*pb.HistoricCandle {
+	var out []*pb.HistoricCandle
+	var cur *pb.HistoricCandle
+	var curStart time.Time
+	for _, c := range candles {
+		start := truncateUnix(c.GetTime().AsTime(), step)
+		if cur == nil || !start.Equal(curStart) {
+			if cur != nil {
+				cur.IsComplete = cur.IsComplete && !curStart.Add(step).After(now)
+				out = append(out, cur)
+			}
+			curStart = start
+			cur = &pb.HistoricCandle{
+				Open: c.GetOpen(), High: c.GetHigh(), Low: c.GetLow(), Close: c.GetClose(),
+				Volume: c.GetVolume(), Time: timestamppb.New(start), IsComplete: c.GetIsComplete(),
+			}
+			continue
+		}
+		if quotationNanos(c.GetHigh()) > quotationNanos(cur.High) {
+			cur.High = c.GetHigh()
+		}
+		if quotationNanos(c.GetLow()) < quotationNanos(cur.Low) {
+			cur.Low = c.GetLow()
+		}
+		cur.Close = c.GetClose()
+		cur.Volume += c.GetVolume()
+		cur.IsComplete = cur.IsComplete && c.GetIsComplete()
+	}
+	if cur != nil {
+		cur.IsComplete = cur.IsComplete && !curStart.Add(step).After(now)
+		out = append(out, cur)
+	}
+	return out
+}
+
+// CandleQuery — разобранный запрос свечей: инструмент, интервал и период
+type CandleQuery struct {
+	Inst *InstrumentRef
+	Spec CandleSpec
+	From time.Time
+	To   time.Time
+}
+
+// parseCandleQuery разбирает параметры query/from/to/interval, общие для инструментов со свечами
+func parseCandleQuery(ic *InvestClient, q, fromStr, toStr, intervalStr string) (*CandleQuery, error) {
+	cq, err := parseCandlePeriod(fromStr, toStr, intervalStr)
+	if err != nil {
+		return nil, err
+	}
+	if cq.Inst, err = findInstrumentRef(ic, q); err != nil {
+		return nil, err
+	}
+	return cq, nil
+}
+
+// parseCandlePeriod разбирает from/to/interval; инструмент заполняет вызывающий
+func parseCandlePeriod(fromStr, toStr, intervalStr string) (*CandleQuery, error) {
+	from, err := time.Parse(time.RFC3339, fromStr)
+	if err != nil {
+		return nil, fmt.Errorf("Некорректный формат from: %v", err)
+	}
+	to, err := time.Parse(time.RFC3339, toStr)
+	if err != nil {
+		return nil, fmt.Errorf("Некорректный формат to: %v", err)
+	}
+	if !to.After(from) {
+		return nil, fmt.Errorf("Параметр 'to' должен быть позже, чем 'from'")
+	}
+	spec, err := parseCandleSpec(intervalStr)
+	if err != nil {
+		return nil, err
+	}
+	return &CandleQuery{Spec: spec, From: spec.alignFrom(from), To: to}, nil
+}
+
+// load получает свечи через локальное хранилище и при необходимости пересобирает их в нужный интервал
+func (cq *CandleQuery) load(ctx context.Context, ic *InvestClient, progress *windowProgress) ([]*pb.HistoricCandle, error) {
+	candles, err := loadCandles(ctx, ic, cq.Inst.Uid, cq.Spec.Interval, cq.From, cq.To, progress)
+	if err != nil {
+		return nil, err
+	}
+	if cq.Spec.Resample > 0 {
+		candles = resampleCandles(candles, cq.Spec.Resample, time.Now())
+	}
+	return candles, nil
+}
+
+// candleWindows режет период [from, to) на последовательные окна не длиннее max
+func candleWindows(from, to time.Time, max time.Duration) [][2]time.Time {
+	var windows [][2]time.Time
+	for start := from; start.Before(to); start = start.Add(max) {
+		end := start.Add(max)
+		if end.After(to) {
+			end = to
+		}
+		windows = append(windows, [2]time.Time{start, end})
+	}
+	return windows
+}
+
+// progressFunc сообщает о ходе длительной операции: выполнено done из total
+type progressFunc func(done, total int, message string)
+
+// toolProgress возвращает функцию, отправляющую MCP-уведомления notifications/progress,
+// если клиент передал progressToken; иначе уведомления не отправляются
+func toolProgress(ctx context.Context, req mcp.CallToolRequest) progressFunc {
+	srv := server.ServerFromContext(ctx)
+	if srv == nil || req.Params.Meta == nil || req.Params.Meta.ProgressToken == nil {
+		return func(int, int, string) {}
+	}
+	token := req.Params.Meta.ProgressToken
+	return func(done, total int, message string) {
+		params := map[string]any{
+			"progressToken": token,
+			"progress":      done,
+			"total":         total,
+		}
+		if message != "" {
+			params["message"] = message
+		}
+		if err := srv.SendNotificationToClient(ctx, "notifications/progress", params); err != nil {
+			log.Printf("Не удалось отправить уведомление о прогрессе: %v", err)
+		}
+	}
+}
+
+// windowProgress — сквозной счётчик окон GetCandles одного вызова инструмента: загрузка идёт
+// по нескольким файлам хранилища, участкам без покрытия и удлинениям периода, а прогресс
+// в notifications/progress должен только расти
+type windowProgress struct {
+	report      progressFunc
+	done, total int
+}
+
+func newWindowProgress(report progressFunc) *windowProgress {
+	return &windowProgress{report: report}
+}
+
+// plan добавляет к ожидаемому числу окон ещё n
+func (p *windowProgress) plan(n int) { p.total += n }
+
+// step отмечает загрузку очередного окна
+func (p *windowProgress) step() {
+	p.done++
+	if p.done > p.total {
+		p.total = p.done
+	}
+	p.report(p.done, p.total, fmt.Sprintf("загружено окон %d из %d", p.done, p.total))
+}
+
+// fetchCandles загружает свечи за произвольный период: режет его на допустимые для интервала окна,
+// выдерживает лимит запросов по заголовкам x-ratelimit-*, склеивает результат без дублей по времени.
+// Окна должны быть заранее учтены в progress.plan
+func fetchCandles(ctx context.Context, ic *InvestClient, instrumentID string, interval pb.CandleInterval, from, to time.Time, progress *windowProgress) ([]*pb.HistoricCandle, error) {
+	md := ic.sdk.NewMarketDataServiceClient()
+	windows := candleWindows(from, to, candleWindow(interval))
+	byTime := make(map[int64]*pb.HistoricCandle)
+	for i, w := range windows {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		resp, err := md.GetCandles(instrumentID, interval, w[0], w[1])
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения свечей за %s → %s: %w",
+				w[0].UTC().Format(time.RFC3339), w[1].UTC().Format(time.RFC3339), err)
+		}
+		for _, c := range resp.GetCandles() {
+			// более поздний ответ содержит более свежие данные по той же свече
+			byTime[c.GetTime().AsTime().Unix()] = c
+		}
+		progress.step()
+		if i < len(windows)-1 {
+			if err := waitRateLimit(ctx, resp.Header, "GetCandles"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	candles := make([]*pb.HistoricCandle, 0, len(byTime))
+	for _, c := range byTime {
+		candles = append(candles, c)
+	}
+	sort.Slice(candles, func(i, j int) bool {
+		return candles[i].GetTime().AsTime().Before(candles[j].GetTime().AsTime())
+	})
+	return candles, nil
+}
+
+// waitRateLimit ждёт сброса лимита, если в текущей минуте запросов method не осталось
+func waitRateLimit(ctx context.Context, header map[string][]string, method string) error {
+	if investgo.RemainingLimitFromHeader(header) != 0 {
+		return nil
+	}
+	wait := time.Second
+	if v := header["x-ratelimit-reset"]; len(v) > 0 {
+		if sec, err := strconv.Atoi(v[0]); err == nil && sec > 0 {
+			wait = time.Duration(sec) * time.Second
+		}
+	}
+	log.Printf("Лимит запросов %s исчерпан, ожидание %v", method, wait)
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
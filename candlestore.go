@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// candleRange — полуинтервал [From, To), за который в хранилище лежат все завершённые свечи
+type candleRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// storedQuote — цена в виде units/nano, как в API, чтобы не терять точность
+type storedQuote struct {
+	Units int64 `json:"u"`
+	Nano  int32 `json:"n"`
+}
+
+type storedCandle struct {
+	Time   time.Time   `json:"t"`
+	Open   storedQuote `json:"o"`
+	High   storedQuote `json:"h"`
+	Low    storedQuote `json:"l"`
+	Close  storedQuote `json:"c"`
+	Volume int64       `json:"v"`
+}
+
+// candleFile — содержимое файла хранилища одного инструмента и интервала
+type candleFile struct {
+	Covered []candleRange  `json:"covered"`
+	Candles []storedCandle `json:"candles"`
+}
+
+func toStoredQuote(q *pb.Quotation) storedQuote {
+	return storedQuote{Units: q.GetUnits(), Nano: q.GetNano()}
+}
+
+func (q storedQuote) quotation() *pb.Quotation {
+	return &pb.Quotation{Units: q.Units, Nano: q.Nano}
+}
+
+func toStoredCandle(c *pb.HistoricCandle) storedCandle {
+	return storedCandle{
+		Time: c.GetTime().AsTime().UTC(),
+		Open: toStoredQuote(c.GetOpen()), High: toStoredQuote(c.GetHigh()),
+		Low: toStoredQuote(c.GetLow()), Close: toStoredQuote(c.GetClose()),
+		Volume: c.GetVolume(),
+	}
+}
+
+func (c storedCandle) historic() *pb.HistoricCandle {
+	return &pb.HistoricCandle{
+		Time: timestamppb.New(c.Time),
+		Open: c.Open.quotation(), High: c.High.quotation(),
+		Low: c.Low.quotation(), Close: c.Close.quotation(),
+		Volume: c.Volume, IsComplete: true,
+	}
+}
+
+// candleDuration — длительность свечи интервала; для месяца берётся максимальная
+func candleDuration(interval pb.CandleInterval) time.Duration {
+	switch interval {
+	case pb.CandleInterval_CANDLE_INTERVAL_WEEK:
+		return 7 * 24 * time.Hour
+	case pb.CandleInterval_CANDLE_INTERVAL_MONTH:
+		return 31 * 24 * time.Hour
+	}
+	for _, fi := range fixedIntervals {
+		if fi.Interval == interval {
+			return fi.Duration
+		}
+	}
+	return 24 * time.Hour
+}
+
+// candleMonthlyFiles — минутные интервалы хранятся по файлу на месяц, остальные — по файлу на год,
+// чтобы дозагрузка не переписывала всю историю инструмента
+func candleMonthlyFiles(interval pb.CandleInterval) bool {
+	return candleDuration(interval) < time.Hour
+}
+
+// candlePartitions режет [from, to) по границам файлов хранилища (месяцам или годам UTC)
+func candlePartitions(interval pb.CandleInterval, from, to time.Time) []candleRange {
+	monthly := candleMonthlyFiles(interval)
+	var parts []candleRange
+	for cur := from.UTC(); cur.Before(to); {
+		next := time.Date(cur.Year()+1, 1, 1, 0, 0, 0, 0, time.UTC)
+		if monthly {
+			next = time.Date(cur.Year(), cur.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		}
+		end := next
+		if end.After(to) {
+			end = to.UTC()
+		}
+		parts = append(parts, candleRange{From: cur, To: end})
+		cur = next
+	}
+	return parts
+}
+
+// candleStorePath — файл хранилища с периодом, в который попадает t:
+// $TINKOFF_DATA_DIR/candles/<uid>/<interval>/<YYYY или YYYY-MM>.json. Ключ — UID, так как у опционов нет FIGI.
+func candleStorePath(ic *InvestClient, uid string, interval pb.CandleInterval, t time.Time) string {
+	name := strings.ToLower(strings.TrimPrefix(interval.String(), "CANDLE_INTERVAL_"))
+	period := t.UTC().Format("2006")
+	if candleMonthlyFiles(interval) {
+		period = t.UTC().Format("2006-01")
+	}
+	return filepath.Join(ic.dataDir, "candles", uid, name, period+".json")
+}
+
+// candleStoreLocks — по мьютексу на файл хранилища, чтобы параллельные запросы не затирали друг друга
+var candleStoreLocks = struct {
+	sync.Mutex
+	m map[string]*sync.Mutex
+}{m: make(map[string]*sync.Mutex)}
+
+func lockCandleStore(path string) func() {
+	candleStoreLocks.Lock()
+	mu, ok := candleStoreLocks.m[path]
+	if !ok {
+		mu = &sync.Mutex{}
+		candleStoreLocks.m[path] = mu
+	}
+	candleStoreLocks.Unlock()
+	mu.Lock()
+	return mu.Unlock
+}
+
+// missingRanges возвращает части [from, to), не покрытые отсортированными непересекающимися covered
+func missingRanges(covered []candleRange, from, to time.Time) []candleRange {
+	var gaps []candleRange
+	cur := from
+	for _, r := range covered {
+		if !r.To.After(cur) {
+			continue
+		}
+		if !r.From.Before(to) {
+			break
+		}
+		if r.From.After(cur) {
+			gaps = append(gaps, candleRange{From: cur, To: r.From})
+		}
+		cur = r.To
+		if !cur.Before(to) {
+			return gaps
+		}
+	}
+	if cur.Before(to) {
+		gaps = append(gaps, candleRange{From: cur, To: to})
+	}
+	return gaps
+}
+
+// mergeRanges сортирует и склеивает пересекающиеся и смежные интервалы
+func mergeRanges(ranges []candleRange) []candleRange {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].From.Before(ranges[j].From) })
+	var out []candleRange
+	for _, r := range ranges {
+		if n := len(out); n > 0 && !r.From.After(out[n-1].To) {
+			if r.To.After(out[n-1].To) {
+				out[n-1].To = r.To
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// loadCandles отдаёт свечи за [from, to) из локального хранилища ($TINKOFF_DATA_DIR/candles/<uid>/<interval>/),
+// догружая через fetchCandles только непокрытые участки. Период режется по файлам хранилища, и
+// переписываются только файлы, в которые добавились свечи. В хранилище попадают лишь завершённые свечи,
+// а покрытие обрывается на первой незавершённой свече и не заходит в последний ещё не истёкший интервал,
+// поэтому формирующаяся свеча всегда запрашивается заново. Число окон по всем файлам и участкам
+// подсчитывается заранее, чтобы прогресс шёл сквозной нумерацией.
+func loadCandles(ctx context.Context, ic *InvestClient, uid string, interval pb.CandleInterval, from, to time.Time, progress *windowProgress) ([]*pb.HistoricCandle, error) {
+	parts := candlePartitions(interval, from, to)
+	for _, part := range parts {
+		var file candleFile
+		if err := readJSONFile(candleStorePath(ic, uid, interval, part.From), &file); err != nil {
+			return nil, err
+		}
+		for _, gap := range missingRanges(file.Covered, part.From, part.To) {
+			progress.plan(len(candleWindows(gap.From, gap.To, candleWindow(interval))))
+		}
+	}
+	var out []*pb.HistoricCandle
+	for _, part := range parts {
+		candles, err := loadCandlePartition(ctx, ic, uid, interval, part, progress)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, candles...)
+	}
+	return out, nil
+}
+
+// loadCandlePartition — loadCandles в пределах одного файла хранилища
+func loadCandlePartition(ctx context.Context, ic *InvestClient, uid string, interval pb.CandleInterval, part candleRange, progress *windowProgress) ([]*pb.HistoricCandle, error) {
+	from, to := part.From, part.To
+	path := candleStorePath(ic, uid, interval, from)
+	unlock := lockCandleStore(path)
+	defer unlock()
+
+	var file candleFile
+	if err := readJSONFile(path, &file); err != nil {
+		return nil, err
+	}
+	byTime := make(map[int64]storedCandle, len(file.Candles))
+	for _, c := range file.Candles {
+		byTime[c.Time.Unix()] = c
+	}
+
+	// свечи, которые не кладутся в хранилище (незавершённые или за пределами покрытия)
+	var fresh []*pb.HistoricCandle
+	changed := false
+	safeLimit := time.Now().Add(-candleDuration(interval))
+	for _, gap := range missingRanges(file.Covered, from, to) {
+		candles, err := fetchCandles(ctx, ic, uid, interval, gap.From, gap.To, progress)
+		if err != nil {
+			return nil, err
+		}
+		safeEnd := gap.To
+		if safeEnd.After(safeLimit) {
+			safeEnd = safeLimit
+		}
+		for _, c := range candles {
+			if t := c.GetTime().AsTime(); !c.GetIsComplete() && t.Before(safeEnd) {
+				safeEnd = t
+			}
+		}
+		for _, c := range candles {
+			t := c.GetTime().AsTime()
+			if t.Before(gap.From) || !t.Before(gap.To) {
+				// свеча чужого файла хранилища
+				continue
+			}
+			if c.GetIsComplete() && t.Before(safeEnd) {
+				byTime[t.Unix()] = toStoredCandle(c)
+				changed = true
+			} else {
+				fresh = append(fresh, c)
+			}
+		}
+		if safeEnd.After(gap.From) {
+			file.Covered = append(file.Covered, candleRange{From: gap.From.UTC(), To: safeEnd.UTC()})
+			changed = true
+		}
+	}
+
+	if changed {
+		file.Covered = mergeRanges(file.Covered)
+		file.Candles = file.Candles[:0]
+		for _, c := range byTime {
+			file.Candles = append(file.Candles, c)
+		}
+		sort.Slice(file.Candles, func(i, j int) bool { return file.Candles[i].Time.Before(file.Candles[j].Time) })
+		if err := writeJSONFile(path, file); err != nil {
+			return nil, err
+		}
+	}
+
+	var out []*pb.HistoricCandle
+	for _, c := range file.Candles {
+		if !c.Time.Before(from) && c.Time.Before(to) {
+			out = append(out, c.historic())
+		}
+	}
+	for _, c := range fresh {
+		t := c.GetTime().AsTime()
+		if _, stored := byTime[t.Unix()]; !stored && !t.Before(from) && t.Before(to) {
+			out = append(out, c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].GetTime().AsTime().Before(out[j].GetTime().AsTime()) })
+	return out, nil
+}
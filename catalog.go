@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+)
+
+// catalogListTTL — как долго списки инструментов каталога считаются актуальными
+const catalogListTTL = time.Hour
+
+// catalogKinds — типы инструментов, по которым подсказываются тикеры (опционов слишком много для подсказок)
+var catalogKinds = []pb.InstrumentType{
+	pb.InstrumentType_INSTRUMENT_TYPE_SHARE,
+	pb.InstrumentType_INSTRUMENT_TYPE_BOND,
+	pb.InstrumentType_INSTRUMENT_TYPE_ETF,
+	pb.InstrumentType_INSTRUMENT_TYPE_FUTURES,
+	pb.InstrumentType_INSTRUMENT_TYPE_CURRENCY,
+}
+
+// instrumentCatalog — локальный каталог инструментов из типизированных списков (Shares, Bonds, ...):
+// список каждого типа загружается одним запросом и хранится в памяти. Отсюда же берётся валюта —
+// InstrumentShort из FindInstrument её не содержит
+type instrumentCatalog struct {
+	mu     sync.Mutex
+	loaded map[pb.InstrumentType]time.Time
+	rows   map[pb.InstrumentType][]SearchRow
+	byUid  map[pb.InstrumentType]map[string]int
+}
+
+// listLocked возвращает строки каталога типа kind, загружая список при устаревании
+func (c *instrumentCatalog) listLocked(ic *InvestClient, kind pb.InstrumentType) ([]SearchRow, error) {
+	if c.rows == nil {
+		c.loaded = make(map[pb.InstrumentType]time.Time)
+		c.rows = make(map[pb.InstrumentType][]SearchRow)
+		c.byUid = make(map[pb.InstrumentType]map[string]int)
+	}
+	if time.Since(c.loaded[kind]) >= catalogListTTL {
+		rows, err := loadCatalog(ic, kind)
+		if err != nil {
+			return nil, err
+		}
+		byUid := make(map[string]int, len(rows))
+		for i, r := range rows {
+			byUid[r.Uid] = i
+		}
+		c.rows[kind], c.byUid[kind], c.loaded[kind] = rows, byUid, time.Now()
+	}
+	return c.rows[kind], nil
+}
+
+// currency возвращает валюту инструмента в нижнем регистре; ok = false, если инструмента нет в списке
+func (c *instrumentCatalog) currency(ic *InvestClient, kind pb.InstrumentType, uid string) (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rows, err := c.listLocked(ic, kind)
+	if err != nil {
+		return "", false, err
+	}
+	i, ok := c.byUid[kind][uid]
+	if !ok {
+		return "", false, nil
+	}
+	return rows[i].Currency, true, nil
+}
+
+// complete подсказывает инструменты по началу тикера или слова названия. Первыми идут точные
+// совпадения тикера, затем доступные для торговли через API, затем совпадения тикера раньше названия.
+// Типы, список которых не загрузился, пропускаются; ошибка — только если не загрузился ни один.
+func (c *instrumentCatalog) complete(ic *InvestClient, prefix string, limit int) ([]SearchRow, error) {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	if prefix == "" {
+		return nil, nil
+	}
+	type match struct {
+		row   SearchRow
+		score int // 0 — тикер целиком, 1 — начало тикера, 2 — начало слова названия
+	}
+	var matches []match
+	var lastErr error
+	failed := 0
+	c.mu.Lock()
+	for _, kind := range catalogKinds {
+		rows, err := c.listLocked(ic, kind)
+		if err != nil {
+			log.Printf("Не удалось загрузить список инструментов %s: %v", kindName(kind), err)
+			lastErr = err
+			failed++
+			continue
+		}
+		for _, r := range rows {
+			ticker := strings.ToLower(r.Ticker)
+			switch {
+			case ticker == prefix:
+				matches = append(matches, match{r, 0})
+			case strings.HasPrefix(ticker, prefix):
+				matches = append(matches, match{r, 1})
+			case nameWordPrefix(strings.ToLower(r.Name), prefix):
+				matches = append(matches, match{r, 2})
+			}
+		}
+	}
+	c.mu.Unlock()
+	if failed == len(catalogKinds) {
+		return nil, lastErr
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if (a.score == 0) != (b.score == 0) {
+			return a.score == 0
+		}
+		if a.row.ApiTradeAvailable != b.row.ApiTradeAvailable {
+			return a.row.ApiTradeAvailable
+		}
+		if a.score != b.score {
+			return a.score < b.score
+		}
+		if len(a.row.Ticker) != len(b.row.Ticker) {
+			return len(a.row.Ticker) < len(b.row.Ticker)
+		}
+		return a.row.Ticker < b.row.Ticker
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	out := make([]SearchRow, len(matches))
+	for i, m := range matches {
+		out[i] = m.row
+	}
+	return out, nil
+}
+
+// nameWordPrefix — начинается ли с prefix название или одно из его слов
+func nameWordPrefix(name, prefix string) bool {
+	for _, w := range strings.FieldsFunc(name, func(r rune) bool { return r == ' ' || r == '-' || r == '"' || r == '«' }) {
+		if strings.HasPrefix(w, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type catalogInstrument interface {
+	GetFigi() string
+	GetUid() string
+	GetTicker() string
+	GetClassCode() string
+	GetName() string
+	GetCurrency() string
+	GetApiTradeAvailableFlag() bool
+}
+
+func catalogRows[T catalogInstrument](items []T, kind pb.InstrumentType) []SearchRow {
+	rows := make([]SearchRow, len(items))
+	for i, it := range items {
+		rows[i] = SearchRow{
+			Figi:              it.GetFigi(),
+			Uid:               it.GetUid(),
+			Ticker:            it.GetTicker(),
+			ClassCode:         it.GetClassCode(),
+			Name:              it.GetName(),
+			Kind:              kindName(kind),
+			ApiTradeAvailable: it.GetApiTradeAvailableFlag(),
+			Currency:          strings.ToLower(it.GetCurrency()),
+		}
+	}
+	return rows
+}
+
+// loadCatalog загружает список инструментов типа kind (всех статусов)
+func loadCatalog(ic *InvestClient, kind pb.InstrumentType) ([]SearchRow, error) {
+	instruments := ic.sdk.NewInstrumentsServiceClient()
+	status := pb.InstrumentStatus_INSTRUMENT_STATUS_ALL
+	switch kind {
+	case pb.InstrumentType_INSTRUMENT_TYPE_SHARE:
+		resp, err := instruments.Shares(status)
+		if err != nil {
+			return nil, err
+		}
+		return catalogRows(resp.GetInstruments(), kind), nil
+	case pb.InstrumentType_INSTRUMENT_TYPE_BOND:
+		resp, err := instruments.Bonds(status)
+		if err != nil {
+			return nil, err
+		}
+		return catalogRows(resp.GetInstruments(), kind), nil
+	case pb.InstrumentType_INSTRUMENT_TYPE_ETF:
+		resp, err := instruments.Etfs(status)
+		if err != nil {
+			return nil, err
+		}
+		return catalogRows(resp.GetInstruments(), kind), nil
+	case pb.InstrumentType_INSTRUMENT_TYPE_FUTURES:
+		resp, err := instruments.Futures(status)
+		if err != nil {
+			return nil, err
+		}
+		return catalogRows(resp.GetInstruments(), kind), nil
+	case pb.InstrumentType_INSTRUMENT_TYPE_OPTION:
+		resp, err := instruments.Options(status)
+		if err != nil {
+			return nil, err
+		}
+		// у опционов нет FIGI, поэтому они не подходят под catalogInstrument
+		rows := make([]SearchRow, 0, len(resp.GetInstruments()))
+		for _, it := range resp.GetInstruments() {
+			rows = append(rows, SearchRow{
+				Uid: it.GetUid(), Ticker: it.GetTicker(), ClassCode: it.GetClassCode(), Name: it.GetName(),
+				Kind: kindName(kind), ApiTradeAvailable: it.GetApiTradeAvailableFlag(), Currency: strings.ToLower(it.GetCurrency()),
+			})
+		}
+		return rows, nil
+	case pb.InstrumentType_INSTRUMENT_TYPE_CURRENCY:
+		resp, err := instruments.Currencies(status)
+		if err != nil {
+			return nil, err
+		}
+		return catalogRows(resp.GetInstruments(), kind), nil
+	}
+	return nil, fmt.Errorf("нет списка инструментов типа %s", kindName(kind))
+}
+
+func completeTickerHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	prefix, _ := req.RequireString("prefix")
+	limit := req.GetInt("limit", 10)
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	rows, err := ic.catalog.complete(ic, prefix, limit)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка загрузки каталога инструментов: %v", err)), nil
+	}
+	result := SearchOutput{Instruments: rows}
+	if len(rows) == 0 {
+		result.Instruments = []SearchRow{}
+		return mcp.NewToolResultStructured(result, "Подсказок нет"), nil
+	}
+	out := make([]string, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, fmt.Sprintf("%s [%s, %s], API: %s", r.String(), r.Kind, r.ClassCode, yesNo(r.ApiTradeAvailable)))
+	}
+	return mcp.NewToolResultStructured(result, formatList(out)), nil
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+)
+
+// exportFormats — поддерживаемые форматы выгрузки свечей и их MIME-типы
+var exportFormats = map[string]string{
+	"csv":     "text/csv",
+	"jsonl":   "application/jsonl",
+	"parquet": "application/vnd.apache.parquet",
+}
+
+// exportCandle — строка выгрузки: время в UTC, цены точными десятичными строками
+type exportCandle struct {
+	Time       string `json:"time"`
+	Open       string `json:"open"`
+	High       string `json:"high"`
+	Low        string `json:"low"`
+	Close      string `json:"close"`
+	Volume     int64  `json:"volume"`
+	IsComplete bool   `json:"is_complete"`
+}
+
+func toExportCandle(c *pb.HistoricCandle) exportCandle {
+	return exportCandle{
+		Time:       c.GetTime().AsTime().UTC().Format(time.RFC3339),
+		Open:       quotationToStr(c.GetOpen()),
+		High:       quotationToStr(c.GetHigh()),
+		Low:        quotationToStr(c.GetLow()),
+		Close:      quotationToStr(c.GetClose()),
+		Volume:     c.GetVolume(),
+		IsComplete: c.GetIsComplete(),
+	}
+}
+
+// encodeCandles сериализует свечи в выбранный формат
+func encodeCandles(w io.Writer, format string, candles []*pb.HistoricCandle) error {
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"time", "open", "high", "low", "close", "volume", "is_complete"})
+		for _, c := range candles {
+			e := toExportCandle(c)
+			_ = cw.Write([]string{e.Time, e.Open, e.High, e.Low, e.Close,
+				strconv.FormatInt(e.Volume, 10), strconv.FormatBool(e.IsComplete)})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "jsonl":
+		enc := json.NewEncoder(w)
+		for _, c := range candles {
+			if err := enc.Encode(toExportCandle(c)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "parquet":
+		// цены — DECIMAL(18,9) в INT64 (units·10⁹ + nano), время — TIMESTAMP(MILLIS, UTC)
+		cols := []*parquetColumn{
+			{Name: "time", Type: parquetInt64, Logical: logicalTimestampMillisUTC},
+			{Name: "open", Type: parquetInt64, Logical: logicalDecimal18x9},
+			{Name: "high", Type: parquetInt64, Logical: logicalDecimal18x9},
+			{Name: "low", Type: parquetInt64, Logical: logicalDecimal18x9},
+			{Name: "close", Type: parquetInt64, Logical: logicalDecimal18x9},
+			{Name: "volume", Type: parquetInt64},
+			{Name: "is_complete", Type: parquetBoolean},
+		}
+		for _, c := range candles {
+			cols[0].appendInt64(c.GetTime().AsTime().UnixMilli())
+			cols[1].appendInt64(quotationNanos(c.GetOpen()))
+			cols[2].appendInt64(quotationNanos(c.GetHigh()))
+			cols[3].appendInt64(quotationNanos(c.GetLow()))
+			cols[4].appendInt64(quotationNanos(c.GetClose()))
+			cols[5].appendInt64(c.GetVolume())
+			cols[6].appendBool(c.GetIsComplete())
+		}
+		return writeParquet(w, len(candles), cols)
+	default:
+		return fmt.Errorf("неизвестный формат %q. Допустимо: csv,jsonl,parquet", format)
+	}
+}
+
+func parseExportFormat(s string) (string, error) {
+	f := strings.ToLower(strings.TrimSpace(s))
+	switch f {
+	case "":
+		f = "csv"
+	case "json", "ndjson":
+		f = "jsonl"
+	}
+	if _, ok := exportFormats[f]; !ok {
+		return "", fmt.Errorf("неизвестный формат %q. Допустимо: csv,jsonl,parquet", s)
+	}
+	return f, nil
+}
+
+// exportPath — путь выгрузки из инструмента: только относительный и только внутри $TINKOFF_DATA_DIR/exports.
+// Произвольные пути принимает лишь флаг -out подкоманды export.
+func exportPath(ic *InvestClient, p string) (string, error) {
+	if filepath.IsAbs(p) || filepath.VolumeName(p) != "" {
+		return "", fmt.Errorf("path должен быть относительным: файл кладётся в $TINKOFF_DATA_DIR/exports")
+	}
+	clean := filepath.Clean(p)
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q выходит за пределы каталога выгрузок", p)
+	}
+	root, err := filepath.Abs(filepath.Join(ic.dataDir, "exports"))
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(root, clean)
+	if rel, err := filepath.Rel(root, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q выходит за пределы каталога выгрузок", p)
+	}
+	return path, nil
+}
+
+// writeExportInside записывает выгрузку инструмента внутрь root. Каталоги создаются по одному от
+// реального пути root, каждый компонент проверяется через Lstat: символическая ссылка или не-каталог
+// на пути отклоняются до того, как что-либо будет создано за их пределами
+func writeExportInside(root, path string, data []byte) error {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return err
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("файл %s выходит за пределы каталога выгрузок", path)
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	dir := realRoot
+	for _, name := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, name)
+		fi, err := os.Lstat(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			if err := os.Mkdir(dir, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+				return err
+			}
+			fi, err = os.Lstat(dir)
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 || !fi.IsDir() {
+			return fmt.Errorf("%s — не каталог или символическая ссылка, запись запрещена", dir)
+		}
+	}
+	file := filepath.Join(dir, parts[len(parts)-1])
+	if fi, err := os.Lstat(file); err == nil && (fi.Mode()&os.ModeSymlink != 0 || !fi.Mode().IsRegular()) {
+		return fmt.Errorf("файл %s — не обычный файл, запись запрещена", file)
+	}
+	return os.WriteFile(file, data, 0o644)
+}
+
+func writeExportFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// ExportOutput — структурированная сводка export_candles; сами данные — в ресурсе или файле
+type ExportOutput struct {
+	Instrument InstrumentJSON `json:"instrument"`
+	Interval   string         `json:"interval"`
+	From       string         `json:"from"`
+	To         string         `json:"to"`
+	Candles    int            `json:"candles"`
+	Format     string         `json:"format"`
+	MIMEType   string         `json:"mime_type"`
+	Bytes      int            `json:"bytes"`
+	Path       string         `json:"path,omitempty"`
+	URI        string         `json:"uri,omitempty"`
+}
+
+func exportCandlesHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	q, _ := req.RequireString("query")
+	fromStr, _ := req.RequireString("from")
+	toStr, _ := req.RequireString("to")
+	intervalStr, _ := req.RequireString("interval")
+	format, err := parseExportFormat(req.GetString("format", "csv"))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	cq, err := parseCandleQuery(ic, q, fromStr, toStr, intervalStr)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	candles, err := cq.load(ctx, ic, newWindowProgress(toolProgress(ctx, req)))
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка получения свечей: %v", err)), nil
+	}
+	var buf bytes.Buffer
+	if err := encodeCandles(&buf, format, candles); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка формирования выгрузки: %v", err)), nil
+	}
+
+	summary := fmt.Sprintf("Свечи %s (%s) FIGI %s, %s, %s → %s (UTC): %d шт., формат %s",
+		cq.Inst.Name, cq.Inst.Ticker, cq.Inst.Figi, strings.ToUpper(intervalStr),
+		cq.From.UTC().Format(time.RFC3339), cq.To.UTC().Format(time.RFC3339), len(candles), format)
+	result := ExportOutput{
+		Instrument: cq.Inst.JSON(), Interval: strings.ToLower(intervalStr), From: timeJSON(cq.From), To: timeJSON(cq.To),
+		Candles: len(candles), Format: format, MIMEType: exportFormats[format], Bytes: buf.Len(),
+	}
+	if p := strings.TrimSpace(req.GetString("path", "")); p != "" {
+		path, err := exportPath(ic, p)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if err := writeExportInside(filepath.Join(ic.dataDir, "exports"), path, buf.Bytes()); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Ошибка записи файла: %v", err)), nil
+		}
+		result.Path = path
+		return mcp.NewToolResultStructured(result, fmt.Sprintf("%s\nЗаписано в %s (%d байт)", summary, path, buf.Len())), nil
+	}
+
+	uri := fmt.Sprintf("tinvest://candles/%s/%s/%s/%s", cq.Inst.Uid, strings.ToLower(intervalStr),
+		cq.From.UTC().Format(time.RFC3339), cq.To.UTC().Format(time.RFC3339))
+	var contents mcp.ResourceContents
+	if format == "parquet" {
+		contents = mcp.BlobResourceContents{URI: uri, MIMEType: exportFormats[format], Blob: base64.StdEncoding.EncodeToString(buf.Bytes())}
+	} else {
+		contents = mcp.TextResourceContents{URI: uri, MIMEType: exportFormats[format], Text: buf.String()}
+	}
+	result.URI = uri
+	res := mcp.NewToolResultResource(summary, contents)
+	res.StructuredContent = result
+	return res, nil
+}
+
+// runExportCLI — подкоманда `export`: выгрузка свечей без запуска MCP-сервера
+func runExportCLI(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	query := fs.String("query", "", "Тикер/название или FIGI инструмента")
+	from := fs.String("from", "", "Начало периода (RFC3339)")
+	to := fs.String("to", "", "Конец периода (RFC3339)")
+	interval := fs.String("interval", "1d", "Интервал свечей, напр. 1m, 1h, 1d, 45m")
+	format := fs.String("format", "csv", "Формат: csv, jsonl или parquet")
+	out := fs.String("out", "-", "Файл результата; - — стандартный вывод")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *query == "" || *from == "" || *to == "" {
+		fs.Usage()
+		return fmt.Errorf("обязательны -query, -from и -to")
+	}
+	f, err := parseExportFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	ic, err := NewInvestClient()
+	if err != nil {
+		return err
+	}
+	defer ic.Close()
+	cq, err := parseCandleQuery(ic, *query, *from, *to, *interval)
+	if err != nil {
+		return err
+	}
+	candles, err := cq.load(context.Background(), ic, newWindowProgress(func(done, total int, _ string) {
+		fmt.Fprintf(os.Stderr, "\rзагружено окон %d из %d", done, total)
+		if done == total {
+			fmt.Fprintln(os.Stderr)
+		}
+	}))
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := encodeCandles(&buf, f, candles); err != nil {
+		return err
+	}
+	if *out == "-" {
+		_, err = os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	if err := writeExportFile(*out, buf.Bytes()); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Записано свечей: %d в %s\n", len(candles), *out)
+	return nil
+}
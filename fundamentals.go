@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// maxFundamentalsCompare — сколько инструментов сравнивается в одной таблице
+const maxFundamentalsCompare = 10
+
+// fundamentalMetrics — показатели GetAssetFundamentals в порядке вывода: поле ответа и подпись
+var fundamentalMetrics = []struct {
+	Field string
+	Label string
+}{
+	{"market_capitalization", "Капитализация"},
+	{"total_enterprise_value_mrq", "EV (MRQ)"},
+	{"pe_ratio_ttm", "P/E (TTM)"},
+	{"price_to_book_ttm", "P/B (TTM)"},
+	{"price_to_sales_ttm", "P/S (TTM)"},
+	{"ev_to_ebitda_mrq", "EV/EBITDA (MRQ)"},
+	{"dividend_yield_daily_ttm", "Див. доходность (TTM)"},
+	{"forward_annual_dividend_yield", "Форвардная див. доходность"},
+	{"revenue_ttm", "Выручка (TTM)"},
+	{"ebitda_ttm", "EBITDA (TTM)"},
+	{"net_income_ttm", "Чистая прибыль (TTM)"},
+	{"free_cash_flow_ttm", "FCF (TTM)"},
+	{"eps_ttm", "EPS (TTM)"},
+	{"net_margin_mrq", "Чистая маржа (MRQ)"},
+	{"roe", "ROE"},
+	{"roa", "ROA"},
+	{"roic", "ROIC"},
+	{"total_debt_mrq", "Долг (MRQ)"},
+	{"total_debt_to_equity_mrq", "Долг/капитал (MRQ)"},
+	{"net_debt_to_ebitda", "Чистый долг/EBITDA"},
+	{"free_float", "Free float"},
+	{"shares_outstanding", "Акций в обращении"},
+	{"beta", "Бета"},
+	{"high_price_last_52_weeks", "Максимум за 52 недели"},
+	{"low_price_last_52_weeks", "Минимум за 52 недели"},
+	{"average_daily_volume_last_10_days", "Ср. дневной объём за 10 дней"},
+}
+
+// FundamentalsJSON — показатели актива одного инструмента; ключи metrics — имена полей GetAssetFundamentals
+type FundamentalsJSON struct {
+	Instrument InstrumentJSON    `json:"instrument"`
+	AssetUid   string            `json:"asset_uid"`
+	Currency   string            `json:"currency,omitempty"`
+	Metrics    map[string]string `json:"metrics"`
+}
+
+// FundamentalsOutput — структурированный результат fundamentals
+type FundamentalsOutput struct {
+	Fundamentals []FundamentalsJSON `json:"fundamentals"`
+	NotFound     []string           `json:"not_found,omitempty"`
+}
+
+// formatFundamental — значение показателя; ноль в ответе API означает отсутствие данных
+func formatFundamental(v float64) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(roundTo(v, 4), 'f', -1, 64)
+}
+
+func fundamentalsHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	refs, failed := findInstrumentRefs(ic, stringListArg(req, "query"))
+	if len(refs) == 0 {
+		msg := "Не указаны инструменты (query)"
+		if len(failed) > 0 {
+			msg = strings.Join(failed, "\n")
+		}
+		return mcp.NewToolResultError(msg), nil
+	}
+	if len(refs) > maxFundamentalsCompare {
+		return mcp.NewToolResultError(fmt.Sprintf("За один вызов сравнивается не более %d инструментов", maxFundamentalsCompare)), nil
+	}
+
+	// связь инструмент → актив есть только в общем списке активов
+	all, err := ic.assets.list(ic)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка получения списка активов: %v", err)), nil
+	}
+	type row struct {
+		ref      *InstrumentRef
+		assetUid string
+	}
+	var rows []row
+	req2, err := apiExtMessage("GetAssetFundamentalsRequest")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	assets := req2.Mutable(req2.Descriptor().Fields().ByName("assets")).List()
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		a := assetByInstrument(all, ref.Uid)
+		if a == nil {
+			failed = append(failed, fmt.Sprintf("Актив для %s (%s) не найден", ref.Name, ref.Ticker))
+			continue
+		}
+		rows = append(rows, row{ref: ref, assetUid: a.GetUid()})
+		if !seen[a.GetUid()] {
+			seen[a.GetUid()] = true
+			assets.Append(protoreflect.ValueOfString(a.GetUid()))
+		}
+	}
+	if len(rows) == 0 {
+		return mcp.NewToolResultError(strings.Join(failed, "\n")), nil
+	}
+
+	resp, err := apiExtMessage("GetAssetFundamentalsResponse")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if _, err := ic.ext.invoke(ctx, methodGetAssetFundamentals, req2, resp); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка получения фундаментальных показателей: %v", err)), nil
+	}
+	stats := make(map[string]protoreflect.Message)
+	list := dynField(resp, "fundamentals").List()
+	for i := 0; i < list.Len(); i++ {
+		m := list.Get(i).Message()
+		stats[dynField(m, "asset_uid").String()] = m
+	}
+
+	result := FundamentalsOutput{Fundamentals: []FundamentalsJSON{}, NotFound: failed}
+	var columns []string
+	var found []protoreflect.Message
+	for _, r := range rows {
+		m, ok := stats[r.assetUid]
+		if !ok {
+			result.NotFound = append(result.NotFound, fmt.Sprintf("%s (%s): нет фундаментальных показателей", r.ref.Name, r.ref.Ticker))
+			continue
+		}
+		f := FundamentalsJSON{Instrument: r.ref.JSON(), AssetUid: r.assetUid,
+			Currency: strings.ToLower(dynField(m, "currency").String()), Metrics: map[string]string{}}
+		for _, fm := range fundamentalMetrics {
+			if v := formatFundamental(dynField(m, fm.Field).Float()); v != "" {
+				f.Metrics[fm.Field] = v
+			}
+		}
+		result.Fundamentals = append(result.Fundamentals, f)
+		columns = append(columns, fmt.Sprintf("%s (%s)", r.ref.Ticker, valueOrDash(strings.ToUpper(f.Currency))))
+		found = append(found, m)
+	}
+	if len(found) == 0 {
+		return mcp.NewToolResultStructured(result, "Фундаментальные показатели не найдены:\n"+formatList(result.NotFound)), nil
+	}
+
+	var text string
+	if len(found) == 1 {
+		f := result.Fundamentals[0]
+		var lines []string
+		for _, fm := range fundamentalMetrics {
+			if v, ok := f.Metrics[fm.Field]; ok {
+				lines = append(lines, fmt.Sprintf("%s: %s", fm.Label, v))
+			}
+		}
+		text = fmt.Sprintf("Фундаментальные показатели %s (%s), валюта %s, актив %s:\n%s",
+			rows[0].ref.Name, rows[0].ref.Ticker, valueOrDash(strings.ToUpper(f.Currency)), f.AssetUid, formatList(lines))
+	} else {
+		lines := []string{"Показатель | " + strings.Join(columns, " | ")}
+		for _, fm := range fundamentalMetrics {
+			cells := []string{fm.Label}
+			empty := true
+			for _, f := range result.Fundamentals {
+				v := valueOrDash(f.Metrics[fm.Field])
+				empty = empty && v == "-"
+				cells = append(cells, v)
+			}
+			if !empty {
+				lines = append(lines, strings.Join(cells, " | "))
+			}
+		}
+		text = "Сравнение фундаментальных показателей:\n" + strings.Join(lines, "\n") + "\n"
+	}
+	if len(result.NotFound) > 0 {
+		text += "Не найдены:\n" + formatList(result.NotFound)
+	}
+	return mcp.NewToolResultStructured(result, text), nil
+}
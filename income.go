@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/shopspring/decimal"
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+)
+
+// DividendJSON — дивидендное событие
+type DividendJSON struct {
+	DividendNet  *MoneyJSON `json:"dividend_net"`
+	LastBuyDate  string     `json:"last_buy_date,omitempty"`
+	RecordDate   string     `json:"record_date,omitempty"`
+	PaymentDate  string     `json:"payment_date,omitempty"`
+	DeclaredDate string     `json:"declared_date,omitempty"`
+	YieldPct     string     `json:"yield_pct"`
+	Type         string     `json:"dividend_type,omitempty"`
+	Regularity   string     `json:"regularity,omitempty"`
+}
+
+// DividendsOutput — структурированный результат dividends
+type DividendsOutput struct {
+	Instrument InstrumentJSON `json:"instrument"`
+	From       string         `json:"from"`
+	To         string         `json:"to"`
+	Dividends  []DividendJSON `json:"dividends"`
+}
+
+// IncomeEventJSON — ожидаемая выплата по позиции; суммы до налогов, точными десятичными строками
+type IncomeEventJSON struct {
+	Date     string `json:"date"`
+	Figi     string `json:"figi"`
+	Kind     string `json:"kind"`
+	Currency string `json:"currency"`
+	PerUnit  string `json:"per_unit"`
+	Quantity string `json:"quantity"`
+	Amount   string `json:"amount"`
+}
+
+// MonthIncomeJSON — итоги месяца по валютам
+type MonthIncomeJSON struct {
+	Month  string      `json:"month"`
+	Totals []MoneyJSON `json:"totals"`
+}
+
+// IncomeCalendarOutput — структурированный результат portfolio_income_calendar
+type IncomeCalendarOutput struct {
+	From     string            `json:"from"`
+	To       string            `json:"to"`
+	Events   []IncomeEventJSON `json:"events"`
+	Months   []MonthIncomeJSON `json:"months"`
+	Totals   []MoneyJSON       `json:"totals"`
+	Warnings []string          `json:"warnings,omitempty"`
+}
+
+func dividendsHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	q, _ := req.RequireString("query")
+	now := time.Now().UTC()
+	from, to := now.AddDate(-1, 0, 0), now.AddDate(1, 0, 0)
+	fromArg, err := parseDateArg(req, "from")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if !fromArg.IsZero() {
+		from = fromArg
+	}
+	toArg, err := parseDateArg(req, "to")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if !toArg.IsZero() {
+		to = toArg
+	}
+	if !to.After(from) {
+		return mcp.NewToolResultError("Параметр 'to' должен быть позже, чем 'from'"), nil
+	}
+
+	inst, err := findInstrumentRef(ic, q)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	instruments := ic.sdk.NewInstrumentsServiceClient()
+	resp, err := instruments.GetDividents(inst.Figi, from, to)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка получения дивидендов: %v", err)), nil
+	}
+	divs := resp.GetDividends()
+	result := DividendsOutput{Instrument: inst.JSON(), From: from.Format("2006-01-02"), To: to.Format("2006-01-02"), Dividends: []DividendJSON{}}
+	if len(divs) == 0 {
+		return mcp.NewToolResultStructured(result, fmt.Sprintf("Дивиденды по %s (%s) за период %s → %s не найдены",
+			inst.Name, inst.Ticker, from.Format("2006-01-02"), to.Format("2006-01-02"))), nil
+	}
+	sort.Slice(divs, func(i, j int) bool {
+		return divs[i].GetRecordDate().AsTime().Before(divs[j].GetRecordDate().AsTime())
+	})
+	var lines []string
+	for _, d := range divs {
+		result.Dividends = append(result.Dividends, DividendJSON{
+			DividendNet: moneyJSON(d.GetDividendNet()), LastBuyDate: dateJSON(d.GetLastBuyDate()),
+			RecordDate: dateJSON(d.GetRecordDate()), PaymentDate: dateJSON(d.GetPaymentDate()),
+			DeclaredDate: dateJSON(d.GetDeclaredDate()), YieldPct: quotationJSON(d.GetYieldValue()),
+			Type: d.GetDividendType(), Regularity: d.GetRegularity(),
+		})
+		lines = append(lines, fmt.Sprintf("%s на акцию, последний день покупки %s, реестр %s, выплата %s, доходность %s%%, тип: %s, регулярность: %s",
+			moneyToStr(d.GetDividendNet()), formatDate(d.GetLastBuyDate()), formatDate(d.GetRecordDate()),
+			formatDate(d.GetPaymentDate()), quotationToStr(d.GetYieldValue()),
+			valueOrDash(d.GetDividendType()), valueOrDash(d.GetRegularity())))
+	}
+	header := fmt.Sprintf("Дивиденды %s (%s), FIGI %s, %s → %s:", inst.Name, inst.Ticker, inst.Figi,
+		from.Format("2006-01-02"), to.Format("2006-01-02"))
+	return mcp.NewToolResultStructured(result, header+"\n"+formatList(lines)), nil
+}
+
+// incomeEvent — ожидаемая выплата по позиции портфеля
+type incomeEvent struct {
+	Date     time.Time
+	Figi     string
+	Kind     string // dividend | coupon
+	Currency string
+	PerUnit  decimal.Decimal
+	Quantity decimal.Decimal
+}
+
+func (e incomeEvent) Amount() decimal.Decimal { return e.PerUnit.Mul(e.Quantity) }
+
+// moneyDecimal — денежная сумма без потери точности
+func moneyDecimal(m *pb.MoneyValue) decimal.Decimal {
+	return quotationDecimal(&pb.Quotation{Units: m.GetUnits(), Nano: m.GetNano()})
+}
+
+// dividendPaymentLag — запас, на который окно GetDividends сдвигается назад: API отбирает дивиденды
+// по дате реестра, а выплата приходит до 25 рабочих дней после неё (с запасом — 60 дней)
+const dividendPaymentLag = 60 * 24 * time.Hour
+
+// projectIncome собирает будущие дивиденды (GetDividends) и купоны (GetBondCoupons) по позициям портфеля.
+// Дата дивиденда — дата выплаты, а если она ещё не известна — дата фиксации реестра; дивиденды запрашиваются
+// с запасом dividendPaymentLag назад, чтобы не потерять выплаты по реестру, закрытому до начала периода.
+func projectIncome(ic *InvestClient, positions []*pb.PortfolioPosition, from, to time.Time) ([]incomeEvent, []string) {
+	instruments := ic.sdk.NewInstrumentsServiceClient()
+	var events []incomeEvent
+	var warnings []string
+	for _, pos := range positions {
+		qty := quotationDecimal(pos.GetQuantity())
+		if qty.Sign() <= 0 {
+			continue
+		}
+		switch pos.GetInstrumentType() {
+		case "share", "etf":
+			resp, err := instruments.GetDividents(pos.GetFigi(), from.Add(-dividendPaymentLag), to)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("FIGI %s: ошибка получения дивидендов: %v", pos.GetFigi(), err))
+				continue
+			}
+			for _, d := range resp.GetDividends() {
+				date := d.GetPaymentDate().AsTime()
+				if d.GetPaymentDate() == nil || d.GetPaymentDate().GetSeconds() == 0 {
+					date = d.GetRecordDate().AsTime()
+				}
+				if date.Before(from) || date.After(to) {
+					continue
+				}
+				events = append(events, incomeEvent{
+					Date: date, Figi: pos.GetFigi(), Kind: "dividend",
+					Currency: strings.ToUpper(d.GetDividendNet().GetCurrency()),
+					PerUnit:  moneyDecimal(d.GetDividendNet()), Quantity: qty,
+				})
+			}
+		case "bond":
+			resp, err := instruments.GetBondCoupons(pos.GetFigi(), from, to)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("FIGI %s: ошибка получения купонов: %v", pos.GetFigi(), err))
+				continue
+			}
+			for _, c := range resp.GetEvents() {
+				date := c.GetCouponDate().AsTime()
+				if date.Before(from) || date.After(to) {
+					continue
+				}
+				amount := moneyDecimal(c.GetPayOneBond())
+				if amount.IsZero() {
+					warnings = append(warnings, fmt.Sprintf("FIGI %s: размер купона на %s не объявлен", pos.GetFigi(), date.Format("2006-01-02")))
+					continue
+				}
+				events = append(events, incomeEvent{
+					Date: date, Figi: pos.GetFigi(), Kind: "coupon",
+					Currency: strings.ToUpper(c.GetPayOneBond().GetCurrency()),
+					PerUnit:  amount, Quantity: qty,
+				})
+			}
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Date.Before(events[j].Date) })
+	return events, warnings
+}
+
+func portfolioIncomeCalendarHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	months := req.GetInt("months", 12)
+	if months < 1 {
+		months = 1
+	}
+	if months > 36 {
+		months = 36
+	}
+	pf, err := loadPortfolio(ic)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка получения портфеля: %v", err)), nil
+	}
+	now := time.Now().UTC()
+	to := now.AddDate(0, months, 0)
+	events, warnings := projectIncome(ic, pf.GetPositions(), now, to)
+	result := IncomeCalendarOutput{
+		From: now.Format("2006-01-02"), To: to.Format("2006-01-02"),
+		Events: []IncomeEventJSON{}, Months: []MonthIncomeJSON{}, Totals: []MoneyJSON{}, Warnings: warnings,
+	}
+
+	if len(events) == 0 {
+		text := fmt.Sprintf("Ожидаемых выплат на ближайшие %d мес. не найдено", months)
+		if len(warnings) > 0 {
+			text += "\nПредупреждения:\n" + formatList(warnings)
+		}
+		return mcp.NewToolResultStructured(result, text), nil
+	}
+
+	var lines []string
+	totals := make(map[string]decimal.Decimal)
+	month := ""
+	monthTotals := make(map[string]decimal.Decimal)
+	flush := func() {
+		if month == "" {
+			return
+		}
+		lines = append(lines, fmt.Sprintf("Итого за %s: %s", month, formatCurrencyTotals(monthTotals)))
+		result.Months = append(result.Months, MonthIncomeJSON{Month: month, Totals: currencyTotalsJSON(monthTotals)})
+		monthTotals = make(map[string]decimal.Decimal)
+	}
+	for _, e := range events {
+		if m := e.Date.Format("2006-01"); m != month {
+			flush()
+			month = m
+			lines = append(lines, month+":")
+		}
+		kind := "дивиденд"
+		if e.Kind == "coupon" {
+			kind = "купон"
+		}
+		lines = append(lines, fmt.Sprintf("  %s %s FIGI %s: %s %s × %s = %s %s",
+			e.Date.Format("2006-01-02"), kind, e.Figi, e.PerUnit, e.Currency,
+			e.Quantity, e.Amount(), e.Currency))
+		result.Events = append(result.Events, IncomeEventJSON{
+			Date: e.Date.Format("2006-01-02"), Figi: e.Figi, Kind: e.Kind, Currency: strings.ToLower(e.Currency),
+			PerUnit: e.PerUnit.String(), Quantity: e.Quantity.String(), Amount: e.Amount().String(),
+		})
+		monthTotals[e.Currency] = monthTotals[e.Currency].Add(e.Amount())
+		totals[e.Currency] = totals[e.Currency].Add(e.Amount())
+	}
+	flush()
+	result.Totals = currencyTotalsJSON(totals)
+	lines = append(lines, fmt.Sprintf("Всего за %d мес.: %s", months, formatCurrencyTotals(totals)))
+	if len(warnings) > 0 {
+		lines = append(lines, "Предупреждения:")
+		for _, w := range warnings {
+			lines = append(lines, "  "+w)
+		}
+	}
+	return mcp.NewToolResultStructured(result, fmt.Sprintf("Календарь доходов портфеля (до налогов) %s → %s:\n%s",
+		now.Format("2006-01-02"), to.Format("2006-01-02"), strings.Join(lines, "\n"))), nil
+}
+
+// formatCurrencyTotals печатает суммы по валютам в стабильном порядке
+func formatCurrencyTotals(totals map[string]decimal.Decimal) string {
+	keys := make([]string, 0, len(totals))
+	for k := range totals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s %s", totals[k], k))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// currencyTotalsJSON — суммы по валютам в том же порядке, что и formatCurrencyTotals
+func currencyTotalsJSON(totals map[string]decimal.Decimal) []MoneyJSON {
+	keys := make([]string, 0, len(totals))
+	for k := range totals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]MoneyJSON, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, MoneyJSON{Value: totals[k].String(), Currency: strings.ToLower(k)})
+	}
+	return out
+}
@@ -0,0 +1,674 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/shopspring/decimal"
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// indicatorScale — число знаков после запятой для промежуточных вычислений: без округления
+// рекуррентные EMA/RSI/ATR разрастаются по разрядам с каждой свечой
+const indicatorScale = 12
+
+// indicatorSeries — значения индикатора, выровненные по свечам; до прогрева значения невалидны
+type indicatorSeries struct {
+	Name   string
+	Values []decimal.NullDecimal
+}
+
+// indicatorSpec — индикатор и его параметры, напр. rsi:14, macd:12:26:9, bb:20:2
+type indicatorSpec struct {
+	Kind   string
+	Params []int
+}
+
+// defaultIndicatorParams — параметры по умолчанию и число параметров каждого индикатора
+var defaultIndicatorParams = map[string][]int{
+	"sma":  {20},
+	"ema":  {20},
+	"rsi":  {14},
+	"macd": {12, 26, 9},
+	"bb":   {20, 2},
+	"atr":  {14},
+	"vwap": {},
+}
+
+var defaultIndicators = []string{"sma", "ema", "rsi", "macd", "bb", "atr", "vwap"}
+
+func parseIndicatorSpec(s string) (indicatorSpec, error) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(s)), ":")
+	kind := parts[0]
+	if kind == "bollinger" {
+		kind = "bb"
+	}
+	defaults, ok := defaultIndicatorParams[kind]
+	if !ok {
+		return indicatorSpec{}, fmt.Errorf("неизвестный индикатор %q. Допустимо: sma,ema,rsi,macd,bb,atr,vwap", s)
+	}
+	if len(parts)-1 > len(defaults) {
+		return indicatorSpec{}, fmt.Errorf("у индикатора %s не более %d параметров", kind, len(defaults))
+	}
+	params := append([]int(nil), defaults...)
+	for i, p := range parts[1:] {
+		v, err := strconv.Atoi(p)
+		if err != nil || v < 1 || v > 500 {
+			return indicatorSpec{}, fmt.Errorf("некорректный параметр %q индикатора %s (целое 1-500)", p, kind)
+		}
+		params[i] = v
+	}
+	if kind == "macd" && params[0] >= params[1] {
+		return indicatorSpec{}, fmt.Errorf("у MACD быстрый период должен быть меньше медленного")
+	}
+	return indicatorSpec{Kind: kind, Params: params}, nil
+}
+
+// warmup — сколько свечей нужно, чтобы значения индикатора устоялись
+func (s indicatorSpec) warmup() int {
+	switch s.Kind {
+	case "ema", "rsi", "atr":
+		return s.Params[0] * 3
+	case "macd":
+		return s.Params[1]*3 + s.Params[2]
+	case "vwap":
+		return 1
+	default:
+		return s.Params[0]
+	}
+}
+
+func (s indicatorSpec) compute(candles []*pb.HistoricCandle, intraday bool) []indicatorSeries {
+	closes := make([]decimal.NullDecimal, len(candles))
+	for i, c := range candles {
+		closes[i] = valid(quotationDecimal(c.GetClose()))
+	}
+	p := s.Params
+	switch s.Kind {
+	case "sma":
+		return []indicatorSeries{{fmt.Sprintf("SMA(%d)", p[0]), smaSeries(closes, p[0])}}
+	case "ema":
+		return []indicatorSeries{{fmt.Sprintf("EMA(%d)", p[0]), emaSeries(closes, p[0])}}
+	case "rsi":
+		return []indicatorSeries{{fmt.Sprintf("RSI(%d)", p[0]), rsiSeries(closes, p[0])}}
+	case "macd":
+		fast, slow := emaSeries(closes, p[0]), emaSeries(closes, p[1])
+		line := make([]decimal.NullDecimal, len(closes))
+		for i := range closes {
+			if fast[i].Valid && slow[i].Valid {
+				line[i] = valid(fast[i].Decimal.Sub(slow[i].Decimal))
+			}
+		}
+		signal := emaSeries(line, p[2])
+		hist := make([]decimal.NullDecimal, len(closes))
+		for i := range closes {
+			if line[i].Valid && signal[i].Valid {
+				hist[i] = valid(line[i].Decimal.Sub(signal[i].Decimal))
+			}
+		}
+		name := fmt.Sprintf("MACD(%d,%d,%d)", p[0], p[1], p[2])
+		return []indicatorSeries{{name, line}, {name + " signal", signal}, {name + " hist", hist}}
+	case "bb":
+		mid, upper, lower := bollingerSeries(closes, p[0], decimal.NewFromInt(int64(p[1])))
+		name := fmt.Sprintf("BB(%d,%d)", p[0], p[1])
+		return []indicatorSeries{{name + " upper", upper}, {name + " middle", mid}, {name + " lower", lower}}
+	case "atr":
+		return []indicatorSeries{{fmt.Sprintf("ATR(%d)", p[0]), atrSeries(candles, p[0])}}
+	case "vwap":
+		return []indicatorSeries{{"VWAP", vwapSeries(candles, intraday)}}
+	}
+	return nil
+}
+
+func valid(d decimal.Decimal) decimal.NullDecimal {
+	return decimal.NullDecimal{Decimal: d, Valid: true}
+}
+
+func quotationDecimal(q *pb.Quotation) decimal.Decimal {
+	return decimal.New(quotationNanos(q), -9)
+}
+
+// smaSeries — простое скользящее среднее по валидным значениям
+func smaSeries(xs []decimal.NullDecimal, n int) []decimal.NullDecimal {
+	out := make([]decimal.NullDecimal, len(xs))
+	sum := decimal.Zero
+	count := 0
+	for i, x := range xs {
+		if !x.Valid {
+			continue
+		}
+		sum = sum.Add(x.Decimal)
+		count++
+		if count > n {
+			sum = sum.Sub(xs[i-n].Decimal)
+		}
+		if count >= n {
+			out[i] = valid(sum.DivRound(decimal.NewFromInt(int64(n)), indicatorScale))
+		}
+	}
+	return out
+}
+
+// emaSeries — экспоненциальное среднее с α = 2/(n+1), затравка — SMA первых n значений.
+// Невалидные значения в начале ряда (напр. линия MACD до прогрева) пропускаются.
+func emaSeries(xs []decimal.NullDecimal, n int) []decimal.NullDecimal {
+	alpha := decimal.NewFromInt(2).DivRound(decimal.NewFromInt(int64(n+1)), indicatorScale)
+	return smoothedSeries(xs, n, alpha)
+}
+
+// wilderSeries — сглаживание Уайлдера (α = 1/n), используется в RSI и ATR
+func wilderSeries(xs []decimal.NullDecimal, n int) []decimal.NullDecimal {
+	alpha := decimal.NewFromInt(1).DivRound(decimal.NewFromInt(int64(n)), indicatorScale)
+	return smoothedSeries(xs, n, alpha)
+}
+
+func smoothedSeries(xs []decimal.NullDecimal, n int, alpha decimal.Decimal) []decimal.NullDecimal {
+	out := make([]decimal.NullDecimal, len(xs))
+	seed := smaSeries(xs, n)
+	var prev decimal.NullDecimal
+	for i, x := range xs {
+		if !x.Valid {
+			continue
+		}
+		if !prev.Valid {
+			if seed[i].Valid {
+				prev = seed[i]
+				out[i] = prev
+			}
+			continue
+		}
+		prev = valid(prev.Decimal.Add(alpha.Mul(x.Decimal.Sub(prev.Decimal))).Round(indicatorScale))
+		out[i] = prev
+	}
+	return out
+}
+
+// rsiSeries — RSI Уайлдера: 100 − 100/(1 + средний рост / среднее падение)
+func rsiSeries(closes []decimal.NullDecimal, n int) []decimal.NullDecimal {
+	gains := make([]decimal.NullDecimal, len(closes))
+	losses := make([]decimal.NullDecimal, len(closes))
+	for i := 1; i < len(closes); i++ {
+		d := closes[i].Decimal.Sub(closes[i-1].Decimal)
+		gains[i] = valid(decimal.Max(d, decimal.Zero))
+		losses[i] = valid(decimal.Max(d.Neg(), decimal.Zero))
+	}
+	avgGain, avgLoss := wilderSeries(gains, n), wilderSeries(losses, n)
+	hundred := decimal.NewFromInt(100)
+	out := make([]decimal.NullDecimal, len(closes))
+	for i := range closes {
+		if !avgGain[i].Valid || !avgLoss[i].Valid {
+			continue
+		}
+		if avgLoss[i].Decimal.IsZero() {
+			out[i] = valid(hundred)
+			continue
+		}
+		rs := avgGain[i].Decimal.DivRound(avgLoss[i].Decimal, indicatorScale)
+		out[i] = valid(hundred.Sub(hundred.DivRound(rs.Add(decimal.NewFromInt(1)), indicatorScale)))
+	}
+	return out
+}
+
+// bollingerSeries — SMA(n) ± k стандартных отклонений (по генеральной совокупности)
+func bollingerSeries(closes []decimal.NullDecimal, n int, k decimal.Decimal) (mid, upper, lower []decimal.NullDecimal) {
+	mid = smaSeries(closes, n)
+	upper = make([]decimal.NullDecimal, len(closes))
+	lower = make([]decimal.NullDecimal, len(closes))
+	for i := range closes {
+		if !mid[i].Valid {
+			continue
+		}
+		variance := decimal.Zero
+		for j := i - n + 1; j <= i; j++ {
+			d := closes[j].Decimal.Sub(mid[i].Decimal)
+			variance = variance.Add(d.Mul(d))
+		}
+		std := decimalSqrt(variance.DivRound(decimal.NewFromInt(int64(n)), indicatorScale))
+		upper[i] = valid(mid[i].Decimal.Add(k.Mul(std)))
+		lower[i] = valid(mid[i].Decimal.Sub(k.Mul(std)))
+	}
+	return mid, upper, lower
+}
+
+// decimalSqrt — квадратный корень методом Ньютона с точностью indicatorScale знаков
+func decimalSqrt(x decimal.Decimal) decimal.Decimal {
+	if x.Sign() <= 0 {
+		return decimal.Zero
+	}
+	f, _ := x.Float64()
+	z := decimal.NewFromFloat(math.Sqrt(f))
+	two := decimal.NewFromInt(2)
+	for i := 0; i < 50; i++ {
+		next := z.Add(x.DivRound(z, indicatorScale)).DivRound(two, indicatorScale)
+		if next.Equal(z) {
+			break
+		}
+		z = next
+	}
+	return z
+}
+
+// atrSeries — средний истинный диапазон: TR = max(H−L, |H−Cпред|, |L−Cпред|), сглаживание Уайлдера
+func atrSeries(candles []*pb.HistoricCandle, n int) []decimal.NullDecimal {
+	tr := make([]decimal.NullDecimal, len(candles))
+	for i, c := range candles {
+		h, l := quotationDecimal(c.GetHigh()), quotationDecimal(c.GetLow())
+		r := h.Sub(l)
+		if i > 0 {
+			pc := quotationDecimal(candles[i-1].GetClose())
+			r = decimal.Max(r, h.Sub(pc).Abs(), l.Sub(pc).Abs())
+		}
+		tr[i] = valid(r)
+	}
+	return wilderSeries(tr, n)
+}
+
+// vwapSeries — накопительная средневзвешенная по объёму типичная цена (H+L+C)/3.
+// Для внутридневных свечей накопление сбрасывается в начале каждых суток UTC, иначе идёт за весь период.
+func vwapSeries(candles []*pb.HistoricCandle, intraday bool) []decimal.NullDecimal {
+	out := make([]decimal.NullDecimal, len(candles))
+	three := decimal.NewFromInt(3)
+	pv, vol := decimal.Zero, decimal.Zero
+	day := ""
+	for i, c := range candles {
+		if d := c.GetTime().AsTime().UTC().Format("2006-01-02"); intraday && d != day {
+			day = d
+			pv, vol = decimal.Zero, decimal.Zero
+		}
+		typical := quotationDecimal(c.GetHigh()).Add(quotationDecimal(c.GetLow())).Add(quotationDecimal(c.GetClose())).DivRound(three, indicatorScale)
+		v := decimal.NewFromInt(c.GetVolume())
+		pv = pv.Add(typical.Mul(v))
+		vol = vol.Add(v)
+		if !vol.IsZero() {
+			out[i] = valid(pv.DivRound(vol, indicatorScale))
+		}
+	}
+	return out
+}
+
+// formatIndicator — значение индикатора с округлением до 6 знаков
+func formatIndicator(v decimal.NullDecimal) string {
+	if !v.Valid {
+		return "-"
+	}
+	return v.Decimal.Round(6).String()
+}
+
+// IndicatorRowJSON — точка ряда: время, close (только для локального расчёта) и значения индикаторов;
+// ещё не рассчитанные опускаются
+type IndicatorRowJSON struct {
+	Time   string            `json:"time"`
+	Close  string            `json:"close,omitempty"`
+	Values map[string]string `json:"values"`
+}
+
+// IndicatorsOutput — структурированный результат indicators
+type IndicatorsOutput struct {
+	Instrument     InstrumentJSON     `json:"instrument"`
+	Interval       string             `json:"interval"`
+	Source         string             `json:"source"`
+	Candles        int                `json:"candles"`
+	LastTime       string             `json:"last_time"`
+	LastClose      string             `json:"last_close,omitempty"`
+	LastComplete   bool               `json:"last_complete"`
+	Values         map[string]string  `json:"values"`
+	WarmupShortage bool               `json:"warmup_shortage,omitempty"`
+	Series         []IndicatorRowJSON `json:"series"`
+}
+
+// putIndicator записывает значение индикатора с округлением до 6 знаков, если оно рассчитано
+func putIndicator(values map[string]string, name string, v decimal.NullDecimal) {
+	if v.Valid {
+		values[name] = v.Decimal.Round(6).String()
+	}
+}
+
+func indicatorsHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	q, _ := req.RequireString("query")
+	intervalStr := req.GetString("interval", "1d")
+	names := stringListArg(req, "indicators")
+	if len(names) == 0 {
+		names = defaultIndicators
+	}
+	var specs []indicatorSpec
+	warmup := 0
+	for _, n := range names {
+		s, err := parseIndicatorSpec(n)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		specs = append(specs, s)
+		if w := s.warmup(); w > warmup {
+			warmup = w
+		}
+	}
+	series := req.GetInt("series", 0)
+	if series < 0 {
+		series = 0
+	}
+	if series > 500 {
+		series = 500
+	}
+
+	spec, err := parseCandleSpec(intervalStr)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	to := time.Now().UTC()
+	if toArg := strings.TrimSpace(req.GetString("to", "")); toArg != "" {
+		if to, err = time.Parse(time.RFC3339, toArg); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Некорректный формат to: %v", err)), nil
+		}
+	}
+	inst, err := findInstrumentRef(ic, q)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	switch source := strings.ToLower(strings.TrimSpace(req.GetString("source", "local"))); source {
+	case "local":
+	case "api":
+		return techAnalysisIndicators(ctx, ic, inst, spec, intervalStr, specs, series, to)
+	default:
+		return mcp.NewToolResultError(fmt.Sprintf("неизвестный source %q. Допустимо: local, api", source)), nil
+	}
+	candles, err := loadLookback(ctx, ic, inst, spec, warmup+series+1, to, toolProgress(ctx, req))
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка получения свечей: %v", err)), nil
+	}
+	result := IndicatorsOutput{
+		Instrument: inst.JSON(), Interval: strings.ToLower(intervalStr), Source: "local",
+		Values: map[string]string{}, Series: []IndicatorRowJSON{},
+	}
+	if len(candles) == 0 {
+		return mcp.NewToolResultStructured(result, "Свечи не найдены за период расчёта"), nil
+	}
+
+	intraday := spec.step() < 24*time.Hour
+	var all []indicatorSeries
+	for _, s := range specs {
+		all = append(all, s.compute(candles, intraday)...)
+	}
+
+	last := candles[len(candles)-1]
+	lines := []string{fmt.Sprintf("Индикаторы %s (%s) FIGI %s, интервал %s, свечей в расчёте: %d, последняя: %s (close %s%s)",
+		inst.Name, inst.Ticker, inst.Figi, strings.ToUpper(intervalStr), len(candles),
+		last.GetTime().AsTime().UTC().Format(time.RFC3339), quotationToStr(last.GetClose()), formingNote(last))}
+	result.Candles, result.LastTime = len(candles), timestampJSON(last.GetTime())
+	result.LastClose, result.LastComplete = quotationJSON(last.GetClose()), last.GetIsComplete()
+	for _, s := range all {
+		lines = append(lines, fmt.Sprintf("%s: %s", s.Name, formatIndicator(s.Values[len(s.Values)-1])))
+		putIndicator(result.Values, s.Name, s.Values[len(s.Values)-1])
+	}
+	if len(candles) < warmup {
+		result.WarmupShortage = true
+		lines = append(lines, fmt.Sprintf("Внимание: свечей меньше, чем нужно для прогрева (%d) — значения могут быть неточными", warmup))
+	}
+	if series > 0 {
+		start := len(candles) - series
+		if start < 0 {
+			start = 0
+		}
+		header := []string{"time", "close"}
+		for _, s := range all {
+			header = append(header, s.Name)
+		}
+		lines = append(lines, "", "Ряд: "+strings.Join(header, " | "))
+		for i := start; i < len(candles); i++ {
+			row := []string{candles[i].GetTime().AsTime().UTC().Format(time.RFC3339), quotationToStr(candles[i].GetClose())}
+			point := IndicatorRowJSON{Time: timestampJSON(candles[i].GetTime()), Close: quotationJSON(candles[i].GetClose()), Values: map[string]string{}}
+			for _, s := range all {
+				row = append(row, formatIndicator(s.Values[i]))
+				putIndicator(point.Values, s.Name, s.Values[i])
+			}
+			lines = append(lines, strings.Join(row, " | "))
+			result.Series = append(result.Series, point)
+		}
+	}
+	return mcp.NewToolResultStructured(result, strings.Join(lines, "\n")), nil
+}
+
+// techAnalysisTypes — индикаторы, которые считает GetTechAnalysis, и их IndicatorType
+var techAnalysisTypes = map[string]protoreflect.EnumNumber{"bb": 1, "ema": 2, "rsi": 3, "macd": 4, "sma": 5}
+
+// techAnalysisIndicators — индикаторы от GetTechAnalysis вместо локального расчёта. Период — один
+// максимальный запрос свечей интервала, заканчивающийся в to; значения выравниваются по времени.
+func techAnalysisIndicators(ctx context.Context, ic *InvestClient, inst *InstrumentRef, spec CandleSpec, intervalStr string,
+	specs []indicatorSpec, series int, to time.Time) (*mcp.CallToolResult, error) {
+	if spec.Resample > 0 {
+		return mcp.NewToolResultError(fmt.Sprintf("source=api поддерживает только интервалы API, %q собирается из свечей локально", intervalStr)), nil
+	}
+	for _, s := range specs {
+		if _, ok := techAnalysisTypes[s.Kind]; !ok {
+			return mcp.NewToolResultError(fmt.Sprintf("индикатор %s не считается GetTechAnalysis, допустимо: sma,ema,rsi,macd,bb (либо source=local)", s.Kind)), nil
+		}
+	}
+	from := to.Add(-candleWindow(spec.Interval))
+	var all []indicatorSeries
+	byTime := make(map[int64]map[string]decimal.NullDecimal)
+	for _, s := range specs {
+		points, err := s.fetchTechAnalysis(ctx, ic, inst, spec.Interval, from, to)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Ошибка GetTechAnalysis: %v", err)), nil
+		}
+		names := s.seriesNames()
+		for _, p := range points {
+			row := byTime[p.at]
+			if row == nil {
+				row = make(map[string]decimal.NullDecimal)
+				byTime[p.at] = row
+			}
+			for i, v := range p.values {
+				row[names[i]] = v
+			}
+		}
+		for _, name := range names {
+			all = append(all, indicatorSeries{Name: name})
+		}
+	}
+	times := make([]int64, 0, len(byTime))
+	for t := range byTime {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	for _, t := range times {
+		for i := range all {
+			all[i].Values = append(all[i].Values, byTime[t][all[i].Name])
+		}
+	}
+
+	result := IndicatorsOutput{
+		Instrument: inst.JSON(), Interval: strings.ToLower(intervalStr), Source: "api",
+		Values: map[string]string{}, Series: []IndicatorRowJSON{}, Candles: len(times),
+	}
+	if len(times) == 0 {
+		return mcp.NewToolResultStructured(result, "GetTechAnalysis не вернул значений за период расчёта"), nil
+	}
+	last := time.Unix(times[len(times)-1], 0).UTC()
+	result.LastTime = last.Format(time.RFC3339)
+	lines := []string{fmt.Sprintf("Индикаторы %s (%s) FIGI %s, интервал %s, источник GetTechAnalysis, точек: %d, последняя: %s",
+		inst.Name, inst.Ticker, inst.Figi, strings.ToUpper(intervalStr), len(times), result.LastTime)}
+	for _, s := range all {
+		// у разных индикаторов ряды могут заканчиваться в разное время — берётся последнее значение каждого
+		v := decimal.NullDecimal{}
+		for i := len(s.Values) - 1; i >= 0 && !v.Valid; i-- {
+			v = s.Values[i]
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", s.Name, formatIndicator(v)))
+		putIndicator(result.Values, s.Name, v)
+	}
+	if series > 0 {
+		start := len(times) - series
+		if start < 0 {
+			start = 0
+		}
+		header := []string{"time"}
+		for _, s := range all {
+			header = append(header, s.Name)
+		}
+		lines = append(lines, "", "Ряд: "+strings.Join(header, " | "))
+		for i := start; i < len(times); i++ {
+			at := time.Unix(times[i], 0).UTC().Format(time.RFC3339)
+			row := []string{at}
+			point := IndicatorRowJSON{Time: at, Values: map[string]string{}}
+			for _, s := range all {
+				row = append(row, formatIndicator(s.Values[i]))
+				putIndicator(point.Values, s.Name, s.Values[i])
+			}
+			lines = append(lines, strings.Join(row, " | "))
+			result.Series = append(result.Series, point)
+		}
+	}
+	return mcp.NewToolResultStructured(result, strings.Join(lines, "\n")), nil
+}
+
+// techAnalysisPoint — значения всех рядов индикатора (в порядке seriesNames) на момент времени
+type techAnalysisPoint struct {
+	at     int64
+	values []decimal.NullDecimal
+}
+
+// seriesNames — имена рядов индикатора, как при локальном расчёте
+func (s indicatorSpec) seriesNames() []string {
+	p := s.Params
+	switch s.Kind {
+	case "sma", "ema", "rsi":
+		return []string{fmt.Sprintf("%s(%d)", strings.ToUpper(s.Kind), p[0])}
+	case "macd":
+		name := fmt.Sprintf("MACD(%d,%d,%d)", p[0], p[1], p[2])
+		return []string{name, name + " signal", name + " hist"}
+	case "bb":
+		name := fmt.Sprintf("BB(%d,%d)", p[0], p[1])
+		return []string{name + " upper", name + " middle", name + " lower"}
+	}
+	return nil
+}
+
+// fetchTechAnalysis запрашивает индикатор у GetTechAnalysis по ценам закрытия.
+// Номера IndicatorInterval совпадают с CandleInterval, поэтому интервал передаётся как есть.
+func (s indicatorSpec) fetchTechAnalysis(ctx context.Context, ic *InvestClient, inst *InstrumentRef, interval pb.CandleInterval, from, to time.Time) ([]techAnalysisPoint, error) {
+	req, err := apiExtMessage("GetTechAnalysisRequest")
+	if err != nil {
+		return nil, err
+	}
+	fields := req.Descriptor().Fields()
+	req.Set(fields.ByName("indicator_type"), protoreflect.ValueOfEnum(techAnalysisTypes[s.Kind]))
+	req.Set(fields.ByName("instrument_uid"), protoreflect.ValueOfString(inst.Uid))
+	setDynTime(req, "from", from)
+	setDynTime(req, "to", to)
+	req.Set(fields.ByName("interval"), protoreflect.ValueOfEnum(protoreflect.EnumNumber(interval)))
+	req.Set(fields.ByName("type_of_price"), protoreflect.ValueOfEnum(1)) // TYPE_OF_PRICE_CLOSE
+	p := s.Params
+	switch s.Kind {
+	case "macd":
+		sm := req.Mutable(fields.ByName("smoothing")).Message()
+		sf := sm.Descriptor().Fields()
+		sm.Set(sf.ByName("fast_length"), protoreflect.ValueOfInt32(int32(p[0])))
+		sm.Set(sf.ByName("slow_length"), protoreflect.ValueOfInt32(int32(p[1])))
+		sm.Set(sf.ByName("signal_smoothing"), protoreflect.ValueOfInt32(int32(p[2])))
+	case "bb":
+		req.Set(fields.ByName("length"), protoreflect.ValueOfInt32(int32(p[0])))
+		setDynQuotation(req.Mutable(fields.ByName("deviation")).Message(), "deviation_multiplier", &pb.Quotation{Units: int64(p[1])})
+	default:
+		req.Set(fields.ByName("length"), protoreflect.ValueOfInt32(int32(p[0])))
+	}
+	resp, err := apiExtMessage("GetTechAnalysisResponse")
+	if err != nil {
+		return nil, err
+	}
+	header, err := ic.ext.invoke(ctx, methodGetTechAnalysis, req, resp)
+	if err != nil {
+		return nil, err
+	}
+	if err := waitRateLimit(ctx, header, "GetTechAnalysis"); err != nil {
+		return nil, err
+	}
+	value := func(m protoreflect.Message, name string) decimal.NullDecimal {
+		if q := dynQuotation(m, name); q != nil {
+			return valid(quotationDecimal(q))
+		}
+		return decimal.NullDecimal{}
+	}
+	items := dynField(resp, "technical_indicators").List()
+	points := make([]techAnalysisPoint, 0, items.Len())
+	for i := 0; i < items.Len(); i++ {
+		m := items.Get(i).Message()
+		pt := techAnalysisPoint{at: dynTime(m, "timestamp").Unix()}
+		switch s.Kind {
+		case "macd":
+			line, signal := value(m, "macd"), value(m, "signal")
+			var hist decimal.NullDecimal
+			if line.Valid && signal.Valid {
+				hist = valid(line.Decimal.Sub(signal.Decimal))
+			}
+			pt.values = []decimal.NullDecimal{line, signal, hist}
+		case "bb":
+			pt.values = []decimal.NullDecimal{value(m, "upper_band"), value(m, "middle_band"), value(m, "lower_band")}
+		default:
+			pt.values = []decimal.NullDecimal{value(m, "signal")}
+		}
+		points = append(points, pt)
+	}
+	return points, nil
+}
+
+const (
+	// maxLookbackExtensions — сколько раз период поиска свечей удваивается назад
+	maxLookbackExtensions = 10
+	// lookbackIdleSpan — если удвоение не длиннее этого периода не принесло свечей, дальше истории нет
+	// (дольше длятся только торговые паузы, а не ночи, выходные и праздники)
+	lookbackIdleSpan = 14 * 24 * time.Hour
+)
+
+// lookbackHistoryStart — раньше этой даты свечи не запрашиваются
+var lookbackHistoryStart = time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// loadLookback загружает свечи, заканчивающиеся в to, пока среди них не наберётся need завершённых.
+// Период начинается с need интервалов и удваивается назад, покрывая ночи, выходные, праздники
+// и неликвидные часы. Загрузка идёт через хранилище свечей: уже покрытые участки отдаются
+// без обращения к API, догружаются только недостающие; прогресс продолжается через все удлинения.
+func loadLookback(ctx context.Context, ic *InvestClient, inst *InstrumentRef, spec CandleSpec, need int, to time.Time, progress progressFunc) ([]*pb.HistoricCandle, error) {
+	windows := newWindowProgress(progress)
+	span := time.Duration(need) * spec.step()
+	prev := -1
+	for i := 0; ; i++ {
+		from := to.Add(-span)
+		if from.Before(lookbackHistoryStart) {
+			from = lookbackHistoryStart
+		}
+		cq := &CandleQuery{Inst: inst, Spec: spec, From: spec.alignFrom(from), To: to}
+		candles, err := cq.load(ctx, ic, windows)
+		if err != nil {
+			return nil, err
+		}
+		if completeCandles(candles) >= need || i == maxLookbackExtensions || !from.After(lookbackHistoryStart) ||
+			(len(candles) == prev && span/2 >= lookbackIdleSpan) {
+			return candles, nil
+		}
+		prev = len(candles)
+		span *= 2
+	}
+}
+
+func completeCandles(candles []*pb.HistoricCandle) int {
+	n := 0
+	for _, c := range candles {
+		if c.GetIsComplete() {
+			n++
+		}
+	}
+	return n
+}
+
+func formingNote(c *pb.HistoricCandle) string {
+	if c.GetIsComplete() {
+		return ""
+	}
+	return ", свеча формируется"
+}
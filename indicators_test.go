@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// testCandles — дневные свечи с high = close+1, low = close−1
+func testCandles(closes []float64, volumes []int64) []*pb.HistoricCandle {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	out := make([]*pb.HistoricCandle, len(closes))
+	for i, c := range closes {
+		q := func(v float64) *pb.Quotation {
+			d := decimal.NewFromFloat(v)
+			return &pb.Quotation{Units: d.IntPart(), Nano: int32(d.Sub(decimal.NewFromInt(d.IntPart())).Shift(9).IntPart())}
+		}
+		var v int64 = 1
+		if volumes != nil {
+			v = volumes[i]
+		}
+		out[i] = &pb.HistoricCandle{
+			Time: timestamppb.New(start.Add(time.Duration(i) * 24 * time.Hour)),
+			Open: q(c), High: q(c + 1), Low: q(c - 1), Close: q(c),
+			Volume: v, IsComplete: true,
+		}
+	}
+	return out
+}
+
+func TestIndicatorReferenceValues(t *testing.T) {
+	closes := []float64{10, 11, 12, 11, 13, 14, 13, 15, 16, 15}
+	volumes := []int64{100, 200, 150, 100, 300, 250, 100, 200, 300, 150}
+	// классический пример RSI(14) Уайлдера (StockCharts): 70.53, 66.32, 66.55, 69.41, 66.36, 57.97
+	wilder := []float64{44.3389, 44.0902, 44.1497, 43.6124, 44.3278, 44.8264, 45.0955, 45.4245, 45.8433, 46.0826,
+		45.8931, 46.0328, 45.6140, 46.2820, 46.2820, 46.0028, 46.0328, 46.4116, 46.2222, 45.6439}
+
+	tests := []struct {
+		spec    string
+		closes  []float64
+		volumes []int64
+		series  string
+		want    []string
+	}{
+		{"sma:3", closes, nil, "SMA(3)",
+			[]string{"-", "-", "11", "11.333333", "12", "12.666667", "13.333333", "14", "14.666667", "15.333333"}},
+		{"ema:3", closes, nil, "EMA(3)",
+			[]string{"-", "-", "11", "11", "12", "13", "13", "14", "15", "15"}},
+		{"rsi:3", closes, nil, "RSI(3)",
+			[]string{"-", "-", "-", "66.666667", "83.333333", "87.878788", "62.365591", "79.885057", "85.090522", "61.296509"}},
+		{"rsi:14", wilder, nil, "RSI(14)",
+			[]string{"-", "-", "-", "-", "-", "-", "-", "-", "-", "-", "-", "-", "-", "-",
+				"70.532789", "66.318562", "66.54983", "69.406305", "66.355169", "57.974856"}},
+		{"macd:2:4:2", closes, nil, "MACD(2,4,2)",
+			[]string{"-", "-", "-", "0.166667", "0.588889", "0.782963", "0.346321", "0.699974", "0.850711", "0.387336"}},
+		{"macd:2:4:2", closes, nil, "MACD(2,4,2) signal",
+			[]string{"-", "-", "-", "-", "0.377778", "0.647901", "0.446848", "0.615598", "0.77234", "0.515671"}},
+		{"bb:3:2", closes, nil, "BB(3,2) upper",
+			[]string{"-", "-", "12.632993", "12.276142", "13.632993", "15.161105", "14.276142", "15.632993", "17.161105", "16.276142"}},
+		{"bb:3:2", closes, nil, "BB(3,2) lower",
+			[]string{"-", "-", "9.367007", "10.390524", "10.367007", "10.172228", "12.390524", "12.367007", "12.172228", "14.390524"}},
+		{"atr:3", closes, nil, "ATR(3)",
+			[]string{"-", "-", "2", "2", "2.333333", "2.222222", "2.148148", "2.432099", "2.288066", "2.192044"}},
+		{"vwap", closes, volumes, "VWAP",
+			[]string{"10", "10.666667", "11.111111", "11.090909", "11.764706", "12.272727", "12.333333", "12.714286", "13.294118", "13.432432"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.series, func(t *testing.T) {
+			spec, err := parseIndicatorSpec(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var values []decimal.NullDecimal
+			for _, s := range spec.compute(testCandles(tt.closes, tt.volumes), false) {
+				if s.Name == tt.series {
+					values = s.Values
+				}
+			}
+			if len(values) != len(tt.want) {
+				t.Fatalf("ряд %s: %d значений, ожидалось %d", tt.series, len(values), len(tt.want))
+			}
+			for i, want := range tt.want {
+				if got := formatIndicator(values[i]); got != want {
+					t.Errorf("%s[%d] = %s, ожидалось %s", tt.series, i, got, want)
+				}
+			}
+		})
+	}
+}
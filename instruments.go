@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+)
+
+// InstrumentCard — общая часть карточек Share/Bond/Etf/Future/Currency/Option
+type InstrumentCard struct {
+	Kind              pb.InstrumentType
+	Figi              string
+	Uid               string
+	Ticker            string
+	ClassCode         string
+	Isin              string
+	Name              string
+	Currency          string
+	Exchange          string
+	Lot               int32
+	MinPriceIncrement *pb.Quotation
+	TradingStatus     pb.SecurityTradingStatus
+	BuyAvailable      bool
+	SellAvailable     bool
+	ShortEnabled      bool
+	ApiTradeAvailable bool
+	ForQualInvestor   bool
+	Sector            string
+	Country           string
+	// Extra — специфичные для типа инструмента поля в виде готовых строк
+	Extra []string
+	// Future — параметры контракта, только для фьючерсов
+	Future *FutureJSON
+}
+
+// FutureJSON — параметры фьючерсного контракта; ГО — только если его удалось получить (GetFuturesMargin)
+type FutureJSON struct {
+	FuturesType             string     `json:"futures_type,omitempty"`
+	AssetType               string     `json:"asset_type,omitempty"`
+	BasicAsset              string     `json:"basic_asset"`
+	BasicAssetSize          string     `json:"basic_asset_size"`
+	FirstTradeDate          string     `json:"first_trade_date,omitempty"`
+	LastTradeDate           string     `json:"last_trade_date,omitempty"`
+	ExpirationDate          string     `json:"expiration_date,omitempty"`
+	InitialMarginOnBuy      *MoneyJSON `json:"initial_margin_on_buy,omitempty"`
+	InitialMarginOnSell     *MoneyJSON `json:"initial_margin_on_sell,omitempty"`
+	MinPriceIncrementAmount string     `json:"min_price_increment_amount,omitempty"`
+	MarginError             string     `json:"margin_error,omitempty"`
+}
+
+// InstrumentCardJSON — структурированный результат instrument_info
+type InstrumentCardJSON struct {
+	Instrument        InstrumentJSON `json:"instrument"`
+	Isin              string         `json:"isin,omitempty"`
+	Currency          string         `json:"currency"`
+	Exchange          string         `json:"exchange"`
+	Lot               int32          `json:"lot"`
+	MinPriceIncrement string         `json:"min_price_increment"`
+	TradingStatus     string         `json:"trading_status"`
+	BuyAvailable      bool           `json:"buy_available"`
+	SellAvailable     bool           `json:"sell_available"`
+	ShortEnabled      bool           `json:"short_enabled"`
+	ApiTradeAvailable bool           `json:"api_trade_available"`
+	ForQualInvestor   bool           `json:"for_qual_investor"`
+	Sector            string         `json:"sector,omitempty"`
+	Country           string         `json:"country_of_risk,omitempty"`
+	// Details — специфичные для типа инструмента параметры текстом
+	Details []string    `json:"details,omitempty"`
+	Future  *FutureJSON `json:"future,omitempty"`
+}
+
+// loadInstrumentCard загружает полную карточку инструмента через ShareBy/BondBy/EtfBy/FutureBy/CurrencyBy/OptionBy.
+// withMargin добавляет к карточке фьючерса гарантийное обеспечение — отдельный запрос GetFuturesMargin,
+// нужный только для показа карточки, а не для лотности и шага цены.
+func loadInstrumentCard(ic *InvestClient, ref *InstrumentRef, withMargin bool) (*InstrumentCard, error) {
+	instruments := ic.sdk.NewInstrumentsServiceClient()
+	switch ref.Kind {
+	case pb.InstrumentType_INSTRUMENT_TYPE_SHARE:
+		resp, err := instruments.ShareByUid(ref.Uid)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения акции: %w", err)
+		}
+		s := resp.GetInstrument()
+		return &InstrumentCard{
+			Kind: ref.Kind, Figi: s.GetFigi(), Uid: s.GetUid(), Ticker: s.GetTicker(), ClassCode: s.GetClassCode(),
+			Isin: s.GetIsin(), Name: s.GetName(), Currency: s.GetCurrency(), Exchange: s.GetExchange(),
+			Lot: s.GetLot(), MinPriceIncrement: s.GetMinPriceIncrement(), TradingStatus: s.GetTradingStatus(),
+			BuyAvailable: s.GetBuyAvailableFlag(), SellAvailable: s.GetSellAvailableFlag(), ShortEnabled: s.GetShortEnabledFlag(),
+			ApiTradeAvailable: s.GetApiTradeAvailableFlag(), ForQualInvestor: s.GetForQualInvestorFlag(),
+			Sector: s.GetSector(), Country: s.GetCountryOfRiskName(),
+			Extra: []string{
+				fmt.Sprintf("Тип акции: %v", s.GetShareType()),
+				fmt.Sprintf("Номинал: %s", moneyToStr(s.GetNominal())),
+				fmt.Sprintf("Размер выпуска: %d", s.GetIssueSize()),
+				fmt.Sprintf("Выплата дивидендов: %s", yesNo(s.GetDivYieldFlag())),
+			},
+		}, nil
+	case pb.InstrumentType_INSTRUMENT_TYPE_BOND:
+		resp, err := instruments.BondByUid(ref.Uid)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения облигации: %w", err)
+		}
+		b := resp.GetInstrument()
+		return &InstrumentCard{
+			Kind: ref.Kind, Figi: b.GetFigi(), Uid: b.GetUid(), Ticker: b.GetTicker(), ClassCode: b.GetClassCode(),
+			Isin: b.GetIsin(), Name: b.GetName(), Currency: b.GetCurrency(), Exchange: b.GetExchange(),
+			Lot: b.GetLot(), MinPriceIncrement: b.GetMinPriceIncrement(), TradingStatus: b.GetTradingStatus(),
+			BuyAvailable: b.GetBuyAvailableFlag(), SellAvailable: b.GetSellAvailableFlag(), ShortEnabled: b.GetShortEnabledFlag(),
+			ApiTradeAvailable: b.GetApiTradeAvailableFlag(), ForQualInvestor: b.GetForQualInvestorFlag(),
+			Sector: b.GetSector(), Country: b.GetCountryOfRiskName(),
+			Extra: []string{
+				fmt.Sprintf("Номинал: %s", moneyToStr(b.GetNominal())),
+				fmt.Sprintf("Дата погашения: %s", formatDate(b.GetMaturityDate())),
+				fmt.Sprintf("Купонов в год: %d", b.GetCouponQuantityPerYear()),
+				fmt.Sprintf("НКД: %s", moneyToStr(b.GetAciValue())),
+				fmt.Sprintf("Плавающий купон: %s, амортизация: %s, бессрочная: %s",
+					yesNo(b.GetFloatingCouponFlag()), yesNo(b.GetAmortizationFlag()), yesNo(b.GetPerpetualFlag())),
+				fmt.Sprintf("Уровень риска: %v", b.GetRiskLevel()),
+			},
+		}, nil
+	case pb.InstrumentType_INSTRUMENT_TYPE_ETF:
+		resp, err := instruments.EtfByUid(ref.Uid)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения фонда: %w", err)
+		}
+		e := resp.GetInstrument()
+		return &InstrumentCard{
+			Kind: ref.Kind, Figi: e.GetFigi(), Uid: e.GetUid(), Ticker: e.GetTicker(), ClassCode: e.GetClassCode(),
+			Isin: e.GetIsin(), Name: e.GetName(), Currency: e.GetCurrency(), Exchange: e.GetExchange(),
+			Lot: e.GetLot(), MinPriceIncrement: e.GetMinPriceIncrement(), TradingStatus: e.GetTradingStatus(),
+			BuyAvailable: e.GetBuyAvailableFlag(), SellAvailable: e.GetSellAvailableFlag(), ShortEnabled: e.GetShortEnabledFlag(),
+			ApiTradeAvailable: e.GetApiTradeAvailableFlag(), ForQualInvestor: e.GetForQualInvestorFlag(),
+			Sector: e.GetSector(), Country: e.GetCountryOfRiskName(),
+			Extra: []string{
+				fmt.Sprintf("Фокус: %s", e.GetFocusType()),
+				fmt.Sprintf("Комиссия фонда: %s%%", quotationToStr(e.GetFixedCommission())),
+				fmt.Sprintf("Частота ребалансировки: %s", e.GetRebalancingFreq()),
+			},
+		}, nil
+	case pb.InstrumentType_INSTRUMENT_TYPE_FUTURES:
+		resp, err := instruments.FutureByUid(ref.Uid)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения фьючерса: %w", err)
+		}
+		f := resp.GetInstrument()
+		extra, future := futureExtra(ic, f, withMargin)
+		return &InstrumentCard{
+			Kind: ref.Kind, Figi: f.GetFigi(), Uid: f.GetUid(), Ticker: f.GetTicker(), ClassCode: f.GetClassCode(),
+			Name: f.GetName(), Currency: f.GetCurrency(), Exchange: f.GetExchange(),
+			Lot: f.GetLot(), MinPriceIncrement: f.GetMinPriceIncrement(), TradingStatus: f.GetTradingStatus(),
+			BuyAvailable: f.GetBuyAvailableFlag(), SellAvailable: f.GetSellAvailableFlag(), ShortEnabled: f.GetShortEnabledFlag(),
+			ApiTradeAvailable: f.GetApiTradeAvailableFlag(), ForQualInvestor: f.GetForQualInvestorFlag(),
+			Sector: f.GetSector(), Country: f.GetCountryOfRiskName(),
+			Extra: extra, Future: future,
+		}, nil
+	case pb.InstrumentType_INSTRUMENT_TYPE_CURRENCY:
+		resp, err := instruments.CurrencyByUid(ref.Uid)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения валюты: %w", err)
+		}
+		c := resp.GetInstrument()
+		return &InstrumentCard{
+			Kind: ref.Kind, Figi: c.GetFigi(), Uid: c.GetUid(), Ticker: c.GetTicker(), ClassCode: c.GetClassCode(),
+			Isin: c.GetIsin(), Name: c.GetName(), Currency: c.GetCurrency(), Exchange: c.GetExchange(),
+			Lot: c.GetLot(), MinPriceIncrement: c.GetMinPriceIncrement(), TradingStatus: c.GetTradingStatus(),
+			BuyAvailable: c.GetBuyAvailableFlag(), SellAvailable: c.GetSellAvailableFlag(), ShortEnabled: c.GetShortEnabledFlag(),
+			ApiTradeAvailable: c.GetApiTradeAvailableFlag(), ForQualInvestor: c.GetForQualInvestorFlag(),
+			Country: c.GetCountryOfRiskName(),
+			Extra: []string{
+				fmt.Sprintf("ISO код валюты: %s", strings.ToUpper(c.GetIsoCurrencyName())),
+				fmt.Sprintf("Номинал: %s", moneyToStr(c.GetNominal())),
+			},
+		}, nil
+	case pb.InstrumentType_INSTRUMENT_TYPE_OPTION:
+		resp, err := instruments.OptionByUid(ref.Uid)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения опциона: %w", err)
+		}
+		o := resp.GetInstrument()
+		return &InstrumentCard{
+			Kind: ref.Kind, Uid: o.GetUid(), Ticker: o.GetTicker(), ClassCode: o.GetClassCode(),
+			Name: o.GetName(), Currency: o.GetCurrency(), Exchange: o.GetExchange(),
+			Lot: o.GetLot(), MinPriceIncrement: o.GetMinPriceIncrement(), TradingStatus: o.GetTradingStatus(),
+			BuyAvailable: o.GetBuyAvailableFlag(), SellAvailable: o.GetSellAvailableFlag(), ShortEnabled: o.GetShortEnabledFlag(),
+			ApiTradeAvailable: o.GetApiTradeAvailableFlag(), ForQualInvestor: o.GetForQualInvestorFlag(),
+			Sector: o.GetSector(), Country: o.GetCountryOfRiskName(),
+			Extra: []string{
+				fmt.Sprintf("Направление: %v, стиль: %v", o.GetDirection(), o.GetStyle()),
+				fmt.Sprintf("Страйк: %s", moneyToStr(o.GetStrikePrice())),
+				fmt.Sprintf("Базовый актив: %s × %s", o.GetBasicAsset(), quotationToStr(o.GetBasicAssetSize())),
+				fmt.Sprintf("Экспирация: %s", formatDate(o.GetExpirationDate())),
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("тип инструмента %v не поддерживается", ref.Kind)
+	}
+}
+
+// futureExtra собирает параметры контракта текстом и в структурированном виде и, если withMargin,
+// гарантийное обеспечение (GetFuturesMargin)
+func futureExtra(ic *InvestClient, f *pb.Future, withMargin bool) ([]string, *FutureJSON) {
+	future := &FutureJSON{
+		FuturesType: f.GetFuturesType(), AssetType: f.GetAssetType(),
+		BasicAsset: f.GetBasicAsset(), BasicAssetSize: quotationJSON(f.GetBasicAssetSize()),
+		FirstTradeDate: dateJSON(f.GetFirstTradeDate()), LastTradeDate: dateJSON(f.GetLastTradeDate()),
+		ExpirationDate: dateJSON(f.GetExpirationDate()),
+	}
+	extra := []string{
+		fmt.Sprintf("Тип фьючерса: %s, тип актива: %s", f.GetFuturesType(), f.GetAssetType()),
+		fmt.Sprintf("Базовый актив: %s × %s", f.GetBasicAsset(), quotationToStr(f.GetBasicAssetSize())),
+		fmt.Sprintf("Торги: %s → %s, экспирация: %s",
+			formatDate(f.GetFirstTradeDate()), formatDate(f.GetLastTradeDate()), formatDate(f.GetExpirationDate())),
+	}
+	if !withMargin {
+		return extra, future
+	}
+	margin, err := ic.sdk.NewInstrumentsServiceClient().GetFuturesMargin(f.GetFigi())
+	if err != nil {
+		future.MarginError = err.Error()
+		return append(extra, fmt.Sprintf("ГО: недоступно (%v)", err)), future
+	}
+	future.InitialMarginOnBuy = moneyJSON(margin.GetInitialMarginOnBuy())
+	future.InitialMarginOnSell = moneyJSON(margin.GetInitialMarginOnSell())
+	future.MinPriceIncrementAmount = quotationJSON(margin.GetMinPriceIncrementAmount())
+	return append(extra,
+		fmt.Sprintf("ГО покупателя: %s, ГО продавца: %s",
+			moneyToStr(margin.GetInitialMarginOnBuy()), moneyToStr(margin.GetInitialMarginOnSell())),
+		fmt.Sprintf("Стоимость шага цены: %s", quotationToStr(margin.GetMinPriceIncrementAmount())),
+	), future
+}
+
+func (c *InstrumentCard) Lines() []string {
+	lines := []string{
+		fmt.Sprintf("%s (%s)", c.Name, c.Ticker),
+		fmt.Sprintf("Тип: %v", c.Kind),
+		fmt.Sprintf("FIGI: %s, UID: %s", valueOrDash(c.Figi), c.Uid),
+		fmt.Sprintf("Class code: %s, ISIN: %s", c.ClassCode, valueOrDash(c.Isin)),
+		fmt.Sprintf("Биржа: %s, валюта: %s", c.Exchange, strings.ToUpper(c.Currency)),
+		fmt.Sprintf("Лот: %d, шаг цены: %s", c.Lot, quotationToStr(c.MinPriceIncrement)),
+		fmt.Sprintf("Статус торгов: %s", tradingStatusText(c.TradingStatus)),
+		fmt.Sprintf("Покупка: %s, продажа: %s, шорт: %s, торговля через API: %s",
+			yesNo(c.BuyAvailable), yesNo(c.SellAvailable), yesNo(c.ShortEnabled), yesNo(c.ApiTradeAvailable)),
+		fmt.Sprintf("Только для квалифицированных инвесторов: %s", yesNo(c.ForQualInvestor)),
+		fmt.Sprintf("Сектор: %s, страна риска: %s", valueOrDash(c.Sector), valueOrDash(c.Country)),
+	}
+	return append(lines, c.Extra...)
+}
+
+func (c *InstrumentCard) JSON() InstrumentCardJSON {
+	return InstrumentCardJSON{
+		Instrument: InstrumentJSON{Figi: c.Figi, Uid: c.Uid, Ticker: c.Ticker, ClassCode: c.ClassCode, Name: c.Name, Kind: kindName(c.Kind)},
+		Isin:       c.Isin, Currency: strings.ToLower(c.Currency), Exchange: c.Exchange,
+		Lot: c.Lot, MinPriceIncrement: quotationJSON(c.MinPriceIncrement),
+		TradingStatus: tradingStatusName(c.TradingStatus),
+		BuyAvailable:  c.BuyAvailable, SellAvailable: c.SellAvailable, ShortEnabled: c.ShortEnabled,
+		ApiTradeAvailable: c.ApiTradeAvailable, ForQualInvestor: c.ForQualInvestor,
+		Sector: c.Sector, Country: c.Country, Details: c.Extra, Future: c.Future,
+	}
+}
+
+func instrumentInfoHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	q, _ := req.RequireString("query")
+	inst, err := findInstrumentRef(ic, q)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	card, err := loadInstrumentCard(ic, inst, true)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка получения карточки инструмента: %v", err)), nil
+	}
+	return mcp.NewToolResultStructured(card.JSON(), "Карточка инструмента:\n"+formatList(card.Lines())), nil
+}
@@ -16,6 +16,7 @@ import (
 	pb "github.com/tinkoff/invest-api-go-sdk/proto"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // stdLogger — простой логгер, удовлетворяющий investgo.Logger
@@ -30,6 +31,11 @@ type InvestClient struct {
 	ctx       context.Context
 	sdk       *investgo.Client
 	accountID string
+	dataDir   string
+	bonds     bondListCache
+	assets    assetListCache
+	catalog   instrumentCatalog
+	ext       *apiExtConn // методы API, которых нет в SDK (apiext.go)
 }
 
 func NewInvestClient() (*InvestClient, error) {
@@ -91,13 +97,22 @@ func NewInvestClient() (*InvestClient, error) {
 			}
 		}
 	}
+	// Каталог для локальных данных (списки наблюдения и т.п.)
+	dataDir := strings.TrimSpace(os.Getenv("TINKOFF_DATA_DIR"))
+	if dataDir == "" {
+		dataDir = "data"
+	}
+
 	log.Printf("Используется endpoint: %s, app: %s", endpoint, appName)
 	log.Printf("Выбран AccountID: %s", accID)
+	log.Printf("Каталог локальных данных: %s", dataDir)
 
 	return &InvestClient{
 		ctx:       ctx,
 		sdk:       cli,
 		accountID: accID,
+		dataDir:   dataDir,
+		ext:       &apiExtConn{endpoint: endpoint, token: token, appName: appName},
 	}, nil
 }
 
@@ -115,9 +130,20 @@ func resolveAccountID(cli *investgo.Client) (string, error) {
 	return "", fmt.Errorf("не найден ни один счёт в статусе OPEN")
 }
 
-func (c *InvestClient) Close() { _ = c.sdk.Stop() }
+func (c *InvestClient) Close() {
+	_ = c.sdk.Stop()
+	c.ext.Close()
+}
 
 func main() {
+	// Подкоманда выгрузки свечей: go_mcp_server_tinvest export -query SBER -from ... -to ...
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		if err := runExportCLI(os.Args[2:]); err != nil {
+			log.Fatalf("Ошибка выгрузки свечей: %v", err)
+		}
+		return
+	}
+
 	// Параметры транспорта
 	var transport string
 	var host string
@@ -139,13 +165,50 @@ func main() {
 		"Tinkoff Investments MCP",
 		"1.0.0",
 		server.WithToolCapabilities(true),
+		server.WithResourceCapabilities(false, true),
+		server.WithPromptCapabilities(false),
+		server.WithLogging(),
 		server.WithRecovery(),
 	)
+	streams := newMarketStreamer(ic, mcpServer)
+	portfolio := registerResources(ic, mcpServer)
+	defer portfolio.Stop()
+	registerPrompts(mcpServer)
+	alerts, err := newAlertEngine(ic, mcpServer, streams)
+	if err != nil {
+		log.Fatalf("Ошибка загрузки алертов: %v", err)
+	}
 
 	// Инструменты MCP и обработчики
+	searchTool := mcp.NewTool("search",
+		mcp.WithDescription("Поиск инструментов любого типа с фильтрами; возвращает структурированный JSON"),
+		mcp.WithString("query", mcp.Required(), mcp.Description("Часть тикера, названия, FIGI или ISIN")),
+		mcp.WithArray("kind", mcp.WithStringItems(mcp.Enum("share", "bond", "etf", "future", "option", "currency")),
+			mcp.Description("Типы инструментов (любые из share,bond,etf,future,option,currency); по умолчанию все")),
+		mcp.WithString("class_code", mcp.Description("Класс-код (режим торгов), напр. TQBR")),
+		mcp.WithString("currency", mcp.Description("Валюта инструмента, напр. rub, usd")),
+		mcp.WithBoolean("tradeable_only", mcp.Description("Только доступные для торговли через API")),
+		mcp.WithNumber("limit", mcp.Description("Максимум результатов (1-100), по умолчанию 20")),
+		mcp.WithOutputSchema[SearchOutput](),
+	)
+	mcpServer.AddTool(searchTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return searchHandler(ctx, req, ic)
+	})
+
+	completeTickerTool := mcp.NewTool("complete_ticker",
+		mcp.WithDescription("Подсказки инструментов по началу тикера или названия из локального каталога (акции, облигации, фонды, фьючерсы, валюты): точное совпадение тикера и доступные для торговли — первыми"),
+		mcp.WithString("prefix", mcp.Required(), mcp.Description("Начало тикера или слова названия, напр. SBE или сбер")),
+		mcp.WithNumber("limit", mcp.Description("Максимум подсказок (1-100), по умолчанию 10")),
+		mcp.WithOutputSchema[SearchOutput](),
+	)
+	mcpServer.AddTool(completeTickerTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return completeTickerHandler(ctx, req, ic)
+	})
+
 	searchStocksTool := mcp.NewTool("search_stocks",
 		mcp.WithDescription("Поиск акций по тикеру или названию"),
 		mcp.WithString("query", mcp.Required(), mcp.Description("Часть тикера или названия акции")),
+		mcp.WithOutputSchema[SearchOutput](),
 	)
 	mcpServer.AddTool(searchStocksTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		return searchStocksHandler(ctx, req, ic)
@@ -154,6 +217,7 @@ func main() {
 	searchBondsTool := mcp.NewTool("search_bonds",
 		mcp.WithDescription("Поиск облигаций по тикеру или названию"),
 		mcp.WithString("query", mcp.Required(), mcp.Description("Часть тикера или названия облигации")),
+		mcp.WithOutputSchema[SearchOutput](),
 	)
 	mcpServer.AddTool(searchBondsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		return searchBondsHandler(ctx, req, ic)
@@ -162,15 +226,123 @@ func main() {
 	searchFundsTool := mcp.NewTool("search_funds",
 		mcp.WithDescription("Поиск фондов/ETF по тикеру или названию"),
 		mcp.WithString("query", mcp.Required(), mcp.Description("Часть тикера или названия фонда (ETF)")),
+		mcp.WithOutputSchema[SearchOutput](),
 	)
 	mcpServer.AddTool(searchFundsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		return searchFundsHandler(ctx, req, ic)
 	})
 
+	searchFuturesTool := mcp.NewTool("search_futures",
+		mcp.WithDescription("Поиск фьючерсов по тикеру или названию"),
+		mcp.WithString("query", mcp.Required(), mcp.Description("Часть тикера или названия фьючерса")),
+		mcp.WithOutputSchema[SearchOutput](),
+	)
+	mcpServer.AddTool(searchFuturesTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return searchFuturesHandler(ctx, req, ic)
+	})
+
+	searchOptionsTool := mcp.NewTool("search_options",
+		mcp.WithDescription("Поиск опционов по тикеру или названию"),
+		mcp.WithString("query", mcp.Required(), mcp.Description("Часть тикера или названия опциона")),
+		mcp.WithOutputSchema[SearchOutput](),
+	)
+	mcpServer.AddTool(searchOptionsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return searchOptionsHandler(ctx, req, ic)
+	})
+
+	searchCurrenciesTool := mcp.NewTool("search_currencies",
+		mcp.WithDescription("Поиск валют и валютных пар по тикеру или названию"),
+		mcp.WithString("query", mcp.Required(), mcp.Description("Часть тикера или названия валюты, напр. USD или CNYRUB")),
+		mcp.WithOutputSchema[SearchOutput](),
+	)
+	mcpServer.AddTool(searchCurrenciesTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return searchCurrenciesHandler(ctx, req, ic)
+	})
+
+	instrumentInfoTool := mcp.NewTool("instrument_info",
+		mcp.WithDescription("Полная карточка инструмента: лотность, валюта, шаг цены, ISIN, UID, биржа, торговые флаги, сектор и страна"),
+		mcp.WithString("query", mcp.Required(), mcp.Description("Тикер/название или FIGI инструмента")),
+		mcp.WithOutputSchema[InstrumentCardJSON](),
+	)
+	mcpServer.AddTool(instrumentInfoTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return instrumentInfoHandler(ctx, req, ic)
+	})
+
+	assetsTool := mcp.NewTool("assets",
+		mcp.WithDescription("Поиск активов (эмитент/ценная бумага) и всех их инструментов: акции, облигации, фонды на разных площадках"),
+		mcp.WithString("query", mcp.Required(), mcp.Description("Часть названия актива, тикер или FIGI инструмента")),
+		mcp.WithNumber("limit", mcp.Description("Максимум активов в ответе (1-100), по умолчанию 20")),
+		mcp.WithOutputSchema[AssetsOutput](),
+	)
+	mcpServer.AddTool(assetsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return assetsHandler(ctx, req, ic)
+	})
+
+	assetInfoTool := mcp.NewTool("asset_info",
+		mcp.WithDescription("Полная информация об активе: бренд, компания, ISIN и все инструменты актива"),
+		mcp.WithString("query", mcp.Required(), mcp.Description("UID актива либо тикер/название/FIGI одного из его инструментов")),
+		mcp.WithOutputSchema[AssetInfoOutput](),
+	)
+	mcpServer.AddTool(assetInfoTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return assetInfoHandler(ctx, req, ic)
+	})
+
+	fundamentalsTool := mcp.NewTool("fundamentals",
+		mcp.WithDescription("Фундаментальные показатели актива (GetAssetFundamentals): капитализация, P/E, P/B, EV/EBITDA, дивидендная доходность, выручка, маржа, ROE; несколько инструментов — сравнительная таблица"),
+		mcp.WithString("query", mcp.Required(), mcp.Description("Тикер/название или FIGI инструмента; несколько — через запятую (до 10), напр. SBER,VTBR")),
+		mcp.WithOutputSchema[FundamentalsOutput](),
+	)
+	mcpServer.AddTool(fundamentalsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return fundamentalsHandler(ctx, req, ic)
+	})
+
+	brandsTool := mcp.NewTool("brands",
+		mcp.WithDescription("Список брендов (компаний) с сектором и страной"),
+		mcp.WithString("query", mcp.Description("Фильтр по названию бренда или компании")),
+		mcp.WithNumber("limit", mcp.Description("Максимум брендов в ответе, по умолчанию 50")),
+		mcp.WithOutputSchema[BrandsOutput](),
+	)
+	mcpServer.AddTool(brandsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return brandsHandler(ctx, req, ic)
+	})
+
+	bondAnalyticsTool := mcp.NewTool("bond_analytics",
+		mcp.WithDescription("Аналитика облигации: купоны, НКД, грязная цена, текущая доходность, YTM, дюрация"),
+		mcp.WithString("query", mcp.Required(), mcp.Description("Тикер/название, FIGI или ISIN облигации")),
+		mcp.WithString("offer_date", mcp.Description("Дата оферты YYYY-MM-DD: доходность считается к оферте")),
+		mcp.WithNumber("offer_price", mcp.Description("Цена выкупа по оферте в % от номинала, по умолчанию 100")),
+		mcp.WithArray("amortizations", mcp.WithStringItems(),
+			mcp.Description("График амортизации: элементы YYYY-MM-DD:сумма на одну облигацию")),
+		mcp.WithOutputSchema[BondAnalyticsOutput](),
+	)
+	mcpServer.AddTool(bondAnalyticsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return bondAnalyticsHandler(ctx, req, ic)
+	})
+
+	bondScreenerTool := mcp.NewTool("bond_screener",
+		mcp.WithDescription("Скринер облигаций: фильтры по валюте, погашению, типу купона, амортизации, сектору, риску и YTM; сортировка по доходности"),
+		mcp.WithString("currency", mcp.Description("Валюта облигации, напр. rub")),
+		mcp.WithString("maturity_from", mcp.Description("Погашение не раньше даты YYYY-MM-DD")),
+		mcp.WithString("maturity_to", mcp.Description("Погашение не позже даты YYYY-MM-DD")),
+		mcp.WithString("coupon_type", mcp.Enum("fixed", "floating"), mcp.Description("Тип купона: fixed или floating")),
+		mcp.WithBoolean("amortization", mcp.Description("true — только с амортизацией, false — только без")),
+		mcp.WithString("sector", mcp.Description("Сектор экономики, напр. government, financial")),
+		mcp.WithString("risk_level", mcp.Enum("low", "moderate", "high"), mcp.Description("Уровень риска")),
+		mcp.WithNumber("ytm_min", mcp.Description("Минимальная доходность к погашению, % годовых")),
+		mcp.WithNumber("ytm_max", mcp.Description("Максимальная доходность к погашению, % годовых")),
+		mcp.WithNumber("page", mcp.Description("Номер страницы, с 1")),
+		mcp.WithNumber("page_size", mcp.Description("Размер страницы (1-100), по умолчанию 20")),
+		mcp.WithOutputSchema[BondScreenerOutput](),
+	)
+	mcpServer.AddTool(bondScreenerTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return bondScreenerHandler(ctx, req, ic)
+	})
+
 	buyTool := mcp.NewTool("buy",
 		mcp.WithDescription("Купить инструмент (рыночная заявка)"),
 		mcp.WithString("ticker", mcp.Required(), mcp.Description("Тикер или часть названия для поиска инструмента")),
 		mcp.WithNumber("lots", mcp.Required(), mcp.Description("Количество лотов")),
+		mcp.WithOutputSchema[OrderOutput](),
 	)
 	mcpServer.AddTool(buyTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		return buyHandler(ctx, req, ic)
@@ -180,6 +352,7 @@ func main() {
 		mcp.WithDescription("Продать инструмент (рыночная заявка)"),
 		mcp.WithString("ticker", mcp.Required(), mcp.Description("Тикер или часть названия для поиска инструмента")),
 		mcp.WithNumber("lots", mcp.Required(), mcp.Description("Количество лотов")),
+		mcp.WithOutputSchema[OrderOutput](),
 	)
 	mcpServer.AddTool(sellTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		return sellHandler(ctx, req, ic)
@@ -187,48 +360,247 @@ func main() {
 
 	portfolioTool := mcp.NewTool("portfolio",
 		mcp.WithDescription("Просмотр текущего портфеля (позиции и остатки)"),
+		mcp.WithOutputSchema[PortfolioOutput](),
 	)
 	mcpServer.AddTool(portfolioTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		return portfolioHandler(ctx, req, ic)
 	})
 
+	dividendsTool := mcp.NewTool("dividends",
+		mcp.WithDescription("Дивиденды по инструменту: размер, даты отсечки и выплаты, доходность"),
+		mcp.WithString("query", mcp.Required(), mcp.Description("Тикер/название или FIGI инструмента")),
+		mcp.WithString("from", mcp.Description("Начало периода YYYY-MM-DD, по умолчанию год назад")),
+		mcp.WithString("to", mcp.Description("Конец периода YYYY-MM-DD, по умолчанию через год")),
+		mcp.WithOutputSchema[DividendsOutput](),
+	)
+	mcpServer.AddTool(dividendsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return dividendsHandler(ctx, req, ic)
+	})
+
+	incomeCalendarTool := mcp.NewTool("portfolio_income_calendar",
+		mcp.WithDescription("Прогноз дивидендов и купонов по позициям портфеля на N месяцев с группировкой по месяцам и валютам"),
+		mcp.WithNumber("months", mcp.Description("Горизонт в месяцах (1-36), по умолчанию 12")),
+		mcp.WithOutputSchema[IncomeCalendarOutput](),
+	)
+	mcpServer.AddTool(incomeCalendarTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return portfolioIncomeCalendarHandler(ctx, req, ic)
+	})
+
+	favoritesTool := mcp.NewTool("favorites",
+		mcp.WithDescription("Избранные инструменты брокерского аккаунта"),
+		mcp.WithOutputSchema[FavoritesOutput](),
+	)
+	mcpServer.AddTool(favoritesTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return favoritesHandler(ctx, req, ic)
+	})
+
+	favoritesEditTool := mcp.NewTool("favorites_edit",
+		mcp.WithDescription("Добавить или удалить инструменты в избранном брокера (в т.ч. из локального списка наблюдения)"),
+		mcp.WithString("action", mcp.Required(), mcp.Enum("add", "remove"), mcp.Description("add — добавить, remove — удалить")),
+		mcp.WithString("query", mcp.Description("Тикеры/названия/FIGI через запятую")),
+		mcp.WithString("watchlist", mcp.Description("Имя локального списка, все инструменты которого нужно добавить/удалить")),
+		mcp.WithOutputSchema[FavoritesOutput](),
+	)
+	mcpServer.AddTool(favoritesEditTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return favoritesEditHandler(ctx, req, ic)
+	})
+
+	watchlistsTool := mcp.NewTool("watchlists",
+		mcp.WithDescription("Локальные именованные списки наблюдения"),
+		mcp.WithOutputSchema[WatchlistsOutput](),
+	)
+	mcpServer.AddTool(watchlistsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return watchlistsHandler(ctx, req, ic)
+	})
+
+	watchlistAddTool := mcp.NewTool("watchlist_add",
+		mcp.WithDescription("Добавить инструменты в локальный список наблюдения (список создаётся автоматически)"),
+		mcp.WithString("name", mcp.Required(), mcp.Description("Имя списка")),
+		mcp.WithString("query", mcp.Description("Тикеры/названия/FIGI через запятую")),
+		mcp.WithBoolean("from_favorites", mcp.Description("Импортировать все инструменты из избранного брокера")),
+		mcp.WithOutputSchema[WatchlistChangeOutput](),
+	)
+	mcpServer.AddTool(watchlistAddTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return watchlistAddHandler(ctx, req, ic)
+	})
+
+	watchlistRemoveTool := mcp.NewTool("watchlist_remove",
+		mcp.WithDescription("Удалить инструменты из локального списка; без query удаляется весь список"),
+		mcp.WithString("name", mcp.Required(), mcp.Description("Имя списка")),
+		mcp.WithString("query", mcp.Description("Тикеры/FIGI/UID через запятую")),
+		mcp.WithOutputSchema[WatchlistChangeOutput](),
+	)
+	mcpServer.AddTool(watchlistRemoveTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return watchlistRemoveHandler(ctx, req, ic)
+	})
+
+	watchlistQuotesTool := mcp.NewTool("watchlist_quotes",
+		mcp.WithDescription("Последние цены и изменение к закрытию по всем инструментам списка наблюдения или избранного"),
+		mcp.WithString("name", mcp.Description("Имя локального списка")),
+		mcp.WithBoolean("favorites", mcp.Description("Использовать избранное брокера вместо локального списка")),
+		mcp.WithOutputSchema[WatchlistQuotesOutput](),
+	)
+	mcpServer.AddTool(watchlistQuotesTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return watchlistQuotesHandler(ctx, req, ic)
+	})
+
 	// Market Data инструменты
 	lastPriceTool := mcp.NewTool("last_price",
-		mcp.WithDescription("Последняя цена инструмента"),
-		mcp.WithString("query", mcp.Required(), mcp.Description("Тикер/название или FIGI инструмента")),
+		mcp.WithDescription("Последние цены инструментов: цена, закрытие предыдущей сессии, изменение в абсолютных значениях и процентах, возраст котировки"),
+		mcp.WithString("query", mcp.Required(), mcp.Description("Тикер/название или FIGI инструмента; несколько — через запятую, напр. SBER,GAZP,LKOH")),
+		mcp.WithOutputSchema[QuotesOutput](),
 	)
 	mcpServer.AddTool(lastPriceTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		return lastPriceHandler(ctx, req, ic)
 	})
 
 	orderbookTool := mcp.NewTool("orderbook",
-		mcp.WithDescription("Стакан заявок по инструменту"),
+		mcp.WithDescription("Стакан заявок по инструменту с аналитикой: спред, mid, дисбаланс, глубина в деньгах, стоимость исполнения N лотов, ценовые лимиты"),
 		mcp.WithString("query", mcp.Required(), mcp.Description("Тикер/название или FIGI инструмента")),
 		mcp.WithNumber("depth", mcp.Required(), mcp.Description("Глубина стакана (1-50)")),
+		mcp.WithNumber("lots", mcp.Description("Рассчитать исполнение рыночной заявки на столько лотов в каждую сторону")),
+		mcp.WithOutputSchema[OrderbookOutput](),
 	)
 	mcpServer.AddTool(orderbookTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		return orderbookHandler(ctx, req, ic)
 	})
 
+	lastTradesTool := mcp.NewTool("last_trades",
+		mcp.WithDescription("Лента обезличенных сделок за окно до часа: цена, количество, направление, время; объёмы покупок и продаж, VWAP"),
+		mcp.WithString("query", mcp.Required(), mcp.Description("Тикер/название или FIGI инструмента")),
+		mcp.WithNumber("minutes", mcp.Description("Длина окна в минутах до to (1-60), по умолчанию 10")),
+		mcp.WithString("from", mcp.Description("Начало окна (RFC3339); заменяет minutes, обрезается до последнего часа")),
+		mcp.WithString("to", mcp.Description("Конец окна (RFC3339), по умолчанию сейчас")),
+		mcp.WithNumber("limit", mcp.Description("Сколько последних сделок вывести (0-500), по умолчанию 50")),
+		mcp.WithOutputSchema[LastTradesOutput](),
+	)
+	mcpServer.AddTool(lastTradesTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return lastTradesHandler(ctx, req, ic)
+	})
+
 	candlesTool := mcp.NewTool("candles",
-		mcp.WithDescription("Исторические свечи по инструменту за период"),
+		mcp.WithDescription("Исторические свечи по инструменту за произвольный период (длинные периоды загружаются по частям)"),
 		mcp.WithString("query", mcp.Required(), mcp.Description("Тикер/название или FIGI инструмента")),
 		mcp.WithString("from", mcp.Required(), mcp.Description("Начало периода (RFC3339), напр. 2024-01-01T00:00:00Z")),
 		mcp.WithString("to", mcp.Required(), mcp.Description("Конец периода (RFC3339), напр. 2024-01-31T23:59:59Z")),
-		mcp.WithString("interval", mcp.Required(), mcp.Description("Интервал: 1m,5m,15m,1h,1d")),
+		mcp.WithString("interval", mcp.Required(), mcp.Description("Интервал: 1m,2m,3m,5m,10m,15m,30m,1h,2h,4h,1d,week,month или произвольный N m/h/d (напр. 45m, 3d) — собирается из более мелких свечей")),
+		mcp.WithOutputSchema[CandlesOutput](),
 	)
 	mcpServer.AddTool(candlesTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		return candlesHandler(ctx, req, ic)
 	})
 
-	tradingStatusTool := mcp.NewTool("trading_status",
-		mcp.WithDescription("Статус торгов по инструменту"),
+	exportCandlesTool := mcp.NewTool("export_candles",
+		mcp.WithDescription("Выгрузка всех свечей за период в CSV, JSON Lines или Parquet: в файл на сервере или как встроенный ресурс MCP"),
+		mcp.WithString("query", mcp.Required(), mcp.Description("Тикер/название или FIGI инструмента")),
+		mcp.WithString("from", mcp.Required(), mcp.Description("Начало периода (RFC3339), напр. 2024-01-01T00:00:00Z")),
+		mcp.WithString("to", mcp.Required(), mcp.Description("Конец периода (RFC3339), напр. 2024-12-31T23:59:59Z")),
+		mcp.WithString("interval", mcp.Required(), mcp.Description("Интервал, как в candles: 1m…month или N m/h/d")),
+		mcp.WithString("format", mcp.Enum("csv", "jsonl", "parquet"), mcp.Description("Формат, по умолчанию csv")),
+		mcp.WithString("path", mcp.Description("Путь к файлу на сервере; относительный — внутри $TINKOFF_DATA_DIR/exports. Без path данные возвращаются встроенным ресурсом")),
+		mcp.WithOutputSchema[ExportOutput](),
+	)
+	mcpServer.AddTool(exportCandlesTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return exportCandlesHandler(ctx, req, ic)
+	})
+
+	indicatorsTool := mcp.NewTool("indicators",
+		mcp.WithDescription("Технические индикаторы по свечам (SMA, EMA, RSI, MACD, Bollinger, ATR, VWAP): локальный расчёт или GetTechAnalysis"),
+		mcp.WithString("query", mcp.Required(), mcp.Description("Тикер/название или FIGI инструмента")),
+		mcp.WithString("interval", mcp.Description("Интервал свечей, как в candles; по умолчанию 1d")),
+		mcp.WithArray("indicators", mcp.WithStringItems(),
+			mcp.Description("Индикаторы с параметрами через двоеточие: sma:20, ema:50, rsi:14, macd:12:26:9, bb:20:2, atr:14, vwap; по умолчанию все с параметрами по умолчанию")),
+		mcp.WithNumber("series", mcp.Description("Вывести ряд значений за последние N свечей (0-500), по умолчанию только последние значения")),
+		mcp.WithString("to", mcp.Description("Момент расчёта (RFC3339), по умолчанию сейчас")),
+		mcp.WithString("source", mcp.Enum("local", "api"),
+			mcp.Description("local — расчёт по свечам (по умолчанию), api — значения GetTechAnalysis (только sma, ema, rsi, macd, bb и интервалы API)")),
+		mcp.WithOutputSchema[IndicatorsOutput](),
+	)
+	mcpServer.AddTool(indicatorsTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return indicatorsHandler(ctx, req, ic)
+	})
+
+	subscribeTool := mcp.NewTool("subscribe",
+		mcp.WithDescription("Подписка на живые данные MarketDataStream (последняя цена, стакан, сделки, свечи; ресурс tinvest://market/{uid}) и на изменения портфеля (ресурс tinvest://portfolio/{account_id}). Изменения приходят этой сессии уведомлениями notifications/resources/updated"),
+		mcp.WithString("query", mcp.Description("Тикеры/названия/FIGI через запятую")),
+		mcp.WithString("portfolio", mcp.Description("ID счёта или \"selected\" (TINKOFF_ACCOUNT_ID): уведомлять об изменениях позиций портфеля")),
+		mcp.WithArray("data", mcp.WithStringItems(mcp.Enum("lastprice", "orderbook", "trades", "candles")),
+			mcp.Description("Виды данных (lastprice, orderbook, trades, candles), по умолчанию lastprice")),
+		mcp.WithNumber("depth", mcp.Description("Глубина стакана (1-50), по умолчанию 10")),
+		mcp.WithString("candle_interval", mcp.Enum("1m", "5m"), mcp.Description("Интервал свечей стрима, по умолчанию 1m")),
+		mcp.WithOutputSchema[SubscriptionsOutput](),
+	)
+	mcpServer.AddTool(subscribeTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return subscribeHandler(ctx, req, ic, streams, portfolio)
+	})
+
+	unsubscribeTool := mcp.NewTool("unsubscribe",
+		mcp.WithDescription("Отписка от живых данных MarketDataStream и от изменений портфеля"),
+		mcp.WithString("query", mcp.Description("Тикеры/названия/FIGI через запятую")),
+		mcp.WithString("portfolio", mcp.Description("ID счёта или \"selected\": отписаться от изменений портфеля")),
+		mcp.WithArray("data", mcp.WithStringItems(mcp.Enum("lastprice", "orderbook", "trades", "candles")),
+			mcp.Description("От каких видов данных отписаться, по умолчанию от всех")),
+		mcp.WithBoolean("all", mcp.Description("Отписаться от всех инструментов и портфелей")),
+		mcp.WithOutputSchema[SubscriptionsOutput](),
+	)
+	mcpServer.AddTool(unsubscribeTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return unsubscribeHandler(ctx, req, ic, streams, portfolio)
+	})
+
+	alertCreateTool := mcp.NewTool("alert_create",
+		mcp.WithDescription("Создать ценовой алерт. Проверяется по стриму (если есть подписка subscribe) и опросом раз в 30 секунд; срабатывание приходит уведомлением notifications/message и, при указании, на webhook"),
 		mcp.WithString("query", mcp.Required(), mcp.Description("Тикер/название или FIGI инструмента")),
+		mcp.WithString("condition", mcp.Required(), mcp.Enum(alertConditions...),
+			mcp.Description("Условие: price_above/price_below — цена не ниже/не выше value; price_cross — пересечение value; change_above/change_below — изменение к закрытию в %; rsi_above/rsi_below — RSI")),
+		mcp.WithNumber("value", mcp.Required(), mcp.Description("Порог: цена, процент изменения (напр. 5 или -3) или уровень RSI")),
+		mcp.WithString("interval", mcp.Description("Интервал свечей для RSI, как в candles; по умолчанию 1h")),
+		mcp.WithNumber("period", mcp.Description("Период RSI (2-100), по умолчанию 14")),
+		mcp.WithBoolean("repeat", mcp.Description("Срабатывать повторно каждый раз, когда условие снова начинает выполняться; по умолчанию алерт отключается после срабатывания")),
+		mcp.WithString("webhook", mcp.Description("URL, на который отправляется POST с JSON срабатывания; хост должен быть в TINKOFF_ALERT_WEBHOOK_HOSTS")),
+		mcp.WithOutputSchema[AlertsOutput](),
+	)
+	mcpServer.AddTool(alertCreateTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return alertCreateHandler(ctx, req, ic, alerts)
+	})
+
+	alertListTool := mcp.NewTool("alert_list",
+		mcp.WithDescription("Список алертов: условие, статус, последнее значение и срабатывания"),
+		mcp.WithOutputSchema[AlertsOutput](),
+	)
+	mcpServer.AddTool(alertListTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return alertListHandler(ctx, req, alerts)
+	})
+
+	alertDeleteTool := mcp.NewTool("alert_delete",
+		mcp.WithDescription("Удалить алерты"),
+		mcp.WithString("id", mcp.Description("ID алертов через запятую")),
+		mcp.WithBoolean("all", mcp.Description("Удалить все алерты")),
+		mcp.WithOutputSchema[AlertDeleteOutput](),
+	)
+	mcpServer.AddTool(alertDeleteTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return alertDeleteHandler(ctx, req, alerts)
+	})
+
+	tradingStatusTool := mcp.NewTool("trading_status",
+		mcp.WithDescription("Статус торгов по одному или нескольким инструментам: описание режима, доступность лимитных/рыночных заявок и API"),
+		mcp.WithString("query", mcp.Required(), mcp.Description("Тикер/название или FIGI инструмента; несколько — через запятую, напр. SBER,GAZP,LKOH")),
+		mcp.WithOutputSchema[TradingStatusOutput](),
 	)
 	mcpServer.AddTool(tradingStatusTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		return tradingStatusHandler(ctx, req, ic)
 	})
 
+	tradingScheduleTool := mcp.NewTool("trading_schedule",
+		mcp.WithDescription("Расписание торгов площадки: сессии, премаркет, вечерняя сессия, клиринг, неторговые дни"),
+		mcp.WithString("exchange", mcp.Description("Площадка, напр. MOEX, SPB, FORTS; по умолчанию все")),
+		mcp.WithString("from", mcp.Description("Начало периода YYYY-MM-DD, по умолчанию сегодня")),
+		mcp.WithString("to", mcp.Description("Конец периода YYYY-MM-DD, по умолчанию from + 7 дней (не более 14 дней)")),
+		mcp.WithOutputSchema[TradingScheduleOutput](),
+	)
+	mcpServer.AddTool(tradingScheduleTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return tradingScheduleHandler(ctx, req, ic)
+	})
+
 	// Запуск транспорта
 	if transport == "sse" {
 		sseServer := server.NewSSEServer(mcpServer, server.WithBaseURL(fmt.Sprintf("http://%s:%s", host, port)))
@@ -245,127 +617,163 @@ func main() {
 }
 
 // Handlers
-func searchStocksHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
-	query, _ := req.RequireString("query")
-	instruments := ic.sdk.NewInstrumentsServiceClient()
-	resp, err := instruments.FindInstrument(query)
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Ошибка поиска акций: %v", err)), nil
-	}
-	var out []string
-	for _, it := range resp.GetInstruments() {
-		if it.GetInstrumentKind() == pb.InstrumentType_INSTRUMENT_TYPE_SHARE {
-			out = append(out, fmt.Sprintf("%s (%s) – FIGI: %s", it.GetName(), it.GetTicker(), it.GetFigi()))
-		}
-	}
-	if len(out) == 0 {
-		return mcp.NewToolResultText("Акции по запросу не найдены"), nil
-	}
-	return mcp.NewToolResultText("Найдено акций:\n" + formatList(out)), nil
+func buyHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	return marketOrderHandler(req, ic, pb.OrderDirection_ORDER_DIRECTION_BUY)
 }
 
-func searchBondsHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
-	query, _ := req.RequireString("query")
-	instruments := ic.sdk.NewInstrumentsServiceClient()
-	resp, err := instruments.FindInstrument(query)
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Ошибка поиска облигаций: %v", err)), nil
-	}
-	var out []string
-	for _, it := range resp.GetInstruments() {
-		if it.GetInstrumentKind() == pb.InstrumentType_INSTRUMENT_TYPE_BOND {
-			out = append(out, fmt.Sprintf("%s (%s) – FIGI: %s", it.GetName(), it.GetTicker(), it.GetFigi()))
-		}
-	}
-	if len(out) == 0 {
-		return mcp.NewToolResultText("Облигации по запросу не найдены"), nil
-	}
-	return mcp.NewToolResultText("Найдено облигаций:\n" + formatList(out)), nil
+func sellHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	return marketOrderHandler(req, ic, pb.OrderDirection_ORDER_DIRECTION_SELL)
 }
 
-func searchFundsHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
-	query, _ := req.RequireString("query")
-	instruments := ic.sdk.NewInstrumentsServiceClient()
-	resp, err := instruments.FindInstrument(query)
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Ошибка поиска фондов: %v", err)), nil
-	}
-	var out []string
-	for _, it := range resp.GetInstruments() {
-		if it.GetInstrumentKind() == pb.InstrumentType_INSTRUMENT_TYPE_ETF {
-			out = append(out, fmt.Sprintf("%s (%s) – FIGI: %s", it.GetName(), it.GetTicker(), it.GetFigi()))
-		}
-	}
-	if len(out) == 0 {
-		return mcp.NewToolResultText("Фонды по запросу не найдены"), nil
-	}
-	return mcp.NewToolResultText("Найдено фондов:\n" + formatList(out)), nil
+// OrderOutput — структурированный результат buy/sell
+type OrderOutput struct {
+	Instrument         InstrumentJSON `json:"instrument"`
+	Direction          string         `json:"direction"`
+	OrderId            string         `json:"order_id"`
+	Status             string         `json:"status"`
+	Lot                int32          `json:"lot"`
+	LotsRequested      int64          `json:"lots_requested"`
+	LotsExecuted       int64          `json:"lots_executed"`
+	ExecutedOrderPrice *MoneyJSON     `json:"executed_order_price,omitempty"`
+	TotalOrderAmount   *MoneyJSON     `json:"total_order_amount,omitempty"`
+	ExecutedCommission *MoneyJSON     `json:"executed_commission,omitempty"`
+	Message            string         `json:"message,omitempty"`
 }
 
-func buyHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+// marketOrderHandler выставляет рыночную заявку. Инструмент адресуется по UID,
+// чтобы одинаково работать с акциями, фьючерсами, опционами (у них нет FIGI) и валютными парами.
+func marketOrderHandler(req mcp.CallToolRequest, ic *InvestClient, direction pb.OrderDirection) (*mcp.CallToolResult, error) {
 	q, _ := req.RequireString("ticker")
 	lotsF, _ := req.RequireFloat("lots")
 	lots := int64(lotsF)
+	if lots < 1 {
+		return mcp.NewToolResultError("Количество лотов должно быть не меньше 1"), nil
+	}
 
-	instruments := ic.sdk.NewInstrumentsServiceClient()
-	found, err := instruments.FindInstrument(q)
-	if err != nil || len(found.GetInstruments()) == 0 {
-		return mcp.NewToolResultError(fmt.Sprintf("Инструмент %q не найден", q)), nil
+	action := "покупку"
+	if direction == pb.OrderDirection_ORDER_DIRECTION_SELL {
+		action = "продажу"
 	}
-	inst := found.GetInstruments()[0]
 
-	orders := ic.sdk.NewOrdersServiceClient()
-	_, err = orders.Buy(&investgo.PostOrderRequestShort{
-		InstrumentId: inst.GetFigi(),
-		Quantity:     lots,
-		Price:        nil, // market
-		AccountId:    ic.accountID,
-		OrderType:    pb.OrderType_ORDER_TYPE_MARKET,
-		OrderId:      investgo.CreateUid(),
-	})
+	inst, err := findTradableRef(ic, q)
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Ошибка покупки %s: %v", inst.GetTicker(), err)), nil
+		return mcp.NewToolResultError(err.Error()), nil
 	}
-	return mcp.NewToolResultText(fmt.Sprintf("Отправлена заявка на покупку %d лотов %s (%s)", lots, inst.GetName(), inst.GetTicker())), nil
-}
-
-func sellHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
-	q, _ := req.RequireString("ticker")
-	lotsF, _ := req.RequireFloat("lots")
-	lots := int64(lotsF)
-
-	instruments := ic.sdk.NewInstrumentsServiceClient()
-	found, err := instruments.FindInstrument(q)
-	if err != nil || len(found.GetInstruments()) == 0 {
-		return mcp.NewToolResultError(fmt.Sprintf("Инструмент %q не найден", q)), nil
+	card, err := loadInstrumentCard(ic, inst, false)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка получения карточки %s: %v", inst.Ticker, err)), nil
+	}
+	if !card.ApiTradeAvailable {
+		return mcp.NewToolResultError(fmt.Sprintf("Инструмент %s (%s) недоступен для торговли через API", card.Name, card.Ticker)), nil
+	}
+	if direction == pb.OrderDirection_ORDER_DIRECTION_BUY && !card.BuyAvailable {
+		return mcp.NewToolResultError(fmt.Sprintf("Покупка %s (%s) сейчас недоступна", card.Name, card.Ticker)), nil
+	}
+	if direction == pb.OrderDirection_ORDER_DIRECTION_SELL && !card.SellAvailable {
+		return mcp.NewToolResultError(fmt.Sprintf("Продажа %s (%s) сейчас недоступна", card.Name, card.Ticker)), nil
 	}
-	inst := found.GetInstruments()[0]
 
 	orders := ic.sdk.NewOrdersServiceClient()
-	_, err = orders.Sell(&investgo.PostOrderRequestShort{
-		InstrumentId: inst.GetFigi(),
+	resp, err := orders.PostOrder(&investgo.PostOrderRequest{
+		InstrumentId: card.Uid,
 		Quantity:     lots,
 		Price:        nil, // market
+		Direction:    direction,
 		AccountId:    ic.accountID,
 		OrderType:    pb.OrderType_ORDER_TYPE_MARKET,
 		OrderId:      investgo.CreateUid(),
 	})
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Ошибка продажи %s: %v", inst.GetTicker(), err)), nil
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка заявки на %s %s: %v", action, card.Ticker, err)), nil
+	}
+
+	lines := []string{
+		fmt.Sprintf("Отправлена заявка на %s %d лотов %s (%s)", action, lots, card.Name, card.Ticker),
+		fmt.Sprintf("Тип: %v, лот: %d, итого единиц: %d", card.Kind, card.Lot, lots*int64(card.Lot)),
+		fmt.Sprintf("Заявка %s, статус: %v, исполнено лотов: %d из %d",
+			resp.GetOrderId(), resp.GetExecutionReportStatus(), resp.GetLotsExecuted(), resp.GetLotsRequested()),
+	}
+	if amount := resp.GetTotalOrderAmount(); amount != nil {
+		lines = append(lines, fmt.Sprintf("Сумма заявки: %s", moneyToStr(amount)))
+	}
+	result := OrderOutput{
+		Instrument: card.JSON().Instrument,
+		Direction:  strings.ToLower(strings.TrimPrefix(direction.String(), "ORDER_DIRECTION_")),
+		OrderId:    resp.GetOrderId(),
+		Status:     strings.ToLower(strings.TrimPrefix(resp.GetExecutionReportStatus().String(), "EXECUTION_REPORT_STATUS_")),
+		Lot:        card.Lot, LotsRequested: resp.GetLotsRequested(), LotsExecuted: resp.GetLotsExecuted(),
+		ExecutedOrderPrice: moneyJSON(resp.GetExecutedOrderPrice()),
+		TotalOrderAmount:   moneyJSON(resp.GetTotalOrderAmount()),
+		ExecutedCommission: moneyJSON(resp.GetExecutedCommission()),
+		Message:            resp.GetMessage(),
 	}
-	return mcp.NewToolResultText(fmt.Sprintf("Отправлена заявка на продажу %d лотов %s (%s)", lots, inst.GetName(), inst.GetTicker())), nil
+	return mcp.NewToolResultStructured(result, strings.Join(lines, "\n")), nil
 }
 
-func portfolioHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
-	ops := ic.sdk.NewOperationsServiceClient()
-	if ic.accountID == "" {
-		return mcp.NewToolResultError("Ошибка получения портфеля: AccountID не задан. Укажите переменную окружения TINKOFF_ACCOUNT_ID либо откройте счёт и перезапустите сервер."), nil
+// loadPortfolio запрашивает портфель выбранного счёта с понятными ошибками для типичных проблем конфигурации
+func loadPortfolio(ic *InvestClient) (*investgo.PortfolioResponse, error) {
+	return loadAccountPortfolio(ic, ic.accountID)
+}
+
+func loadAccountPortfolio(ic *InvestClient, accountID string) (*investgo.PortfolioResponse, error) {
+	if accountID == "" {
+		return nil, fmt.Errorf("AccountID не задан. Укажите переменную окружения TINKOFF_ACCOUNT_ID либо откройте счёт и перезапустите сервер.")
 	}
-	pf, err := ops.GetPortfolio(ic.accountID, pb.PortfolioRequest_CurrencyRequest(0))
+	ops := ic.sdk.NewOperationsServiceClient()
+	pf, err := ops.GetPortfolio(accountID, pb.PortfolioRequest_CurrencyRequest(0))
 	if err != nil {
 		if s, ok := status.FromError(err); ok && s.Code() == codes.NotFound {
-			return mcp.NewToolResultError("Ошибка получения портфеля: счёт не найден (NotFound/50004). Проверьте: корректность AccountID, соответствие endpoint среде (sandbox vs prod), и права токена."), nil
+			return nil, fmt.Errorf("счёт не найден (NotFound/50004). Проверьте: корректность AccountID, соответствие endpoint среде (sandbox vs prod), и права токена.")
 		}
+		return nil, err
+	}
+	return pf, nil
+}
+
+// PositionJSON — позиция портфеля
+type PositionJSON struct {
+	Figi           string     `json:"figi"`
+	InstrumentUid  string     `json:"instrument_uid"`
+	InstrumentType string     `json:"instrument_type"`
+	Quantity       string     `json:"quantity"`
+	QuantityLots   string     `json:"quantity_lots"`
+	AveragePrice   *MoneyJSON `json:"average_position_price,omitempty"`
+	CurrentPrice   *MoneyJSON `json:"current_price,omitempty"`
+	CurrentNkd     *MoneyJSON `json:"current_nkd,omitempty"`
+	ExpectedYield  string     `json:"expected_yield,omitempty"`
+	Blocked        bool       `json:"blocked,omitempty"`
+}
+
+// PortfolioOutput — структурированный результат portfolio
+type PortfolioOutput struct {
+	AccountId     string         `json:"account_id"`
+	TotalAmount   *MoneyJSON     `json:"total_amount_portfolio,omitempty"`
+	ExpectedYield string         `json:"expected_yield_pct,omitempty"`
+	Positions     []PositionJSON `json:"positions"`
+}
+
+func portfolioJSON(pf *investgo.PortfolioResponse) PortfolioOutput {
+	out := PortfolioOutput{
+		AccountId:     pf.GetAccountId(),
+		TotalAmount:   moneyJSON(pf.GetTotalAmountPortfolio()),
+		ExpectedYield: quotationJSON(pf.GetExpectedYield()),
+		Positions:     make([]PositionJSON, 0, len(pf.GetPositions())),
+	}
+	for _, pos := range pf.GetPositions() {
+		out.Positions = append(out.Positions, PositionJSON{
+			Figi: pos.GetFigi(), InstrumentUid: pos.GetInstrumentUid(), InstrumentType: pos.GetInstrumentType(),
+			Quantity: quotationJSON(pos.GetQuantity()), QuantityLots: quotationJSON(pos.GetQuantityLots()),
+			AveragePrice: moneyJSON(pos.GetAveragePositionPrice()), CurrentPrice: moneyJSON(pos.GetCurrentPrice()),
+			CurrentNkd: moneyJSON(pos.GetCurrentNkd()), ExpectedYield: quotationJSON(pos.GetExpectedYield()),
+			Blocked: pos.GetBlocked(),
+		})
+	}
+	return out
+}
+
+func portfolioHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	pf, err := loadPortfolio(ic)
+	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("Ошибка получения портфеля: %v", err)), nil
 	}
 	var lines []string
@@ -379,17 +787,21 @@ func portfolioHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestCl
 			pos.GetInstrumentType(),
 		))
 	}
+	result := portfolioJSON(pf)
 	if len(lines) == 0 {
-		return mcp.NewToolResultText("Портфель пуст"), nil
+		return mcp.NewToolResultStructured(result, "Портфель пуст"), nil
 	}
-	return mcp.NewToolResultText("Текущий портфель:\n" + formatList(lines)), nil
+	return mcp.NewToolResultStructured(result, "Текущий портфель:\n"+formatList(lines)), nil
 }
 
 // Market Data handlers
 type InstrumentRef struct {
-	Figi   string
-	Ticker string
-	Name   string
+	Figi      string
+	Uid       string
+	Ticker    string
+	ClassCode string
+	Name      string
+	Kind      pb.InstrumentType
 }
 
 func findInstrumentRef(ic *InvestClient, q string) (*InstrumentRef, error) {
@@ -403,34 +815,107 @@ func findInstrumentRef(ic *InvestClient, q string) (*InstrumentRef, error) {
 	}
 	it := resp.GetInstruments()[0]
 	return &InstrumentRef{
-		Figi:   it.GetFigi(),
-		Ticker: it.GetTicker(),
-		Name:   it.GetName(),
+		Figi:      it.GetFigi(),
+		Uid:       it.GetUid(),
+		Ticker:    it.GetTicker(),
+		ClassCode: it.GetClassCode(),
+		Name:      it.GetName(),
+		Kind:      it.GetInstrumentKind(),
 	}, nil
 }
 
+// findTradableRef подбирает инструмент для торговой заявки: точное совпадение тикера
+// или FIGI/UID приоритетнее, затем доступные для торговли через API, затем первый результат.
+func findTradableRef(ic *InvestClient, q string) (*InstrumentRef, error) {
+	instruments := ic.sdk.NewInstrumentsServiceClient()
+	resp, err := instruments.FindInstrument(q)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска инструмента: %w", err)
+	}
+	found := resp.GetInstruments()
+	if len(found) == 0 {
+		return nil, fmt.Errorf("инструмент %q не найден", q)
+	}
+	best := found[0]
+	bestScore := -1
+	for _, it := range found {
+		score := 0
+		if strings.EqualFold(it.GetTicker(), q) || strings.EqualFold(it.GetFigi(), q) || strings.EqualFold(it.GetUid(), q) {
+			score += 2
+		}
+		if it.GetApiTradeAvailableFlag() {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = it, score
+		}
+	}
+	return &InstrumentRef{
+		Figi:      best.GetFigi(),
+		Uid:       best.GetUid(),
+		Ticker:    best.GetTicker(),
+		ClassCode: best.GetClassCode(),
+		Name:      best.GetName(),
+		Kind:      best.GetInstrumentKind(),
+	}, nil
+}
+
+// findInstrumentRefs разрешает несколько запросов; ненайденные возвращаются текстом ошибки
+func findInstrumentRefs(ic *InvestClient, queries []string) ([]*InstrumentRef, []string) {
+	var refs []*InstrumentRef
+	var failed []string
+	for _, q := range queries {
+		ref, err := findInstrumentRef(ic, q)
+		if err != nil {
+			failed = append(failed, err.Error())
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	return refs, failed
+}
+
+// lastPriceHandler — последние цены и изменение к закрытию по списку инструментов:
+// по одному пакетному запросу GetLastPrices и GetClosePrices на весь список
 func lastPriceHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
-	q, _ := req.RequireString("query")
-	inst, err := findInstrumentRef(ic, q)
+	refs, failed := findInstrumentRefs(ic, stringListArg(req, "query"))
+	if len(refs) == 0 {
+		msg := "Не указаны инструменты (query)"
+		if len(failed) > 0 {
+			msg = strings.Join(failed, "\n")
+		}
+		return mcp.NewToolResultError(msg), nil
+	}
+	seen := make(map[string]bool, len(refs))
+	unique := refs[:0]
+	for _, r := range refs {
+		if !seen[r.Uid] {
+			seen[r.Uid] = true
+			unique = append(unique, r)
+		}
+	}
+	rows, closeErr, err := loadQuotes(ic, unique)
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	md := ic.sdk.NewMarketDataServiceClient()
-	lpResp, err := md.GetLastPrices([]string{inst.Figi})
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Ошибка получения последней цены: %v", err)), nil
+	result := quotesJSON(rows, closeErr)
+	result.NotFound = failed
+	var text string
+	if len(rows) == 1 {
+		text = fmt.Sprintf("%s, FIGI %s", formatQuoteRow(rows[0]), rows[0].Ref.Figi)
+	} else {
+		lines := make([]string, 0, len(rows))
+		for _, r := range rows {
+			lines = append(lines, formatQuoteRow(r))
+		}
+		text = fmt.Sprintf("Котировки (%d):\n%s", len(rows), formatList(lines))
 	}
-	lps := lpResp.GetLastPrices()
-	if len(lps) == 0 {
-		return mcp.NewToolResultText("Нет данных о последней цене"), nil
+	if len(failed) > 0 {
+		text = strings.TrimRight(text, "\n") + "\nНе найдены:\n" + formatList(failed)
 	}
-	lp := lps[0]
-	price := lp.GetPrice()
-	ts := lp.GetTime().AsTime()
-	text := fmt.Sprintf("%s (%s), FIGI %s — последняя цена: %s, время: %s",
-		inst.Name, inst.Ticker, inst.Figi, quotationToStr(price), ts.Format(time.RFC3339))
-	return mcp.NewToolResultText(text), nil
+	text = strings.TrimRight(text, "\n") + closeErrorNote(closeErr)
+	return mcp.NewToolResultStructured(result, text), nil
 }
 
 func orderbookHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
@@ -449,30 +934,50 @@ func orderbookHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestCl
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
+	lots := int64(req.GetInt("lots", 0))
+	if lots < 0 {
+		return mcp.NewToolResultError("lots не может быть отрицательным"), nil
+	}
+
 	md := ic.sdk.NewMarketDataServiceClient()
-	ob, err := md.GetOrderBook(inst.Figi, depth)
+	ob, err := md.GetOrderBook(inst.Uid, depth)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("Ошибка получения стакана: %v", err)), nil
 	}
+	// количество в стакане — в лотах; лотность нужна для сумм в деньгах
+	lot := int32(1)
+	lotNote := ""
+	card, err := loadInstrumentCard(ic, inst, false)
+	lotKnown := err == nil && card.Lot > 0
+	if lotKnown {
+		lot = card.Lot
+	} else {
+		lotNote = " (лотность неизвестна, суммы посчитаны для лота 1)"
+	}
 
+	m := newOrderbookMetrics(ob.GetBids(), ob.GetAsks(), ob.GetLimitUp(), ob.GetLimitDown(), depth, lot, lots)
 	var lines []string
 	lines = append(lines, fmt.Sprintf("Стакан %s (%s), FIGI %s, глубина %d", inst.Name, inst.Ticker, inst.Figi, depth))
 	lines = append(lines, "BIDS (покупка):")
-	for i, b := range ob.GetBids() {
-		if int32(i) >= depth {
-			break
-		}
-		lines = append(lines, fmt.Sprintf("  #%d %s × %d", i+1, quotationToStr(b.GetPrice()), b.GetQuantity()))
-	}
+	lines = append(lines, formatBookSide(m.Bids)...)
 	lines = append(lines, "ASKS (продажа):")
-	for i, a := range ob.GetAsks() {
-		if int32(i) >= depth {
-			break
-		}
-		lines = append(lines, fmt.Sprintf("  #%d %s × %d", i+1, quotationToStr(a.GetPrice()), a.GetQuantity()))
+	lines = append(lines, formatBookSide(m.Asks)...)
+	lines = append(lines, "Аналитика"+lotNote+":")
+	for _, l := range m.analytics() {
+		lines = append(lines, "  "+l)
 	}
+	return mcp.NewToolResultStructured(m.JSON(inst, ob.GetOrderBookResponse, depth, lotKnown), strings.Join(lines, "\n")), nil
+}
 
-	return mcp.NewToolResultText(strings.Join(lines, "\n")), nil
+// CandlesOutput — структурированный результат candles: первые 50 свечей, как и в тексте;
+// все свечи периода отдаёт export_candles
+type CandlesOutput struct {
+	Instrument InstrumentJSON `json:"instrument"`
+	Interval   string         `json:"interval"`
+	From       string         `json:"from"`
+	To         string         `json:"to"`
+	Total      int            `json:"total"`
+	Candles    []exportCandle `json:"candles"`
 }
 
 func candlesHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
@@ -481,35 +986,21 @@ func candlesHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClie
 	toStr, _ := req.RequireString("to")
 	intervalStr, _ := req.RequireString("interval")
 
-	from, err := time.Parse(time.RFC3339, fromStr)
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Некорректный формат from: %v", err)), nil
-	}
-	to, err := time.Parse(time.RFC3339, toStr)
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Некорректный формат to: %v", err)), nil
-	}
-	if !to.After(from) {
-		return mcp.NewToolResultError("Параметр 'to' должен быть позже, чем 'from'"), nil
-	}
-	interval, err := parseCandleInterval(intervalStr)
-	if err != nil {
-		return mcp.NewToolResultError(err.Error()), nil
-	}
-
-	inst, err := findInstrumentRef(ic, q)
+	cq, err := parseCandleQuery(ic, q, fromStr, toStr, intervalStr)
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
-
-	md := ic.sdk.NewMarketDataServiceClient()
-	candlesResp, err := md.GetCandles(inst.Figi, interval, from, to)
+	inst, from, to := cq.Inst, cq.From, cq.To
+	candles, err := cq.load(ctx, ic, newWindowProgress(toolProgress(ctx, req)))
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("Ошибка получения свечей: %v", err)), nil
 	}
-	candles := candlesResp.GetCandles()
+	result := CandlesOutput{
+		Instrument: inst.JSON(), Interval: strings.ToLower(intervalStr),
+		From: timeJSON(from), To: timeJSON(to), Total: len(candles), Candles: []exportCandle{},
+	}
 	if len(candles) == 0 {
-		return mcp.NewToolResultText("Свечи не найдены за указанный период"), nil
+		return mcp.NewToolResultStructured(result, "Свечи не найдены за указанный период"), nil
 	}
 
 	var out []string
@@ -531,30 +1022,138 @@ func candlesHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClie
 		cl := quotationToStr(c.GetClose())
 		v := c.GetVolume()
 		out = append(out, fmt.Sprintf(" - %s  O:%s H:%s L:%s C:%s V:%d", ts, o, h, l, cl, v))
+		result.Candles = append(result.Candles, toExportCandle(c))
 	}
 	if len(candles) > limit {
 		out = append(out, fmt.Sprintf(" ... и ещё %d свечей", len(candles)-limit))
 	}
 
-	return mcp.NewToolResultText(strings.Join(out, "\n")), nil
+	return mcp.NewToolResultStructured(result, strings.Join(out, "\n")), nil
+}
+
+// TradingStatusJSON — статус торгов инструмента
+type TradingStatusJSON struct {
+	Instrument           InstrumentJSON `json:"instrument"`
+	Status               string         `json:"status,omitempty"`
+	StatusText           string         `json:"status_text,omitempty"`
+	LimitOrderAvailable  bool           `json:"limit_order_available"`
+	MarketOrderAvailable bool           `json:"market_order_available"`
+	ApiTradeAvailable    bool           `json:"api_trade_available"`
+	Exchange             string         `json:"exchange,omitempty"`
+	NextOpen             string         `json:"next_open,omitempty"`
+	Error                string         `json:"error,omitempty"`
+}
+
+// TradingStatusOutput — структурированный результат trading_status
+type TradingStatusOutput struct {
+	Statuses []TradingStatusJSON `json:"statuses"`
+	NotFound []string            `json:"not_found,omitempty"`
 }
 
 func tradingStatusHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
-	q, _ := req.RequireString("query")
-	inst, err := findInstrumentRef(ic, q)
-	if err != nil {
-		return mcp.NewToolResultError(err.Error()), nil
+	queries := stringListArg(req, "query")
+	if len(queries) == 0 {
+		return mcp.NewToolResultError("Не указан query"), nil
+	}
+	refs, failed := findInstrumentRefs(ic, queries)
+	if len(refs) == 0 {
+		return mcp.NewToolResultError(strings.Join(failed, "\n")), nil
 	}
 
+	ids := make([]string, 0, len(refs))
+	for _, r := range refs {
+		ids = append(ids, r.Uid)
+	}
 	md := ic.sdk.NewMarketDataServiceClient()
-	st, err := md.GetTradingStatus(inst.Figi)
+	resp, err := md.GetTradingStatuses(ids)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("Ошибка получения статуса торгов: %v", err)), nil
 	}
+	statuses := make(map[string]*pb.GetTradingStatusResponse)
+	for _, st := range resp.GetTradingStatuses() {
+		statuses[st.GetInstrumentUid()] = st
+		statuses[st.GetFigi()] = st
+	}
 
-	text := fmt.Sprintf("Статус торгов для %s (%s), FIGI %s: %v",
-		inst.Name, inst.Ticker, inst.Figi, st.GetTradingStatus())
-	return mcp.NewToolResultText(text), nil
+	instruments := ic.sdk.NewInstrumentsServiceClient()
+	now := time.Now().UTC()
+	type nextOpen struct {
+		at  time.Time
+		err error
+	}
+	opens := make(map[string]nextOpen) // площадка -> ближайшее открытие торгов
+	result := TradingStatusOutput{Statuses: make([]TradingStatusJSON, 0, len(refs)), NotFound: failed}
+	var lines []string
+	for _, inst := range refs {
+		row := tradingStatusRow{Inst: inst}
+		if st, ok := lookupByIds(statuses, inst); ok {
+			row.Status = st
+			// ближайшее открытие торгов берём из расписания площадки инструмента; ошибка не критична
+			if full, err := instruments.InstrumentByUid(inst.Uid); err == nil {
+				row.Exchange = full.GetInstrument().GetExchange()
+				next, ok := opens[row.Exchange]
+				if !ok {
+					next.at, next.err = nextSessionOpen(ic, row.Exchange, now)
+					opens[row.Exchange] = next
+				}
+				row.NextOpen, row.NextOpenErr = next.at, next.err
+			}
+		}
+		lines = append(lines, row.lines()...)
+		result.Statuses = append(result.Statuses, row.JSON())
+	}
+	lines = append(lines, failed...)
+	return mcp.NewToolResultStructured(result, strings.Join(lines, "\n")), nil
+}
+
+// tradingStatusRow — статус торгов инструмента и ближайшее открытие его площадки;
+// из него строятся и текст, и структурированный вывод trading_status
+type tradingStatusRow struct {
+	Inst        *InstrumentRef
+	Status      *pb.GetTradingStatusResponse // nil — статус не получен
+	Exchange    string                       // пусто — площадку определить не удалось
+	NextOpen    time.Time
+	NextOpenErr error
+}
+
+func (r tradingStatusRow) lines() []string {
+	inst, st := r.Inst, r.Status
+	if st == nil {
+		return []string{fmt.Sprintf("%s (%s), FIGI %s: статус не получен", inst.Name, inst.Ticker, inst.Figi)}
+	}
+	lines := []string{
+		fmt.Sprintf("Статус торгов для %s (%s), FIGI %s: %s (%v)", inst.Name, inst.Ticker, inst.Figi,
+			tradingStatusText(st.GetTradingStatus()), st.GetTradingStatus()),
+		fmt.Sprintf("  Лимитные заявки: %s, рыночные заявки: %s, торговля через API: %s",
+			yesNo(st.GetLimitOrderAvailableFlag()), yesNo(st.GetMarketOrderAvailableFlag()), yesNo(st.GetApiTradeAvailableFlag())),
+	}
+	if r.Exchange != "" {
+		desc := r.NextOpen.UTC().Format(time.RFC3339)
+		if r.NextOpenErr != nil {
+			desc = fmt.Sprintf("неизвестно (%v)", r.NextOpenErr)
+		}
+		lines = append(lines, fmt.Sprintf("  Площадка %s, ближайшее открытие торгов: %s", r.Exchange, desc))
+	}
+	return lines
+}
+
+func (r tradingStatusRow) JSON() TradingStatusJSON {
+	st := r.Status
+	if st == nil {
+		return TradingStatusJSON{Instrument: r.Inst.JSON(), Error: "статус не получен"}
+	}
+	out := TradingStatusJSON{
+		Instrument: r.Inst.JSON(), Status: tradingStatusName(st.GetTradingStatus()),
+		StatusText:           tradingStatusText(st.GetTradingStatus()),
+		LimitOrderAvailable:  st.GetLimitOrderAvailableFlag(),
+		MarketOrderAvailable: st.GetMarketOrderAvailableFlag(),
+		ApiTradeAvailable:    st.GetApiTradeAvailableFlag(),
+		Exchange:             r.Exchange,
+	}
+	if r.Exchange != "" && r.NextOpenErr == nil {
+		out.NextOpen = timeJSON(r.NextOpen)
+	}
+	return out
 }
 
 // Вспомогательные функции
@@ -562,16 +1161,32 @@ func parseCandleInterval(s string) (pb.CandleInterval, error) {
 	switch strings.ToLower(strings.TrimSpace(s)) {
 	case "1m", "1min":
 		return pb.CandleInterval_CANDLE_INTERVAL_1_MIN, nil
+	case "2m", "2min":
+		return pb.CandleInterval_CANDLE_INTERVAL_2_MIN, nil
+	case "3m", "3min":
+		return pb.CandleInterval_CANDLE_INTERVAL_3_MIN, nil
 	case "5m", "5min":
 		return pb.CandleInterval_CANDLE_INTERVAL_5_MIN, nil
+	case "10m", "10min":
+		return pb.CandleInterval_CANDLE_INTERVAL_10_MIN, nil
 	case "15m", "15min":
 		return pb.CandleInterval_CANDLE_INTERVAL_15_MIN, nil
+	case "30m", "30min":
+		return pb.CandleInterval_CANDLE_INTERVAL_30_MIN, nil
 	case "1h", "60m":
 		return pb.CandleInterval_CANDLE_INTERVAL_HOUR, nil
+	case "2h", "120m":
+		return pb.CandleInterval_CANDLE_INTERVAL_2_HOUR, nil
+	case "4h", "240m":
+		return pb.CandleInterval_CANDLE_INTERVAL_4_HOUR, nil
 	case "1d", "1day", "day", "d":
 		return pb.CandleInterval_CANDLE_INTERVAL_DAY, nil
+	case "1w", "week", "w":
+		return pb.CandleInterval_CANDLE_INTERVAL_WEEK, nil
+	case "1mo", "month", "mo":
+		return pb.CandleInterval_CANDLE_INTERVAL_MONTH, nil
 	default:
-		return 0, fmt.Errorf("неизвестный interval %q. Допустимо: 1m,5m,15m,1h,1d", s)
+		return 0, fmt.Errorf("неизвестный interval %q. Допустимо: 1m,2m,3m,5m,10m,15m,30m,1h,2h,4h,1d,week,month", s)
 	}
 }
 
@@ -579,6 +1194,42 @@ func quotationToStr(q *pb.Quotation) string {
 	return decimalToStr(q.GetUnits(), q.GetNano())
 }
 
+func quotationToFloat(q *pb.Quotation) float64 {
+	return float64(q.GetUnits()) + float64(q.GetNano())/1e9
+}
+
+func moneyToFloat(m *pb.MoneyValue) float64 {
+	return float64(m.GetUnits()) + float64(m.GetNano())/1e9
+}
+
+func moneyToStr(m *pb.MoneyValue) string {
+	if m == nil {
+		return "-"
+	}
+	return decimalToStr(m.GetUnits(), m.GetNano()) + " " + strings.ToUpper(m.GetCurrency())
+}
+
+func formatDate(ts *timestamppb.Timestamp) string {
+	if ts == nil || (ts.GetSeconds() == 0 && ts.GetNanos() == 0) {
+		return "-"
+	}
+	return ts.AsTime().UTC().Format("2006-01-02")
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "да"
+	}
+	return "нет"
+}
+
+func valueOrDash(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "-"
+	}
+	return s
+}
+
 func formatList(items []string) string {
 	result := ""
 	for _, item := range items {
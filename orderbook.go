@@ -0,0 +1,319 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/shopspring/decimal"
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+)
+
+// imbalanceDepths — глубины, на которых считается дисбаланс bid/ask
+var imbalanceDepths = []int{1, 5, 10}
+
+var bpsFactor = decimal.NewFromInt(10000)
+
+// bookFill — результат исполнения объёма по стакану: сколько лотов набрано и по какой цене
+type bookFill struct {
+	Lots     int64
+	Cost     decimal.Decimal // в валюте цены: Σ цена × лоты × лотность
+	AvgPrice decimal.Decimal
+}
+
+// fillOrders проходит уровни стакана от лучшего, пока не наберёт lots лотов
+func fillOrders(orders []*pb.Order, lots int64, lot int32) bookFill {
+	var f bookFill
+	var notional decimal.Decimal
+	for _, o := range orders {
+		if f.Lots >= lots {
+			break
+		}
+		take := o.GetQuantity()
+		if take > lots-f.Lots {
+			take = lots - f.Lots
+		}
+		notional = notional.Add(quotationDecimal(o.GetPrice()).Mul(decimal.NewFromInt(take)))
+		f.Lots += take
+	}
+	if f.Lots > 0 {
+		f.AvgPrice = notional.DivRound(decimal.NewFromInt(f.Lots), 9)
+		f.Cost = notional.Mul(decimal.NewFromInt(int64(lot)))
+	}
+	return f
+}
+
+// sideQuantity — суммарное количество лотов на первых n уровнях
+func sideQuantity(orders []*pb.Order, n int) int64 {
+	var q int64
+	for i, o := range orders {
+		if i >= n {
+			break
+		}
+		q += o.GetQuantity()
+	}
+	return q
+}
+
+// bookImbalance — (bid − ask) / (bid + ask) по количеству лотов: от −1 (только продавцы) до +1 (только покупатели)
+func bookImbalance(bids, asks []*pb.Order, n int) (float64, bool) {
+	b, a := sideQuantity(bids, n), sideQuantity(asks, n)
+	if b+a == 0 {
+		return 0, false
+	}
+	return float64(b-a) / float64(b+a), true
+}
+
+// bookLevel — уровень стакана с накопленным объёмом в лотах и в деньгах
+type bookLevel struct {
+	Price    *pb.Quotation
+	Lots     int64
+	CumLots  int64
+	CumMoney decimal.Decimal
+}
+
+// bookFillMetrics — исполнение lots лотов рыночной заявкой и проскальзывание к лучшей цене
+type bookFillMetrics struct {
+	Lots     int64
+	Fill     bookFill
+	Slippage decimal.NullDecimal // в bps
+}
+
+// bookImbalanceAt — дисбаланс на глубине Depth уровней; Full — по всему стакану
+type bookImbalanceAt struct {
+	Depth int
+	Full  bool
+	Value float64
+}
+
+// orderbookMetrics — показатели стакана, из которых строятся и текст, и структурированный вывод
+type orderbookMetrics struct {
+	Lot                           int32
+	Bids, Asks                    []bookLevel
+	HasTop                        bool // обе стороны непусты: лучшие цены, mid и спред определены
+	BestBid, BestAsk, Mid, Spread decimal.Decimal
+	SpreadBps                     decimal.NullDecimal
+	Imbalance                     []bookImbalanceAt
+	BidMoney, AskMoney            decimal.Decimal
+	Buy, Sell                     *bookFillMetrics // только при lots > 0
+	LimitUp, LimitDown            *pb.Quotation
+}
+
+// bookLevels — первые depth уровней стороны стакана с накопленным объёмом
+func bookLevels(orders []*pb.Order, depth int32, lot int32) []bookLevel {
+	levels := make([]bookLevel, 0, len(orders))
+	var cumLots int64
+	var cumMoney decimal.Decimal
+	for i, o := range orders {
+		if int32(i) >= depth {
+			break
+		}
+		cumLots += o.GetQuantity()
+		cumMoney = cumMoney.Add(quotationDecimal(o.GetPrice()).Mul(decimal.NewFromInt(o.GetQuantity() * int64(lot))))
+		levels = append(levels, bookLevel{Price: o.GetPrice(), Lots: o.GetQuantity(), CumLots: cumLots, CumMoney: cumMoney})
+	}
+	return levels
+}
+
+func fillMetrics(orders []*pb.Order, lots int64, lot int32) *bookFillMetrics {
+	m := &bookFillMetrics{Lots: lots, Fill: fillOrders(orders, lots, lot)}
+	if m.Fill.Lots == 0 {
+		return m
+	}
+	if best := quotationDecimal(orders[0].GetPrice()); best.IsPositive() {
+		m.Slippage = valid(m.Fill.AvgPrice.Sub(best).Abs().Mul(bpsFactor).DivRound(best, 2))
+	}
+	return m
+}
+
+// newOrderbookMetrics — спред, mid, дисбаланс, глубина в деньгах, стоимость исполнения lots лотов и ценовые лимиты
+func newOrderbookMetrics(bids, asks []*pb.Order, limitUp, limitDown *pb.Quotation, depth int32, lot int32, lots int64) orderbookMetrics {
+	m := orderbookMetrics{
+		Lot:  lot,
+		Bids: bookLevels(bids, depth, lot), Asks: bookLevels(asks, depth, lot),
+		BidMoney: fillOrders(bids, sideQuantity(bids, len(bids)), lot).Cost,
+		AskMoney: fillOrders(asks, sideQuantity(asks, len(asks)), lot).Cost,
+		LimitUp:  limitUp, LimitDown: limitDown,
+	}
+	if len(bids) > 0 && len(asks) > 0 {
+		m.HasTop = true
+		m.BestBid, m.BestAsk = quotationDecimal(bids[0].GetPrice()), quotationDecimal(asks[0].GetPrice())
+		m.Mid = m.BestBid.Add(m.BestAsk).Div(decimal.NewFromInt(2))
+		m.Spread = m.BestAsk.Sub(m.BestBid)
+		if m.Mid.IsPositive() {
+			m.SpreadBps = valid(m.Spread.Mul(bpsFactor).DivRound(m.Mid, 2))
+		}
+	}
+	all, shown := max(len(bids), len(asks)), 0
+	for _, n := range imbalanceDepths {
+		if n > all {
+			break
+		}
+		if v, ok := bookImbalance(bids, asks, n); ok {
+			m.Imbalance = append(m.Imbalance, bookImbalanceAt{Depth: n, Value: math.Round(v*1000) / 1000})
+		}
+		shown = n
+	}
+	if all > shown {
+		if v, ok := bookImbalance(bids, asks, all); ok {
+			m.Imbalance = append(m.Imbalance, bookImbalanceAt{Depth: all, Full: true, Value: math.Round(v*1000) / 1000})
+		}
+	}
+	if lots > 0 {
+		m.Buy, m.Sell = fillMetrics(asks, lots, lot), fillMetrics(bids, lots, lot)
+	}
+	return m
+}
+
+// formatBookSide — уровни стакана с накопленным объёмом в лотах и в деньгах
+func formatBookSide(levels []bookLevel) []string {
+	lines := make([]string, 0, len(levels))
+	for i, l := range levels {
+		lines = append(lines, fmt.Sprintf("  #%d %s × %d (накопл. %d лот., %s)",
+			i+1, quotationToStr(l.Price), l.Lots, l.CumLots, l.CumMoney.Round(2).String()))
+	}
+	return lines
+}
+
+// analytics — строки блока «Аналитика» текстового ответа
+func (m orderbookMetrics) analytics() []string {
+	var lines []string
+	if m.HasTop {
+		line := fmt.Sprintf("Лучшие bid/ask: %s / %s, mid: %s, спред: %s", m.BestBid.String(), m.BestAsk.String(), m.Mid.String(), m.Spread.String())
+		if m.SpreadBps.Valid {
+			line += fmt.Sprintf(" (%s bps)", m.SpreadBps.Decimal.String())
+		}
+		lines = append(lines, line)
+	} else {
+		lines = append(lines, "Одна из сторон стакана пуста: спред и mid не определены")
+	}
+
+	var parts []string
+	for _, im := range m.Imbalance {
+		if im.Full {
+			parts = append(parts, fmt.Sprintf("весь стакан %+.3f", im.Value))
+		} else {
+			parts = append(parts, fmt.Sprintf("топ-%d %+.3f", im.Depth, im.Value))
+		}
+	}
+	if len(parts) > 0 {
+		lines = append(lines, "Дисбаланс (bid−ask)/(bid+ask): "+strings.Join(parts, ", "))
+	}
+
+	lines = append(lines, fmt.Sprintf("Глубина в деньгах (лот %d): bid %s, ask %s", m.Lot, m.BidMoney.Round(2).String(), m.AskMoney.Round(2).String()))
+	if m.Buy != nil {
+		lines = append(lines, formatFill("Покупка", m.Buy), formatFill("Продажа", m.Sell))
+	}
+	if m.LimitUp != nil || m.LimitDown != nil {
+		lines = append(lines, fmt.Sprintf("Лимиты цены: нижний %s, верхний %s", quotationToStr(m.LimitDown), quotationToStr(m.LimitUp)))
+	}
+	return lines
+}
+
+// formatFill — стоимость исполнения рыночной заявки и проскальзывание к лучшей цене
+func formatFill(side string, m *bookFillMetrics) string {
+	f := m.Fill
+	if f.Lots == 0 {
+		return fmt.Sprintf("%s %d лот.: нет встречных заявок", side, m.Lots)
+	}
+	line := fmt.Sprintf("%s %d лот.: средняя цена %s, сумма %s", side, m.Lots, f.AvgPrice.Round(6).String(), f.Cost.Round(2).String())
+	if m.Slippage.Valid {
+		line += fmt.Sprintf(", проскальзывание %s bps", m.Slippage.Decimal.String())
+	}
+	if f.Lots < m.Lots {
+		line += fmt.Sprintf(" — глубины хватает только на %d лот.", f.Lots)
+	}
+	return line
+}
+
+// BookLevelJSON — уровень стакана с накопленным объёмом
+type BookLevelJSON struct {
+	Price    string `json:"price"`
+	Lots     int64  `json:"lots"`
+	CumLots  int64  `json:"cum_lots"`
+	CumMoney string `json:"cum_money"`
+}
+
+// BookFillJSON — исполнение объёма рыночной заявкой по стакану
+type BookFillJSON struct {
+	Lots        int64  `json:"lots"`
+	FilledLots  int64  `json:"filled_lots"`
+	AvgPrice    string `json:"avg_price,omitempty"`
+	Cost        string `json:"cost,omitempty"`
+	SlippageBps string `json:"slippage_bps,omitempty"`
+}
+
+// ImbalanceJSON — дисбаланс на глубине Depth уровней
+type ImbalanceJSON struct {
+	Depth int     `json:"depth"`
+	Value float64 `json:"value"`
+}
+
+// OrderbookOutput — структурированный результат orderbook
+type OrderbookOutput struct {
+	Instrument InstrumentJSON  `json:"instrument"`
+	Depth      int32           `json:"depth"`
+	Lot        int32           `json:"lot"`
+	LotKnown   bool            `json:"lot_known"`
+	Time       string          `json:"time,omitempty"`
+	Bids       []BookLevelJSON `json:"bids"`
+	Asks       []BookLevelJSON `json:"asks"`
+	BestBid    string          `json:"best_bid,omitempty"`
+	BestAsk    string          `json:"best_ask,omitempty"`
+	Mid        string          `json:"mid,omitempty"`
+	Spread     string          `json:"spread,omitempty"`
+	SpreadBps  string          `json:"spread_bps,omitempty"`
+	Imbalance  []ImbalanceJSON `json:"imbalance"`
+	BidMoney   string          `json:"bid_money"`
+	AskMoney   string          `json:"ask_money"`
+	Buy        *BookFillJSON   `json:"buy,omitempty"`
+	Sell       *BookFillJSON   `json:"sell,omitempty"`
+	LimitUp    string          `json:"limit_up,omitempty"`
+	LimitDown  string          `json:"limit_down,omitempty"`
+}
+
+func bookSideJSON(levels []bookLevel) []BookLevelJSON {
+	out := make([]BookLevelJSON, 0, len(levels))
+	for _, l := range levels {
+		out = append(out, BookLevelJSON{Price: quotationJSON(l.Price), Lots: l.Lots, CumLots: l.CumLots, CumMoney: l.CumMoney.Round(2).String()})
+	}
+	return out
+}
+
+func fillJSON(m *bookFillMetrics) *BookFillJSON {
+	if m == nil {
+		return nil
+	}
+	out := &BookFillJSON{Lots: m.Lots, FilledLots: m.Fill.Lots}
+	if m.Fill.Lots == 0 {
+		return out
+	}
+	out.AvgPrice, out.Cost = m.Fill.AvgPrice.Round(6).String(), m.Fill.Cost.Round(2).String()
+	if m.Slippage.Valid {
+		out.SlippageBps = m.Slippage.Decimal.String()
+	}
+	return out
+}
+
+// JSON — структурированный вывод orderbook из тех же показателей, что и текст
+func (m orderbookMetrics) JSON(inst *InstrumentRef, ob *pb.GetOrderBookResponse, depth int32, lotKnown bool) OrderbookOutput {
+	out := OrderbookOutput{
+		Instrument: inst.JSON(), Depth: depth, Lot: m.Lot, LotKnown: lotKnown,
+		Time: timestampJSON(ob.GetOrderbookTs()),
+		Bids: bookSideJSON(m.Bids), Asks: bookSideJSON(m.Asks),
+		Imbalance: make([]ImbalanceJSON, 0, len(m.Imbalance)),
+		BidMoney:  m.BidMoney.Round(2).String(), AskMoney: m.AskMoney.Round(2).String(),
+		Buy: fillJSON(m.Buy), Sell: fillJSON(m.Sell),
+		LimitUp: quotationJSON(m.LimitUp), LimitDown: quotationJSON(m.LimitDown),
+	}
+	if m.HasTop {
+		out.BestBid, out.BestAsk, out.Mid, out.Spread = m.BestBid.String(), m.BestAsk.String(), m.Mid.String(), m.Spread.String()
+		if m.SpreadBps.Valid {
+			out.SpreadBps = m.SpreadBps.Decimal.String()
+		}
+	}
+	for _, im := range m.Imbalance {
+		out.Imbalance = append(out.Imbalance, ImbalanceJSON{Depth: im.Depth, Value: im.Value})
+	}
+	return out
+}
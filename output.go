@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Структурированный вывод инструментов MCP: каждый инструмент наряду с текстом возвращает
+// structuredContent по объявленной outputSchema. Цены и суммы — десятичные строки без потери
+// точности, время — RFC3339 в UTC, пустые значения опускаются.
+
+// InstrumentJSON — идентификаторы инструмента
+type InstrumentJSON struct {
+	Figi      string `json:"figi"`
+	Uid       string `json:"uid"`
+	Ticker    string `json:"ticker"`
+	ClassCode string `json:"class_code"`
+	Name      string `json:"name"`
+	Kind      string `json:"kind,omitempty"`
+}
+
+// JSON — идентификаторы инструмента для структурированного вывода
+func (r *InstrumentRef) JSON() InstrumentJSON {
+	out := InstrumentJSON{Figi: r.Figi, Uid: r.Uid, Ticker: r.Ticker, ClassCode: r.ClassCode, Name: r.Name}
+	if r.Kind != pb.InstrumentType_INSTRUMENT_TYPE_UNSPECIFIED {
+		out.Kind = kindName(r.Kind)
+	}
+	return out
+}
+
+// MoneyJSON — денежная сумма: значение десятичной строкой и код валюты в нижнем регистре
+type MoneyJSON struct {
+	Value    string `json:"value"`
+	Currency string `json:"currency"`
+}
+
+func moneyJSON(m *pb.MoneyValue) *MoneyJSON {
+	if m == nil {
+		return nil
+	}
+	return &MoneyJSON{Value: decimalJSON(m.GetUnits(), m.GetNano()), Currency: strings.ToLower(m.GetCurrency())}
+}
+
+// quotationJSON — цена десятичной строкой без лишних нулей; для отсутствующей цены — пустая строка
+func quotationJSON(q *pb.Quotation) string {
+	if q == nil {
+		return ""
+	}
+	return decimalJSON(q.GetUnits(), q.GetNano())
+}
+
+func decimalJSON(units int64, nano int32) string {
+	s := decimalToStr(units, nano)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// floatJSON — рассчитанная сумма десятичной строкой с prec знаками после точки
+func floatJSON(v float64, prec int) string {
+	return strconv.FormatFloat(v, 'f', prec, 64)
+}
+
+// dateJSON — дата YYYY-MM-DD; для отсутствующей — пустая строка
+func dateJSON(ts *timestamppb.Timestamp) string {
+	if ts == nil || (ts.GetSeconds() == 0 && ts.GetNanos() == 0) {
+		return ""
+	}
+	return ts.AsTime().UTC().Format("2006-01-02")
+}
+
+func timestampJSON(ts *timestamppb.Timestamp) string {
+	if ts == nil || (ts.GetSeconds() == 0 && ts.GetNanos() == 0) {
+		return ""
+	}
+	return timeJSON(ts.AsTime())
+}
+
+func timeJSON(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
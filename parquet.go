@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// Минимальный писатель Parquet: одна группа строк, по одной несжатой странице данных PLAIN
+// на колонку, только обязательные (REQUIRED) плоские колонки INT64 и BOOLEAN.
+// Метаданные кодируются Thrift Compact Protocol вручную, чтобы не тянуть внешнюю зависимость.
+
+// Физические типы Parquet
+const (
+	parquetBoolean int32 = 0
+	parquetInt64   int32 = 2
+)
+
+// parquetColumn — колонка с уже закодированными PLAIN значениями
+type parquetColumn struct {
+	Name    string
+	Type    int32
+	Logical parquetLogical
+	data    bytes.Buffer
+	bools   []bool
+}
+
+// parquetLogical — логический тип колонки (ConvertedType и LogicalType)
+type parquetLogical int
+
+const (
+	logicalNone parquetLogical = iota
+	logicalTimestampMillisUTC
+	logicalDecimal18x9
+)
+
+func (c *parquetColumn) appendInt64(v int64) {
+	_ = binary.Write(&c.data, binary.LittleEndian, v)
+}
+
+func (c *parquetColumn) appendBool(v bool) {
+	c.bools = append(c.bools, v)
+}
+
+// pageData — значения колонки в PLAIN; булевы упаковываются по биту, младший бит первым
+func (c *parquetColumn) pageData() []byte {
+	if c.Type != parquetBoolean {
+		return c.data.Bytes()
+	}
+	out := make([]byte, (len(c.bools)+7)/8)
+	for i, v := range c.bools {
+		if v {
+			out[i/8] |= 1 << (i % 8)
+		}
+	}
+	return out
+}
+
+// writeParquet пишет файл Parquet из колонок одинаковой длины numRows
+func writeParquet(w io.Writer, numRows int, cols []*parquetColumn) error {
+	var file bytes.Buffer
+	file.WriteString("PAR1")
+
+	type chunk struct {
+		offset int64
+		size   int64
+	}
+	chunks := make([]chunk, len(cols))
+	for i, c := range cols {
+		data := c.pageData()
+		var hdr thriftWriter
+		hdr.fieldI32(1, 0) // type = DATA_PAGE
+		hdr.fieldI32(2, int32(len(data)))
+		hdr.fieldI32(3, int32(len(data)))
+		hdr.fieldStruct(5) // data_page_header
+		hdr.fieldI32(1, int32(numRows))
+		hdr.fieldI32(2, 0) // encoding = PLAIN
+		hdr.fieldI32(3, 3) // definition_level_encoding = RLE
+		hdr.fieldI32(4, 3) // repetition_level_encoding = RLE
+		hdr.structEnd()
+		hdr.structEnd()
+
+		chunks[i].offset = int64(file.Len())
+		file.Write(hdr.buf.Bytes())
+		file.Write(data)
+		chunks[i].size = int64(file.Len()) - chunks[i].offset
+	}
+
+	var meta thriftWriter
+	meta.fieldI32(1, 1) // version
+	meta.fieldList(2, thriftStruct, len(cols)+1)
+	meta.structBegin()
+	meta.fieldString(4, "schema")
+	meta.fieldI32(5, int32(len(cols)))
+	meta.structEnd()
+	for _, c := range cols {
+		meta.structBegin()
+		meta.fieldI32(1, c.Type)
+		meta.fieldI32(3, 0) // REQUIRED
+		meta.fieldString(4, c.Name)
+		c.Logical.write(&meta)
+		meta.structEnd()
+	}
+	meta.fieldI64(3, int64(numRows))
+	meta.fieldList(4, thriftStruct, 1)
+	meta.structBegin() // RowGroup
+	meta.fieldList(1, thriftStruct, len(cols))
+	var total int64
+	for i, c := range cols {
+		total += chunks[i].size
+		meta.structBegin() // ColumnChunk
+		meta.fieldI64(2, chunks[i].offset)
+		meta.fieldStruct(3) // ColumnMetaData
+		meta.fieldI32(1, c.Type)
+		meta.fieldList(2, thriftI32, 1)
+		meta.i32(0) // PLAIN
+		meta.fieldList(3, thriftBinary, 1)
+		meta.binary(c.Name)
+		meta.fieldI32(4, 0) // UNCOMPRESSED
+		meta.fieldI64(5, int64(numRows))
+		meta.fieldI64(6, chunks[i].size)
+		meta.fieldI64(7, chunks[i].size)
+		meta.fieldI64(9, chunks[i].offset)
+		meta.structEnd()
+		meta.structEnd()
+	}
+	meta.fieldI64(2, total)
+	meta.fieldI64(3, int64(numRows))
+	meta.structEnd()
+	meta.fieldString(6, "go_mcp_server_tinvest")
+	meta.structEnd()
+
+	file.Write(meta.buf.Bytes())
+	_ = binary.Write(&file, binary.LittleEndian, uint32(meta.buf.Len()))
+	file.WriteString("PAR1")
+	_, err := w.Write(file.Bytes())
+	return err
+}
+
+// write добавляет в SchemaElement converted_type/scale/precision и logicalType
+func (l parquetLogical) write(t *thriftWriter) {
+	switch l {
+	case logicalTimestampMillisUTC:
+		t.fieldI32(6, 9) // TIMESTAMP_MILLIS
+		t.fieldStruct(10)
+		t.fieldStruct(8) // TIMESTAMP
+		t.fieldBool(1, true)
+		t.fieldStruct(2) // unit
+		t.fieldStruct(1) // MILLIS
+		t.structEnd()
+		t.structEnd()
+		t.structEnd()
+		t.structEnd()
+	case logicalDecimal18x9:
+		t.fieldI32(6, 5) // DECIMAL
+		t.fieldI32(7, 9)
+		t.fieldI32(8, 18)
+		t.fieldStruct(10)
+		t.fieldStruct(5) // DECIMAL
+		t.fieldI32(1, 9)
+		t.fieldI32(2, 18)
+		t.structEnd()
+		t.structEnd()
+	}
+}
+
+// Типы Thrift Compact Protocol
+const (
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter — кодировщик Thrift Compact Protocol с учётом вложенности структур
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last []int16 // id последнего поля на каждом уровне вложенности
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	t.buf.Write(b[:n])
+}
+
+func (t *thriftWriter) i32(v int32) { t.varint(uint64(uint32((v << 1) ^ (v >> 31)))) }
+func (t *thriftWriter) i64(v int64) { t.varint(uint64((v << 1) ^ (v >> 63))) }
+
+func (t *thriftWriter) binary(s string) {
+	t.varint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+func (t *thriftWriter) fieldHeader(id int16, typ byte) {
+	if len(t.last) == 0 {
+		t.last = append(t.last, 0)
+	}
+	prev := &t.last[len(t.last)-1]
+	if delta := id - *prev; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.i32(int32(id))
+	}
+	*prev = id
+}
+
+func (t *thriftWriter) fieldI32(id int16, v int32) {
+	t.fieldHeader(id, thriftI32)
+	t.i32(v)
+}
+
+func (t *thriftWriter) fieldI64(id int16, v int64) {
+	t.fieldHeader(id, thriftI64)
+	t.i64(v)
+}
+
+func (t *thriftWriter) fieldString(id int16, s string) {
+	t.fieldHeader(id, thriftBinary)
+	t.binary(s)
+}
+
+func (t *thriftWriter) fieldBool(id int16, v bool) {
+	typ := byte(thriftFalse)
+	if v {
+		typ = thriftTrue
+	}
+	t.fieldHeader(id, typ)
+}
+
+// fieldStruct открывает поле-структуру; закрывается structEnd
+func (t *thriftWriter) fieldStruct(id int16) {
+	t.fieldHeader(id, thriftStruct)
+	t.structBegin()
+}
+
+// fieldList пишет заголовок списка; элементы-структуры открываются structBegin
+func (t *thriftWriter) fieldList(id int16, elem byte, size int) {
+	t.fieldHeader(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elem)
+	} else {
+		t.buf.WriteByte(0xf0 | elem)
+		t.varint(uint64(size))
+	}
+}
+
+func (t *thriftWriter) structBegin() {
+	if len(t.last) == 0 {
+		// корневая структура начинается неявно
+		t.last = append(t.last, 0)
+	}
+	t.last = append(t.last, 0)
+}
+
+func (t *thriftWriter) structEnd() {
+	t.buf.WriteByte(0) // STOP
+	t.last = t.last[:len(t.last)-1]
+}
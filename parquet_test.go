@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+// thriftReader — разбор Thrift Compact Protocol для проверки: структура — map id поля → значение,
+// целые — int64, binary — string, список — []any
+type thriftReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *thriftReader) byte() byte {
+	b := r.buf[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) varint() uint64 {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		panic("некорректный varint")
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case thriftTrue:
+		return true
+	case thriftFalse:
+		return false
+	case thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.varint())
+		s := string(r.buf[r.pos : r.pos+n])
+		r.pos += n
+		return s
+	case thriftList:
+		h := r.byte()
+		size, elem := int(h>>4), h&0x0f
+		if size == 15 {
+			size = int(r.varint())
+		}
+		out := make([]any, size)
+		for i := range out {
+			out[i] = r.value(elem)
+		}
+		return out
+	case thriftStruct:
+		return r.structure()
+	}
+	panic(fmt.Sprintf("неожиданный тип Thrift %d", typ))
+}
+
+func (r *thriftReader) structure() map[int16]any {
+	out := make(map[int16]any)
+	var last int16
+	for {
+		h := r.byte()
+		if h == 0 {
+			return out
+		}
+		id, typ := last+int16(h>>4), h&0x0f
+		if h>>4 == 0 {
+			id = int16(r.zigzag())
+		}
+		out[id] = r.value(typ)
+		last = id
+	}
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	candles := testCandles([]float64{250.5, 251.125}, []int64{1000, 2500})
+	candles[1].IsComplete = false
+	var buf bytes.Buffer
+	if err := encodeCandles(&buf, "parquet", candles); err != nil {
+		t.Fatal(err)
+	}
+	file := buf.Bytes()
+	if string(file[:4]) != "PAR1" || string(file[len(file)-4:]) != "PAR1" {
+		t.Fatalf("нет магических байтов PAR1")
+	}
+	metaLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	metaStart := len(file) - 8 - metaLen
+	meta := (&thriftReader{buf: file[metaStart : len(file)-8]}).structure()
+
+	if meta[3] != int64(2) {
+		t.Fatalf("num_rows = %v, ожидалось 2", meta[3])
+	}
+	type column struct {
+		name      string
+		typ       int64
+		converted any
+	}
+	want := []column{
+		{"time", int64(parquetInt64), int64(9)},
+		{"open", int64(parquetInt64), int64(5)},
+		{"high", int64(parquetInt64), int64(5)},
+		{"low", int64(parquetInt64), int64(5)},
+		{"close", int64(parquetInt64), int64(5)},
+		{"volume", int64(parquetInt64), nil},
+		{"is_complete", int64(parquetBoolean), nil},
+	}
+	schema := meta[2].([]any)
+	if len(schema) != len(want)+1 || schema[0].(map[int16]any)[5] != int64(len(want)) {
+		t.Fatalf("схема: %v", schema)
+	}
+	for i, w := range want {
+		el := schema[i+1].(map[int16]any)
+		if el[4] != w.name || el[1] != w.typ || el[3] != int64(0) || el[6] != w.converted {
+			t.Errorf("колонка %d: %v, ожидалось %+v", i, el, w)
+		}
+	}
+	if el := schema[2].(map[int16]any); el[7] != int64(9) || el[8] != int64(18) {
+		t.Errorf("DECIMAL: scale %v, precision %v", el[7], el[8])
+	}
+
+	rowGroups := meta[4].([]any)
+	if len(rowGroups) != 1 {
+		t.Fatalf("групп строк: %d", len(rowGroups))
+	}
+	chunks := rowGroups[0].(map[int16]any)[1].([]any)
+	if len(chunks) != len(want) {
+		t.Fatalf("колонок в группе: %d", len(chunks))
+	}
+	var got [][]any
+	for i, ch := range chunks {
+		cm := ch.(map[int16]any)[3].(map[int16]any)
+		if cm[3].([]any)[0] != want[i].name || cm[5] != int64(2) || cm[4] != int64(0) {
+			t.Errorf("метаданные колонки %d: %v", i, cm)
+		}
+		offset, size := int(cm[9].(int64)), int(cm[7].(int64))
+		r := &thriftReader{buf: file[:offset+size], pos: offset}
+		page := r.structure()
+		dp := page[5].(map[int16]any)
+		if page[1] != int64(0) || dp[1] != int64(2) || dp[2] != int64(0) {
+			t.Errorf("заголовок страницы %d: %v", i, page)
+		}
+		data := file[r.pos : r.pos+int(page[2].(int64))]
+		if r.pos+len(data) != offset+size {
+			t.Errorf("колонка %d: размер чанка %d не совпадает со страницей", i, size)
+		}
+		var values []any
+		if want[i].typ == int64(parquetBoolean) {
+			for j := 0; j < 2; j++ {
+				values = append(values, data[j/8]&(1<<(j%8)) != 0)
+			}
+		} else {
+			for j := 0; j < 2; j++ {
+				values = append(values, int64(binary.LittleEndian.Uint64(data[j*8:])))
+			}
+		}
+		got = append(got, values)
+	}
+
+	expect := [][]any{
+		{int64(1704067200000), int64(1704153600000)},
+		{int64(250_500_000_000), int64(251_125_000_000)},
+		{int64(251_500_000_000), int64(252_125_000_000)},
+		{int64(249_500_000_000), int64(250_125_000_000)},
+		{int64(250_500_000_000), int64(251_125_000_000)},
+		{int64(1000), int64(2500)},
+		{true, false},
+	}
+	for i := range expect {
+		for j := range expect[i] {
+			if got[i][j] != expect[i][j] {
+				t.Errorf("%s[%d] = %v, ожидалось %v", want[i].name, j, got[i][j], expect[i][j])
+			}
+		}
+	}
+}
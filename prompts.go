@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Промпты MCP — готовые сценарии работы аналитика. Промпт не обращается к API сам:
+// он собирает инструкцию с конкретными вызовами инструментов сервера и уже подставленными аргументами
+// (даты периода, тикер), чтобы сценарий одинаково выполнялся в любом MCP-клиенте.
+
+func registerPrompts(srv *server.MCPServer) {
+	srv.AddPrompt(
+		mcp.NewPrompt("portfolio_analysis",
+			mcp.WithPromptDescription("Анализ портфеля: структура, концентрация, доходность, ожидаемые выплаты и риски"),
+			mcp.WithArgument("focus", mcp.ArgumentDescription("На чём сделать акцент: risk, income или performance; по умолчанию всё")),
+		),
+		portfolioAnalysisPrompt)
+	srv.AddPrompt(
+		mcp.NewPrompt("instrument_research",
+			mcp.WithPromptDescription("Исследование инструмента: карточка, торги, история цен, индикаторы, ликвидность, выплаты"),
+			mcp.WithArgument("ticker", mcp.RequiredArgument(), mcp.ArgumentDescription("Тикер, название или FIGI инструмента")),
+			mcp.WithArgument("days", mcp.ArgumentDescription("Глубина истории в днях (7-1825), по умолчанию 180")),
+		),
+		instrumentResearchPrompt)
+	srv.AddPrompt(
+		mcp.NewPrompt("rebalance_plan",
+			mcp.WithPromptDescription("План ребалансировки портфеля к целевой структуре с оценкой стоимости сделок по стакану"),
+			mcp.WithArgument("target", mcp.RequiredArgument(), mcp.ArgumentDescription("Целевая структура, напр. \"акции 60%, облигации 30%, валюта 10%\" или доли по тикерам")),
+			mcp.WithArgument("tolerance", mcp.ArgumentDescription("Допустимое отклонение доли в процентных пунктах, по умолчанию 5")),
+		),
+		rebalancePlanPrompt)
+	srv.AddPrompt(
+		mcp.NewPrompt("daily_brief",
+			mcp.WithPromptDescription("Ежедневная сводка: расписание торгов, портфель, котировки списка наблюдения, сработавшие алерты"),
+			mcp.WithArgument("watchlist", mcp.ArgumentDescription("Имя локального списка наблюдения; по умолчанию избранное брокера")),
+		),
+		dailyBriefPrompt)
+}
+
+// toolCall — вызов инструмента в тексте промпта: имя и JSON аргументов
+func toolCall(name string, args map[string]any) string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false) // плейсхолдеры вида <FIGI> остаются читаемыми
+	_ = enc.Encode(args)
+	return fmt.Sprintf("`%s` %s", name, strings.TrimSpace(b.String()))
+}
+
+// promptSteps — нумерованный список шагов
+func promptSteps(steps []string) string {
+	var b strings.Builder
+	for i, s := range steps {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, s)
+	}
+	return b.String()
+}
+
+func promptResult(description, text string) *mcp.GetPromptResult {
+	return mcp.NewGetPromptResult(description, []mcp.PromptMessage{
+		mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(text)),
+	})
+}
+
+func rfc3339(t time.Time) string { return t.UTC().Format(time.RFC3339) }
+
+func portfolioAnalysisPrompt(ctx context.Context, req mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	focus := strings.ToLower(strings.TrimSpace(req.Params.Arguments["focus"]))
+	switch focus {
+	case "", "risk", "income", "performance":
+	default:
+		return nil, fmt.Errorf("неизвестный focus %q. Допустимо: risk, income, performance", focus)
+	}
+	now := time.Now().UTC()
+	steps := []string{
+		toolCall("portfolio", map[string]any{}) + " — позиции, количество, средняя и текущая цена, ожидаемая доходность.",
+		"Для всех позиций одним вызовом " + toolCall("last_price", map[string]any{"query": "<FIGI позиций через запятую>"}) +
+			" — текущие цены и изменение к закрытию.",
+		toolCall("trading_status", map[string]any{"query": "<FIGI позиций через запятую>"}) + " — какие инструменты сейчас торгуются.",
+		"Для 5 крупнейших позиций по стоимости " + toolCall("candles", map[string]any{
+			"query": "<FIGI>", "interval": "1d", "from": rfc3339(now.AddDate(0, -3, 0)), "to": rfc3339(now),
+		}) + " — динамика за 3 месяца и максимальная просадка.",
+		toolCall("portfolio_income_calendar", map[string]any{"months": 12}) + " — ожидаемые дивиденды и купоны.",
+	}
+	report := []string{
+		"структура по типам инструментов, валютам и секторам (доли в %)",
+		"концентрация: доля крупнейшей позиции и топ-5",
+		"доходность позиций и портфеля в целом, лидеры и аутсайдеры",
+		"ожидаемый денежный поток по месяцам",
+		"риски: концентрация, валютный риск, неликвидные или неторгуемые бумаги",
+		"3–5 конкретных наблюдений и рекомендаций",
+	}
+	switch focus {
+	case "risk":
+		report = append(report, "Акцент — на рисках: подробно разбери концентрацию, волатильность по свечам и валютную структуру.")
+	case "income":
+		report = append(report, "Акцент — на доходе: подробно разбери выплаты, их регулярность и доходность к стоимости позиций.")
+	case "performance":
+		report = append(report, "Акцент — на результате: подробно разбери вклад каждой позиции в доходность портфеля.")
+	}
+	text := "Проанализируй мой инвестиционный портфель.\n\nШаги (инструменты MCP-сервера Т-Инвестиций):\n" + promptSteps(steps) +
+		"\nВ отчёте:\n" + formatList(report) +
+		"Опирайся только на данные инструментов; если вызов вернул ошибку, укажи это в отчёте. Ничего не покупай и не продавай."
+	return promptResult("Анализ портфеля", text), nil
+}
+
+func instrumentResearchPrompt(ctx context.Context, req mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	ticker := strings.TrimSpace(req.Params.Arguments["ticker"])
+	if ticker == "" {
+		return nil, fmt.Errorf("не указан ticker")
+	}
+	days := 180
+	if s := strings.TrimSpace(req.Params.Arguments["days"]); s != "" {
+		d, err := strconv.Atoi(s)
+		if err != nil || d < 7 || d > 1825 {
+			return nil, fmt.Errorf("days должен быть целым числом в диапазоне 7-1825")
+		}
+		days = d
+	}
+	interval := "1d"
+	if days > 730 {
+		interval = "week"
+	}
+	now := time.Now().UTC()
+	steps := []string{
+		toolCall("instrument_info", map[string]any{"query": ticker}) + " — тип, лот, шаг цены, валюта, площадка, доступность торгов.",
+		toolCall("trading_status", map[string]any{"query": ticker}) + " — режим торгов сейчас и ближайшее открытие.",
+		toolCall("last_price", map[string]any{"query": ticker}) + " — последняя цена и изменение к закрытию.",
+		toolCall("candles", map[string]any{
+			"query": ticker, "interval": interval, "from": rfc3339(now.AddDate(0, 0, -days)), "to": rfc3339(now),
+		}) + fmt.Sprintf(" — история цен за %d дн.: тренд, диапазон, просадки, объёмы.", days),
+		toolCall("indicators", map[string]any{"query": ticker, "interval": "1d"}) + " — SMA/EMA, RSI, MACD, Bollinger, ATR.",
+		toolCall("orderbook", map[string]any{"query": ticker, "depth": 20}) + " — спред, глубина и дисбаланс стакана.",
+		toolCall("last_trades", map[string]any{"query": ticker, "minutes": 60, "limit": 0}) + " — активность за последний час, VWAP, перевес покупок/продаж.",
+		"По типу инструмента: для акции — " + toolCall("dividends", map[string]any{"query": ticker}) +
+			", для облигации — " + toolCall("bond_analytics", map[string]any{"query": ticker}) + ".",
+	}
+	text := fmt.Sprintf("Подготовь исследование инструмента %s.\n\nШаги (инструменты MCP-сервера Т-Инвестиций):\n%s", ticker, promptSteps(steps)) +
+		"\nВ отчёте:\n" + formatList([]string{
+		"что это за инструмент и можно ли им торговать через API",
+		"ценовая динамика и положение текущей цены в диапазоне периода",
+		"сигналы индикаторов без категоричных прогнозов",
+		"ликвидность: спред в bps, глубина стакана, активность сделок",
+		"выплаты (дивиденды или купоны и доходность к погашению)",
+		"ключевые риски и что стоит проверить дополнительно",
+	}) + "Опирайся только на данные инструментов; если вызов вернул ошибку или неприменим к типу инструмента, пропусти шаг и отметь это."
+	return promptResult("Исследование "+ticker, text), nil
+}
+
+func rebalancePlanPrompt(ctx context.Context, req mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	target := strings.TrimSpace(req.Params.Arguments["target"])
+	if target == "" {
+		return nil, fmt.Errorf("не указана целевая структура (target)")
+	}
+	tolerance := 5.0
+	if s := strings.TrimSpace(req.Params.Arguments["tolerance"]); s != "" {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil || v < 0 || v > 50 {
+			return nil, fmt.Errorf("tolerance должен быть числом в диапазоне 0-50")
+		}
+		tolerance = v
+	}
+	steps := []string{
+		toolCall("portfolio", map[string]any{}) + " — текущие позиции и стоимость портфеля.",
+		toolCall("last_price", map[string]any{"query": "<FIGI позиций через запятую>"}) + " — актуальные цены для расчёта долей.",
+		"Посчитай текущие доли и отклонения от цели; ребалансируй только классы/позиции с отклонением больше допуска.",
+		"Для каждой сделки " + toolCall("instrument_info", map[string]any{"query": "<тикер>"}) + " — лотность, чтобы перевести сумму в целые лоты.",
+		toolCall("trading_status", map[string]any{"query": "<тикеры сделок через запятую>"}) + " — доступны ли рыночные заявки сейчас.",
+		"Для каждой сделки " + toolCall("orderbook", map[string]any{"query": "<тикер>", "depth": 20, "lots": "<лоты сделки>"}) +
+			" — средняя цена исполнения, сумма и проскальзывание.",
+	}
+	text := fmt.Sprintf("Подготовь план ребалансировки портфеля.\nЦелевая структура: %s\nДопустимое отклонение: %s п.п.\n\nШаги (инструменты MCP-сервера Т-Инвестиций):\n%s",
+		target, strconv.FormatFloat(tolerance, 'f', -1, 64), promptSteps(steps)) +
+		"\nРезультат — таблица: класс/инструмент, текущая доля, целевая доля, отклонение, действие (купить/продать), лоты, ожидаемая сумма и проскальзывание по стакану. " +
+		"Сначала продажи, затем покупки на высвободившиеся средства; учти, что не все бумаги торгуются в текущую сессию.\n" +
+		"Заявки не выставляй: инструменты buy/sell вызывай только после явного подтверждения плана пользователем."
+	return promptResult("План ребалансировки", text), nil
+}
+
+func dailyBriefPrompt(ctx context.Context, req mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	watchlist := strings.TrimSpace(req.Params.Arguments["watchlist"])
+	quotesArgs := map[string]any{"favorites": true}
+	source := "избранного"
+	if watchlist != "" {
+		quotesArgs = map[string]any{"name": watchlist}
+		source = fmt.Sprintf("списка %q", watchlist)
+	}
+	now := time.Now().UTC()
+	today := now.Format("2006-01-02")
+	steps := []string{
+		toolCall("trading_schedule", map[string]any{"exchange": "MOEX", "from": today, "to": today}) + " — сессии сегодня; неторговый ли день.",
+		toolCall("portfolio", map[string]any{}) + " — позиции портфеля.",
+		toolCall("last_price", map[string]any{"query": "<FIGI позиций через запятую>"}) + " — изменения позиций к закрытию.",
+		toolCall("watchlist_quotes", quotesArgs) + " — котировки " + source + ".",
+		"Для 3 инструментов с наибольшим изменением " + toolCall("candles", map[string]any{
+			"query": "<FIGI>", "interval": "1h", "from": rfc3339(now.Add(-24 * time.Hour)), "to": rfc3339(now),
+		}) + " — внутридневная динамика за сутки.",
+		toolCall("alert_list", map[string]any{}) + " — какие алерты сработали.",
+	}
+	text := fmt.Sprintf("Подготовь ежедневную сводку по рынку на %s.\n\nШаги (инструменты MCP-сервера Т-Инвестиций):\n%s", today, promptSteps(steps)) +
+		"\nСводка — коротко, до одной страницы:\n" + formatList([]string{
+		"режим торгов сегодня",
+		"изменение стоимости портфеля и главные движения позиций",
+		"лидеры роста и падения из списка наблюдения",
+		"сработавшие алерты",
+		"на что обратить внимание в течение дня",
+	})
+	return promptResult("Сводка на "+today, text), nil
+}
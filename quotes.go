@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+)
+
+// QuoteRow — последняя цена и изменение к цене закрытия по одному инструменту
+type QuoteRow struct {
+	Ref        *InstrumentRef
+	LastPrice  *pb.Quotation
+	LastTime   time.Time
+	ClosePrice *pb.Quotation
+	CloseTime  time.Time
+}
+
+// QuoteJSON — котировка в структурированном выводе
+type QuoteJSON struct {
+	Instrument InstrumentJSON `json:"instrument"`
+	LastPrice  string         `json:"last_price,omitempty"`
+	LastTime   string         `json:"last_time,omitempty"`
+	AgeSeconds int64          `json:"age_seconds,omitempty"`
+	ClosePrice string         `json:"close_price,omitempty"`
+	CloseTime  string         `json:"close_time,omitempty"`
+	Change     string         `json:"change,omitempty"`
+	ChangePct  *float64       `json:"change_pct,omitempty"`
+}
+
+// QuotesOutput — структурированный результат last_price и watchlist_quotes
+type QuotesOutput struct {
+	Quotes     []QuoteJSON `json:"quotes"`
+	NotFound   []string    `json:"not_found,omitempty"`
+	CloseError string      `json:"close_error,omitempty"` // цены закрытия не получены — изменение не рассчитано
+}
+
+func (r QuoteRow) JSON() QuoteJSON {
+	out := QuoteJSON{Instrument: r.Ref.JSON()}
+	if !r.HasLast() {
+		return out
+	}
+	out.LastPrice, out.LastTime = quotationJSON(r.LastPrice), timeJSON(r.LastTime)
+	out.AgeSeconds = int64(time.Since(r.LastTime).Seconds())
+	if r.HasClose() {
+		pct := math.Round(r.ChangePct()*10000) / 10000
+		out.ClosePrice, out.CloseTime = quotationJSON(r.ClosePrice), timeJSON(r.CloseTime)
+		out.Change, out.ChangePct = strings.TrimSuffix(strings.TrimRight(r.Change(), "0"), "."), &pct
+	}
+	return out
+}
+
+func quotesJSON(rows []QuoteRow, closeErr error) QuotesOutput {
+	out := QuotesOutput{Quotes: make([]QuoteJSON, 0, len(rows))}
+	for _, r := range rows {
+		out.Quotes = append(out.Quotes, r.JSON())
+	}
+	if closeErr != nil {
+		out.CloseError = closeErr.Error()
+	}
+	return out
+}
+
+// HasLast сообщает, пришла ли последняя цена
+func (r QuoteRow) HasLast() bool { return r.LastPrice != nil }
+
+// HasClose сообщает, пришла ли ненулевая цена закрытия
+func (r QuoteRow) HasClose() bool {
+	return r.ClosePrice != nil && (r.ClosePrice.GetUnits() != 0 || r.ClosePrice.GetNano() != 0)
+}
+
+// Change — абсолютное изменение последней цены к цене закрытия (точно, в нано-единицах)
+func (r QuoteRow) Change() string {
+	d := quotationNanos(r.LastPrice) - quotationNanos(r.ClosePrice)
+	return decimalToStr(d/1e9, int32(d%1e9))
+}
+
+// ChangePct — изменение в процентах
+func (r QuoteRow) ChangePct() float64 {
+	c := quotationNanos(r.ClosePrice)
+	if c == 0 {
+		return 0
+	}
+	return float64(quotationNanos(r.LastPrice)-c) / float64(c) * 100
+}
+
+func quotationNanos(q *pb.Quotation) int64 {
+	return q.GetUnits()*1e9 + int64(q.GetNano())
+}
+
+// loadQuotes получает последние цены и цены закрытия для набора инструментов —
+// по одному пакетному запросу GetLastPrices и GetClosePrices. Ошибка GetClosePrices
+// не прерывает запрос: строки возвращаются без цен закрытия, а ошибка — в closeErr
+func loadQuotes(ic *InvestClient, refs []*InstrumentRef) (rows []QuoteRow, closeErr error, err error) {
+	ids := make([]string, 0, len(refs))
+	for _, r := range refs {
+		ids = append(ids, r.Uid)
+	}
+	md := ic.sdk.NewMarketDataServiceClient()
+	lpResp, err := md.GetLastPrices(ids)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка получения последних цен: %w", err)
+	}
+	last := make(map[string]*pb.LastPrice)
+	for _, lp := range lpResp.GetLastPrices() {
+		last[lp.GetInstrumentUid()] = lp
+		last[lp.GetFigi()] = lp
+	}
+	closes := make(map[string]*pb.InstrumentClosePriceResponse)
+	if cpResp, err := md.GetClosePrices(ids); err != nil {
+		closeErr = fmt.Errorf("ошибка получения цен закрытия: %w", err)
+	} else {
+		for _, cp := range cpResp.GetClosePrices() {
+			closes[cp.GetInstrumentUid()] = cp
+			closes[cp.GetFigi()] = cp
+		}
+	}
+
+	rows = make([]QuoteRow, 0, len(refs))
+	for _, ref := range refs {
+		row := QuoteRow{Ref: ref}
+		if lp, ok := lookupByIds(last, ref); ok {
+			row.LastPrice = lp.GetPrice()
+			row.LastTime = lp.GetTime().AsTime()
+		}
+		if cp, ok := lookupByIds(closes, ref); ok {
+			row.ClosePrice = cp.GetPrice()
+			row.CloseTime = cp.GetTime().AsTime()
+		}
+		rows = append(rows, row)
+	}
+	return rows, closeErr, nil
+}
+
+// closeErrorNote — пояснение к тексту котировок, если цены закрытия не получены
+func closeErrorNote(closeErr error) string {
+	if closeErr == nil {
+		return ""
+	}
+	return fmt.Sprintf("\nИзменение к закрытию не рассчитано: %v", closeErr)
+}
+
+// lookupByIds ищет ответ по UID инструмента, затем по FIGI
+func lookupByIds[T any](m map[string]T, ref *InstrumentRef) (T, bool) {
+	if v, ok := m[ref.Uid]; ok && ref.Uid != "" {
+		return v, true
+	}
+	v, ok := m[ref.Figi]
+	return v, ok && ref.Figi != ""
+}
+
+// formatQuoteRow — строка котировки: цена, изменение к закрытию и время
+func formatQuoteRow(r QuoteRow) string {
+	head := fmt.Sprintf("%s (%s)", r.Ref.Name, r.Ref.Ticker)
+	if !r.HasLast() {
+		return head + ": нет данных о последней цене"
+	}
+	line := fmt.Sprintf("%s: %s", head, quotationToStr(r.LastPrice))
+	if r.HasClose() {
+		line += fmt.Sprintf(", закрытие %s (%s): %s, %+.2f%%",
+			quotationToStr(r.ClosePrice), r.CloseTime.UTC().Format("2006-01-02"), r.Change(), r.ChangePct())
+	}
+	return line + fmt.Sprintf(", время: %s (%s назад)", r.LastTime.UTC().Format(time.RFC3339), formatAge(time.Since(r.LastTime)))
+}
+
+// formatAge — возраст котировки: секунды, минуты, часы или дни
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%d с", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%d мин", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%d ч %d мин", int(d.Hours()), int(d.Minutes())%60)
+	default:
+		return fmt.Sprintf("%d дн", int(d.Hours()/24))
+	}
+}
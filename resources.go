@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	investgo "github.com/tinkoff/invest-api-go-sdk/investgo"
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+)
+
+// Ресурсы MCP: контекст, который клиент может приложить к диалогу без вызова инструментов
+const (
+	accountsResourceURI      = "tinvest://accounts"
+	portfolioResourcePrefix  = "tinvest://portfolio/"
+	instrumentResourcePrefix = "tinvest://instrument/"
+	candlesResourcePrefix    = "tinvest://candles/"
+)
+
+// AccountJSON — брокерский счёт
+type AccountJSON struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Status      string `json:"status"`
+	AccessLevel string `json:"access_level"`
+	OpenedDate  string `json:"opened_date,omitempty"`
+	ClosedDate  string `json:"closed_date,omitempty"`
+	Selected    bool   `json:"selected"` // счёт, с которым работают инструменты сервера
+	Portfolio   string `json:"portfolio_uri"`
+}
+
+// AccountsOutput — содержимое ресурса tinvest://accounts
+type AccountsOutput struct {
+	Accounts []AccountJSON `json:"accounts"`
+}
+
+// enumName — значение перечисления API без префикса, в нижнем регистре
+func enumName(v fmt.Stringer, prefix string) string {
+	return strings.ToLower(strings.TrimPrefix(v.String(), prefix))
+}
+
+// portfolioWatcher следит за изменениями позиций через PositionsStream и отправляет
+// notifications/resources/updated для tinvest://portfolio/{account_id} сессиям, подписавшимся
+// на портфель инструментом subscribe (запросы resources/subscribe используемая версия mcp-go не обрабатывает).
+type portfolioWatcher struct {
+	mu       sync.Mutex
+	ic       *InvestClient
+	srv      *server.MCPServer
+	accounts map[string]map[string]bool // счёт → ID сессий, подписанных на его портфель
+	stream   *investgo.PositionsStream
+	stopped  bool
+	retrying bool // запущен reconnect
+}
+
+// registerResources добавляет ресурсы и шаблоны ресурсов на сервер
+func registerResources(ic *InvestClient, srv *server.MCPServer) *portfolioWatcher {
+	pw := &portfolioWatcher{ic: ic, srv: srv, accounts: make(map[string]map[string]bool)}
+
+	srv.AddResource(
+		mcp.NewResource(accountsResourceURI, "Брокерские счета",
+			mcp.WithResourceDescription("Счета пользователя: тип, статус, уровень доступа и ссылка на ресурс портфеля"),
+			mcp.WithMIMEType("application/json")),
+		func(ctx context.Context, req mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			return readAccounts(ic, req)
+		})
+	if ic.accountID != "" {
+		srv.AddResource(
+			mcp.NewResource(portfolioResourcePrefix+ic.accountID, "Портфель выбранного счёта",
+				mcp.WithResourceDescription("Позиции и стоимость портфеля счёта TINKOFF_ACCOUNT_ID; после subscribe с portfolio изменения позиций приходят уведомлениями notifications/resources/updated"),
+				mcp.WithMIMEType("application/json")),
+			pw.readPortfolio)
+	}
+	srv.AddResourceTemplate(
+		mcp.NewResourceTemplate(portfolioResourcePrefix+"{account_id}", "Портфель счёта",
+			mcp.WithTemplateDescription("Позиции и стоимость портфеля; после subscribe с portfolio изменения позиций приходят уведомлениями notifications/resources/updated"),
+			mcp.WithTemplateMIMEType("application/json")),
+		pw.readPortfolio)
+	srv.AddResourceTemplate(
+		mcp.NewResourceTemplate(instrumentResourcePrefix+"{uid}", "Карточка инструмента",
+			mcp.WithTemplateDescription("Карточка инструмента по UID (FIGI тоже принимается): лот, шаг цены, валюта, площадка, доступность торгов — как у instrument_info"),
+			mcp.WithTemplateMIMEType("application/json")),
+		func(ctx context.Context, req mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			return readInstrument(ic, req)
+		})
+	// from/to — RFC3339 (двоеточия допускаются без кодирования) или дата YYYY-MM-DD
+	srv.AddResourceTemplate(
+		mcp.NewResourceTemplate(candlesResourcePrefix+"{uid}/{interval}/{+from}/{+to}", "Свечи за период",
+			mcp.WithTemplateDescription("Все свечи инструмента за период: uid — UID инструмента (FIGI тоже принимается), interval как у candles (1m…1mo, произвольный, напр. 45m), from/to — RFC3339 или YYYY-MM-DD"),
+			mcp.WithTemplateMIMEType("application/json")),
+		func(ctx context.Context, req mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			return readCandles(ctx, ic, req)
+		})
+	return pw
+}
+
+// resourceArg — значение переменной шаблона URI
+func resourceArg(req mcp.ReadResourceRequest, name string) string {
+	switch v := req.Params.Arguments[name].(type) {
+	case string:
+		return v
+	case []string:
+		if len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+func jsonResource(uri string, v any) ([]mcp.ResourceContents, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []mcp.ResourceContents{mcp.TextResourceContents{URI: uri, MIMEType: "application/json", Text: string(data)}}, nil
+}
+
+func readAccounts(ic *InvestClient, req mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	resp, err := ic.sdk.NewUsersServiceClient().GetAccounts()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения списка счетов: %w", err)
+	}
+	out := AccountsOutput{Accounts: make([]AccountJSON, 0, len(resp.GetAccounts()))}
+	for _, acc := range resp.GetAccounts() {
+		out.Accounts = append(out.Accounts, AccountJSON{
+			Id: acc.GetId(), Name: acc.GetName(),
+			Type:        enumName(acc.GetType(), "ACCOUNT_TYPE_"),
+			Status:      enumName(acc.GetStatus(), "ACCOUNT_STATUS_"),
+			AccessLevel: enumName(acc.GetAccessLevel(), "ACCOUNT_ACCESS_LEVEL_"),
+			OpenedDate:  dateJSON(acc.GetOpenedDate()), ClosedDate: dateJSON(acc.GetClosedDate()),
+			Selected:  acc.GetId() == ic.accountID,
+			Portfolio: portfolioResourcePrefix + acc.GetId(),
+		})
+	}
+	return jsonResource(req.Params.URI, out)
+}
+
+func (pw *portfolioWatcher) readPortfolio(ctx context.Context, req mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	accountID := strings.TrimPrefix(req.Params.URI, portfolioResourcePrefix)
+	pf, err := loadAccountPortfolio(pw.ic, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения портфеля: %w", err)
+	}
+	return jsonResource(req.Params.URI, portfolioJSON(pf))
+}
+
+// instrumentRefByID находит инструмент по UID, а для ссылок со старым форматом URI — по FIGI
+func instrumentRefByID(ic *InvestClient, id string) (*InstrumentRef, error) {
+	instruments := ic.sdk.NewInstrumentsServiceClient()
+	resp, err := instruments.InstrumentByUid(id)
+	if err != nil {
+		figiResp, figiErr := instruments.InstrumentByFigi(id)
+		if figiErr != nil {
+			return nil, fmt.Errorf("инструмент с UID или FIGI %s не найден: %w", id, err)
+		}
+		resp = figiResp
+	}
+	it := resp.GetInstrument()
+	return &InstrumentRef{Figi: it.GetFigi(), Uid: it.GetUid(), Ticker: it.GetTicker(), ClassCode: it.GetClassCode(),
+		Name: it.GetName(), Kind: it.GetInstrumentKind()}, nil
+}
+
+func readInstrument(ic *InvestClient, req mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	ref, err := instrumentRefByID(ic, resourceArg(req, "uid"))
+	if err != nil {
+		return nil, err
+	}
+	card, err := loadInstrumentCard(ic, ref, true)
+	if err != nil {
+		return nil, err
+	}
+	return jsonResource(req.Params.URI, card.JSON())
+}
+
+// resourceTime приводит дату YYYY-MM-DD к RFC3339; остальные значения передаются как есть
+func resourceTime(s string) string {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t.Format(time.RFC3339)
+	}
+	return s
+}
+
+func readCandles(ctx context.Context, ic *InvestClient, req mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	interval := resourceArg(req, "interval")
+	cq, err := parseCandlePeriod(resourceTime(resourceArg(req, "from")), resourceTime(resourceArg(req, "to")), interval)
+	if err != nil {
+		return nil, err
+	}
+	if cq.Inst, err = instrumentRefByID(ic, resourceArg(req, "uid")); err != nil {
+		return nil, err
+	}
+	candles, err := cq.load(ctx, ic, newWindowProgress(func(int, int, string) {}))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения свечей: %w", err)
+	}
+	out := CandlesOutput{
+		Instrument: cq.Inst.JSON(), Interval: strings.ToLower(interval),
+		From: timeJSON(cq.From), To: timeJSON(cq.To), Total: len(candles),
+		Candles: make([]exportCandle, 0, len(candles)),
+	}
+	for _, c := range candles {
+		out.Candles = append(out.Candles, toExportCandle(c))
+	}
+	return jsonResource(req.Params.URI, out)
+}
+
+// Watch подписывает сессию sessionID на изменения портфеля счёта; стрим переоткрывается со всем набором
+// счетов, так как PositionsStream принимает список счетов только при открытии
+func (pw *portfolioWatcher) Watch(accountID, sessionID string) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if pw.stopped {
+		return
+	}
+	sessions, ok := pw.accounts[accountID]
+	if !ok {
+		sessions = make(map[string]bool)
+		pw.accounts[accountID] = sessions
+	}
+	sessions[sessionID] = true
+	if ok && pw.stream != nil {
+		return
+	}
+	pw.openLocked()
+}
+
+// Unwatch отписывает сессию от портфеля счёта; счёт без подписчиков снимается с наблюдения
+func (pw *portfolioWatcher) Unwatch(accountID, sessionID string) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	sessions, ok := pw.accounts[accountID]
+	if !ok || !sessions[sessionID] {
+		return
+	}
+	delete(sessions, sessionID)
+	if len(sessions) > 0 {
+		return
+	}
+	delete(pw.accounts, accountID)
+	if len(pw.accounts) == 0 {
+		if pw.stream != nil {
+			pw.stream.Stop()
+			pw.stream = nil
+		}
+		return
+	}
+	pw.openLocked()
+}
+
+// Watched — счета, на портфели которых подписана сессия
+func (pw *portfolioWatcher) Watched(sessionID string) []string {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	var out []string
+	for id, sessions := range pw.accounts {
+		if sessions[sessionID] {
+			out = append(out, id)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// openLocked переоткрывает стрим с текущим набором счетов, при неудаче запускает reconnect; вызывается под pw.mu
+func (pw *portfolioWatcher) openLocked() {
+	if pw.stopped {
+		return
+	}
+	if err := pw.restartLocked(); err != nil {
+		log.Printf("Не удалось открыть PositionsStream: %v", err)
+		if !pw.retrying {
+			pw.retrying = true
+			go pw.reconnect()
+		}
+	}
+}
+
+// Stop закрывает стрим позиций; после остановки счета под наблюдение не ставятся
+func (pw *portfolioWatcher) Stop() {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	pw.stopped = true
+	if pw.stream != nil {
+		pw.stream.Stop()
+		pw.stream = nil
+	}
+}
+
+// restartLocked закрывает текущий стрим и открывает новый; вызывается под pw.mu
+func (pw *portfolioWatcher) restartLocked() error {
+	if pw.stream != nil {
+		old := pw.stream
+		pw.stream = nil
+		old.Stop()
+	}
+	accounts := make([]string, 0, len(pw.accounts))
+	for id := range pw.accounts {
+		accounts = append(accounts, id)
+	}
+	stream, err := pw.ic.sdk.NewOperationsStreamClient().PositionsStream(accounts)
+	if err != nil {
+		return err
+	}
+	pw.stream = stream
+	go pw.listen(stream)
+	go func() {
+		for pd := range stream.Positions() {
+			pw.notify(pd)
+		}
+	}()
+	return nil
+}
+
+// listen читает стрим до его завершения; при обрыве запускает переподключение
+func (pw *portfolioWatcher) listen(stream *investgo.PositionsStream) {
+	err := stream.Listen()
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if pw.stream != stream {
+		return
+	}
+	pw.stream = nil
+	if err == nil || pw.stopped {
+		return
+	}
+	log.Printf("PositionsStream оборвался: %v", err)
+	if !pw.retrying {
+		pw.retrying = true
+		go pw.reconnect()
+	}
+}
+
+// reconnect переоткрывает стрим с нарастающей паузой, пока это не удастся или наблюдение не остановлено
+func (pw *portfolioWatcher) reconnect() {
+	delay := streamReconnectDelay
+	for {
+		time.Sleep(delay)
+		pw.mu.Lock()
+		if pw.stream != nil || pw.stopped || len(pw.accounts) == 0 {
+			pw.retrying = false
+			pw.mu.Unlock()
+			return
+		}
+		err := pw.restartLocked()
+		pw.retrying = err != nil
+		pw.mu.Unlock()
+		if err == nil {
+			log.Printf("PositionsStream восстановлен")
+			return
+		}
+		delay = min(delay*2, streamReconnectMaxDelay)
+		log.Printf("Не удалось переоткрыть PositionsStream: %v; следующая попытка через %v", err, delay)
+	}
+}
+
+// notify отправляет уведомление об изменении портфеля сессиям, подписанным на него;
+// отключившиеся сессии убираются из получателей
+func (pw *portfolioWatcher) notify(pd *pb.PositionData) {
+	pw.mu.Lock()
+	var sessions []string
+	for id := range pw.accounts[pd.GetAccountId()] {
+		sessions = append(sessions, id)
+	}
+	pw.mu.Unlock()
+	params := map[string]any{"uri": portfolioResourcePrefix + pd.GetAccountId()}
+	for _, id := range sessions {
+		if err := pw.srv.SendNotificationToSpecificClient(id, string(mcp.MethodNotificationResourceUpdated), params); err != nil {
+			pw.mu.Lock()
+			delete(pw.accounts[pd.GetAccountId()], id)
+			pw.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxScheduleDays — максимальная длина периода, которую принимает TradingSchedules
+const maxScheduleDays = 14
+
+// TradingDayJSON — торговый день площадки; время сессий — RFC3339 UTC
+type TradingDayJSON struct {
+	Date                string `json:"date"`
+	IsTradingDay        bool   `json:"is_trading_day"`
+	Start               string `json:"start,omitempty"`
+	End                 string `json:"end,omitempty"`
+	PremarketStart      string `json:"premarket_start,omitempty"`
+	PremarketEnd        string `json:"premarket_end,omitempty"`
+	OpeningAuctionStart string `json:"opening_auction_start,omitempty"`
+	OpeningAuctionEnd   string `json:"opening_auction_end,omitempty"`
+	ClosingAuctionStart string `json:"closing_auction_start,omitempty"`
+	ClosingAuctionEnd   string `json:"closing_auction_end,omitempty"`
+	EveningStart        string `json:"evening_start,omitempty"`
+	EveningEnd          string `json:"evening_end,omitempty"`
+	ClearingStart       string `json:"clearing_start,omitempty"`
+	ClearingEnd         string `json:"clearing_end,omitempty"`
+}
+
+// ExchangeScheduleJSON — расписание одной площадки
+type ExchangeScheduleJSON struct {
+	Exchange string           `json:"exchange"`
+	Days     []TradingDayJSON `json:"days"`
+}
+
+// TradingScheduleOutput — структурированный результат trading_schedule
+type TradingScheduleOutput struct {
+	From      string                 `json:"from"`
+	To        string                 `json:"to"`
+	Exchanges []ExchangeScheduleJSON `json:"exchanges"`
+}
+
+func tradingDayJSON(d *pb.TradingDay) TradingDayJSON {
+	out := TradingDayJSON{Date: dateJSON(d.GetDate()), IsTradingDay: d.GetIsTradingDay()}
+	if !out.IsTradingDay {
+		return out
+	}
+	out.Start, out.End = timestampJSON(d.GetStartTime()), timestampJSON(d.GetEndTime())
+	out.PremarketStart, out.PremarketEnd = timestampJSON(d.GetPremarketStartTime()), timestampJSON(d.GetPremarketEndTime())
+	out.OpeningAuctionStart, out.OpeningAuctionEnd = timestampJSON(d.GetOpeningAuctionStartTime()), timestampJSON(d.GetOpeningAuctionEndTime())
+	out.ClosingAuctionStart, out.ClosingAuctionEnd = timestampJSON(d.GetClosingAuctionStartTime()), timestampJSON(d.GetClosingAuctionEndTime())
+	out.EveningStart, out.EveningEnd = timestampJSON(d.GetEveningStartTime()), timestampJSON(d.GetEveningEndTime())
+	out.ClearingStart, out.ClearingEnd = timestampJSON(d.GetClearingStartTime()), timestampJSON(d.GetClearingEndTime())
+	return out
+}
+
+func tradingScheduleHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	exchange := strings.TrimSpace(req.GetString("exchange", ""))
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 7)
+	fromArg, err := parseDateArg(req, "from")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if !fromArg.IsZero() {
+		from = fromArg
+		to = from.AddDate(0, 0, 7)
+	}
+	toArg, err := parseDateArg(req, "to")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if !toArg.IsZero() {
+		to = toArg
+	}
+	if to.Before(from) {
+		return mcp.NewToolResultError("Параметр 'to' должен быть не раньше, чем 'from'"), nil
+	}
+	if to.Sub(from) > maxScheduleDays*24*time.Hour {
+		return mcp.NewToolResultError(fmt.Sprintf("Период расписания не может превышать %d дней", maxScheduleDays)), nil
+	}
+
+	instruments := ic.sdk.NewInstrumentsServiceClient()
+	resp, err := instruments.TradingSchedules(exchange, from, to)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка получения расписания торгов: %v", err)), nil
+	}
+	result := TradingScheduleOutput{From: from.Format("2006-01-02"), To: to.Format("2006-01-02"), Exchanges: []ExchangeScheduleJSON{}}
+	if len(resp.GetExchanges()) == 0 {
+		return mcp.NewToolResultStructured(result, "Расписание не найдено"), nil
+	}
+
+	var lines []string
+	for _, ex := range resp.GetExchanges() {
+		lines = append(lines, fmt.Sprintf("Площадка %s:", ex.GetExchange()))
+		days := make([]TradingDayJSON, 0, len(ex.GetDays()))
+		for _, day := range ex.GetDays() {
+			lines = append(lines, "  "+formatTradingDay(day))
+			days = append(days, tradingDayJSON(day))
+		}
+		result.Exchanges = append(result.Exchanges, ExchangeScheduleJSON{Exchange: ex.GetExchange(), Days: days})
+	}
+	return mcp.NewToolResultStructured(result, fmt.Sprintf("Расписание торгов %s → %s (время UTC):\n%s",
+		from.Format("2006-01-02"), to.Format("2006-01-02"), strings.Join(lines, "\n"))), nil
+}
+
+// formatTradingDay описывает торговый день: сессии, аукционы и клиринг; неторговый день помечается как выходной
+func formatTradingDay(d *pb.TradingDay) string {
+	date := d.GetDate().AsTime().UTC().Format("2006-01-02 Mon")
+	if !d.GetIsTradingDay() {
+		return date + ": неторговый день"
+	}
+	parts := []string{fmt.Sprintf("основная сессия %s", timeRange(d.GetStartTime(), d.GetEndTime()))}
+	if isSet(d.GetPremarketStartTime()) {
+		parts = append(parts, "премаркет "+timeRange(d.GetPremarketStartTime(), d.GetPremarketEndTime()))
+	}
+	if isSet(d.GetOpeningAuctionStartTime()) {
+		parts = append(parts, "аукцион открытия "+timeRange(d.GetOpeningAuctionStartTime(), d.GetOpeningAuctionEndTime()))
+	}
+	if isSet(d.GetClosingAuctionStartTime()) {
+		parts = append(parts, "аукцион закрытия "+timeRange(d.GetClosingAuctionStartTime(), d.GetClosingAuctionEndTime()))
+	}
+	if isSet(d.GetEveningStartTime()) {
+		parts = append(parts, "вечерняя сессия "+timeRange(d.GetEveningStartTime(), d.GetEveningEndTime()))
+	}
+	if isSet(d.GetClearingStartTime()) {
+		parts = append(parts, "клиринг "+timeRange(d.GetClearingStartTime(), d.GetClearingEndTime()))
+	}
+	return date + ": " + strings.Join(parts, ", ")
+}
+
+func isSet(ts *timestamppb.Timestamp) bool {
+	return ts != nil && (ts.GetSeconds() != 0 || ts.GetNanos() != 0)
+}
+
+func timeRange(from, to *timestamppb.Timestamp) string {
+	f, t := "?", "?"
+	if isSet(from) {
+		f = from.AsTime().UTC().Format("15:04")
+	}
+	if isSet(to) {
+		t = to.AsTime().UTC().Format("15:04")
+	}
+	return f + "–" + t
+}
+
+// nextSessionOpen ищет ближайшее после now начало торгов (премаркет, основная или вечерняя сессия) на площадке
+func nextSessionOpen(ic *InvestClient, exchange string, now time.Time) (time.Time, error) {
+	instruments := ic.sdk.NewInstrumentsServiceClient()
+	resp, err := instruments.TradingSchedules(exchange, now, now.AddDate(0, 0, maxScheduleDays))
+	if err != nil {
+		return time.Time{}, err
+	}
+	var next time.Time
+	for _, ex := range resp.GetExchanges() {
+		for _, day := range ex.GetDays() {
+			if !day.GetIsTradingDay() {
+				continue
+			}
+			for _, ts := range []*timestamppb.Timestamp{day.GetPremarketStartTime(), day.GetStartTime(), day.GetEveningStartTime()} {
+				if !isSet(ts) {
+					continue
+				}
+				t := ts.AsTime()
+				if t.After(now) && (next.IsZero() || t.Before(next)) {
+					next = t
+				}
+			}
+		}
+	}
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("торговые сессии в ближайшие %d дней не найдены", maxScheduleDays)
+	}
+	return next, nil
+}
+
+// securityTradingStatusTexts — описания режимов торгов на русском
+var securityTradingStatusTexts = map[pb.SecurityTradingStatus]string{
+	pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_UNSPECIFIED:                      "торговый статус не определён",
+	pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_NOT_AVAILABLE_FOR_TRADING:        "недоступен для торгов",
+	pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_OPENING_PERIOD:                   "период открытия торгов",
+	pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_CLOSING_PERIOD:                   "период закрытия торгов",
+	pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_BREAK_IN_TRADING:                 "перерыв в торговле",
+	pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_NORMAL_TRADING:                   "нормальная торговля",
+	pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_CLOSING_AUCTION:                  "аукцион закрытия",
+	pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_DARK_POOL_AUCTION:                "аукцион крупных пакетов",
+	pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_DISCRETE_AUCTION:                 "дискретный аукцион",
+	pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_OPENING_AUCTION_PERIOD:           "аукцион открытия",
+	pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_TRADING_AT_CLOSING_AUCTION_PRICE: "торги по цене аукциона закрытия",
+	pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_SESSION_ASSIGNED:                 "сессия назначена",
+	pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_SESSION_CLOSE:                    "сессия закрыта",
+	pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_SESSION_OPEN:                     "сессия открыта",
+	pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_DEALER_NORMAL_TRADING:            "торговля в режиме внутренней ликвидности брокера",
+	pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_DEALER_BREAK_IN_TRADING:          "перерыв торговли в режиме внутренней ликвидности брокера",
+	pb.SecurityTradingStatus_SECURITY_TRADING_STATUS_DEALER_NOT_AVAILABLE_FOR_TRADING: "торговля в режиме внутренней ликвидности брокера недоступна",
+}
+
+// tradingStatusName — код режима торгов для структурированного вывода, напр. normal_trading
+func tradingStatusName(s pb.SecurityTradingStatus) string {
+	return strings.ToLower(strings.TrimPrefix(s.String(), "SECURITY_TRADING_STATUS_"))
+}
+
+func tradingStatusText(s pb.SecurityTradingStatus) string {
+	if t, ok := securityTradingStatusTexts[s]; ok {
+		return t
+	}
+	return s.String()
+}
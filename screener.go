@@ -0,0 +1,481 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	// bondListTTL — как долго список облигаций и рассчитанные доходности считаются актуальными
+	bondListTTL = time.Hour
+	// maxCouponFetches — сколько купонных графиков загружается за один вызов скринера; остальные
+	// догружаются следующими вызовами, а загруженные сохраняются в $TINKOFF_DATA_DIR/coupons
+	maxCouponFetches = 300
+	// lastPricesBatch — сколько инструментов запрашивается в одном GetLastPrices
+	lastPricesBatch = 500
+)
+
+// bondYield — закэшированный результат расчёта доходности одной облигации
+type bondYield struct {
+	CleanPercent float64
+	YTM          float64
+	CurrentYield float64
+	Duration     float64
+	Err          string
+	At           time.Time
+}
+
+// bondListCache хранит полный список облигаций (Bonds) и рассчитанные доходности в памяти процесса;
+// список дополнительно сохраняется в $TINKOFF_DATA_DIR/bonds.json и переживает перезапуск сервера
+type bondListCache struct {
+	mu     sync.Mutex
+	loaded time.Time
+	bonds  []*pb.Bond
+	yields map[string]bondYield
+}
+
+// storedBondList — список облигаций в $TINKOFF_DATA_DIR/bonds.json; ответ Bonds хранится в protojson
+type storedBondList struct {
+	Fetched  time.Time       `json:"fetched"`
+	Response json.RawMessage `json:"response"`
+}
+
+func bondListPath(ic *InvestClient) string {
+	return filepath.Join(ic.dataDir, "bonds.json")
+}
+
+// readBondList возвращает сохранённый список, если он моложе bondListTTL
+func readBondList(ic *InvestClient) ([]*pb.Bond, time.Time, bool) {
+	var st storedBondList
+	if err := readJSONFile(bondListPath(ic), &st); err != nil || st.Fetched.IsZero() || time.Since(st.Fetched) >= bondListTTL {
+		return nil, time.Time{}, false
+	}
+	var resp pb.BondsResponse
+	if err := protojson.Unmarshal(st.Response, &resp); err != nil {
+		log.Printf("Повреждён файл %s: %v", bondListPath(ic), err)
+		return nil, time.Time{}, false
+	}
+	return resp.GetInstruments(), st.Fetched, true
+}
+
+func writeBondList(ic *InvestClient, resp *pb.BondsResponse, fetched time.Time) error {
+	data, err := protojson.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return writeJSONFile(bondListPath(ic), storedBondList{Fetched: fetched, Response: data})
+}
+
+func (c *bondListCache) list(ic *InvestClient) ([]*pb.Bond, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.bonds != nil && time.Since(c.loaded) < bondListTTL {
+		return c.bonds, nil
+	}
+	if bonds, fetched, ok := readBondList(ic); ok {
+		c.bonds, c.loaded = bonds, fetched
+		c.yields = make(map[string]bondYield)
+		return c.bonds, nil
+	}
+	resp, err := ic.sdk.NewInstrumentsServiceClient().Bonds(pb.InstrumentStatus_INSTRUMENT_STATUS_BASE)
+	if err != nil {
+		return nil, err
+	}
+	c.bonds = resp.GetInstruments()
+	c.loaded = time.Now().UTC()
+	c.yields = make(map[string]bondYield)
+	if err := writeBondList(ic, resp.BondsResponse, c.loaded); err != nil {
+		log.Printf("Не удалось сохранить список облигаций: %v", err)
+	}
+	return c.bonds, nil
+}
+
+func (c *bondListCache) yield(figi string) (bondYield, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	y, ok := c.yields[figi]
+	if !ok || time.Since(y.At) >= bondListTTL {
+		return bondYield{}, false
+	}
+	return y, true
+}
+
+func (c *bondListCache) storeYield(figi string, y bondYield) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.yields == nil {
+		c.yields = make(map[string]bondYield)
+	}
+	c.yields[figi] = y
+}
+
+// BondScreenerFilter — критерии отбора облигаций
+type BondScreenerFilter struct {
+	Currency     string
+	MaturityFrom time.Time
+	MaturityTo   time.Time
+	CouponType   string // fixed | floating
+	Amortization *bool
+	Sector       string
+	RiskLevel    pb.RiskLevel
+	YTMMin       *float64 // в долях
+	YTMMax       *float64
+}
+
+func (f BondScreenerFilter) match(b *pb.Bond) bool {
+	if f.Currency != "" && !strings.EqualFold(b.GetCurrency(), f.Currency) {
+		return false
+	}
+	maturity := b.GetMaturityDate().AsTime()
+	if !f.MaturityFrom.IsZero() && maturity.Before(f.MaturityFrom) {
+		return false
+	}
+	if !f.MaturityTo.IsZero() && maturity.After(f.MaturityTo) {
+		return false
+	}
+	switch f.CouponType {
+	case "fixed":
+		if b.GetFloatingCouponFlag() {
+			return false
+		}
+	case "floating":
+		if !b.GetFloatingCouponFlag() {
+			return false
+		}
+	}
+	if f.Amortization != nil && b.GetAmortizationFlag() != *f.Amortization {
+		return false
+	}
+	if f.Sector != "" && !strings.EqualFold(b.GetSector(), f.Sector) {
+		return false
+	}
+	if f.RiskLevel != pb.RiskLevel_RISK_LEVEL_UNSPECIFIED && b.GetRiskLevel() != f.RiskLevel {
+		return false
+	}
+	return true
+}
+
+// ScreenedBondJSON — облигация в структурированном результате bond_screener
+type ScreenedBondJSON struct {
+	Instrument   InstrumentJSON `json:"instrument"`
+	Currency     string         `json:"currency"`
+	MaturityDate string         `json:"maturity_date,omitempty"`
+	Floating     bool           `json:"floating_coupon"`
+	Amortization bool           `json:"amortization"`
+	Sector       string         `json:"sector,omitempty"`
+	RiskLevel    string         `json:"risk_level"`
+	CleanPercent string         `json:"clean_price_percent"`
+	YTM          *float64       `json:"ytm_pct,omitempty"`
+	CurrentYield *float64       `json:"current_yield_pct,omitempty"`
+	Duration     *float64       `json:"macaulay_duration_years,omitempty"`
+	YieldError   string         `json:"yield_error,omitempty"`
+}
+
+// BondScreenerOutput — структурированный результат bond_screener
+type BondScreenerOutput struct {
+	Total int                `json:"total"`
+	Page  int                `json:"page"`
+	Pages int                `json:"pages"`
+	Bonds []ScreenedBondJSON `json:"bonds"`
+	// CouponsPending — сколько купонных графиков ещё не загружено: у этих облигаций нет YTM,
+	// результат неполный, повторный вызов догрузит следующую порцию
+	CouponsPending int `json:"coupons_pending,omitempty"`
+}
+
+// couponsPendingError — причина отсутствия YTM у облигации, график которой отложен до следующего вызова
+const couponsPendingError = "купонный график ещё не загружен"
+
+// screenedBond — строка результата скринера
+type screenedBond struct {
+	Bond  *pb.Bond
+	Yield bondYield
+}
+
+// yieldsFor рассчитывает доходности всех кандидатов: цены пакетами GetLastPrices, купонные графики —
+// из сохранённых файлов, недостающие — по одному GetBondCoupons с соблюдением лимита запросов.
+// За вызов загружается не более maxCouponFetches графиков; облигации с отложенными графиками
+// возвращаются без YTM (couponsPendingError), их число — в pending.
+func yieldsFor(ctx context.Context, ic *InvestClient, bonds []*pb.Bond, progress progressFunc) (out []screenedBond, pending int, err error) {
+	out = make([]screenedBond, 0, len(bonds))
+	var missing []*pb.Bond
+	for _, b := range bonds {
+		if y, ok := ic.bonds.yield(b.GetFigi()); ok {
+			out = append(out, screenedBond{Bond: b, Yield: y})
+		} else {
+			missing = append(missing, b)
+		}
+	}
+	if len(missing) == 0 {
+		return out, 0, nil
+	}
+
+	figis := make([]string, 0, len(missing))
+	for _, b := range missing {
+		figis = append(figis, b.GetFigi())
+	}
+	prices := make(map[string]*pb.LastPrice)
+	md := ic.sdk.NewMarketDataServiceClient()
+	for start := 0; start < len(figis); start += lastPricesBatch {
+		end := min(start+lastPricesBatch, len(figis))
+		lpResp, err := md.GetLastPrices(figis[start:end])
+		if err != nil {
+			return nil, 0, fmt.Errorf("ошибка получения последних цен: %w", err)
+		}
+		for _, lp := range lpResp.GetLastPrices() {
+			prices[lp.GetFigi()] = lp
+		}
+	}
+
+	now := time.Now().UTC()
+	// купоны нужны только облигациям с ценой и будущим погашением; бессрочные без оферты не считаются
+	var fetch []*pb.Bond
+	for _, b := range missing {
+		lp, ok := prices[b.GetFigi()]
+		if !ok || quotationToFloat(lp.GetPrice()) <= 0 || b.GetPerpetualFlag() || !b.GetMaturityDate().AsTime().After(now) {
+			continue
+		}
+		if _, ok := cachedCoupons(ic, b, b.GetMaturityDate().AsTime()); !ok {
+			fetch = append(fetch, b)
+		}
+	}
+	deferred := make(map[string]bool)
+	if len(fetch) > maxCouponFetches {
+		for _, b := range fetch[maxCouponFetches:] {
+			deferred[b.GetFigi()] = true
+		}
+		fetch = fetch[:maxCouponFetches]
+	}
+	for i, b := range fetch {
+		_, header, err := fetchCoupons(ic, b, now, b.GetMaturityDate().AsTime())
+		if err != nil {
+			log.Printf("Купоны %s не загружены: %v", b.GetTicker(), err)
+		}
+		progress(i+1, len(fetch), fmt.Sprintf("загружено купонных графиков %d из %d", i+1, len(fetch)))
+		if err := waitRateLimit(ctx, header, "GetBondCoupons"); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	for _, b := range missing {
+		if deferred[b.GetFigi()] {
+			// доходность не кэшируется: следующий вызов загрузит график и посчитает её
+			out = append(out, screenedBond{Bond: b, Yield: bondYield{Err: couponsPendingError}})
+			continue
+		}
+		y := bondYield{At: time.Now()}
+		lp, ok := prices[b.GetFigi()]
+		if !ok {
+			y.Err = "нет цены"
+		} else {
+			a := newBondAnalytics(b, quotationToFloat(lp.GetPrice()), lp.GetTime().AsTime())
+			y.CleanPercent = a.CleanPercent
+			if err := a.evaluate(ic, bondAnalyticsParams{OfferPercent: 100}, now); err != nil {
+				y.Err = err.Error()
+			} else {
+				y.YTM, y.CurrentYield, y.Duration = a.YTM, a.CurrentYield, a.Duration
+			}
+		}
+		ic.bonds.storeYield(b.GetFigi(), y)
+		out = append(out, screenedBond{Bond: b, Yield: y})
+	}
+	return out, len(deferred), nil
+}
+
+func parseRiskLevel(s string) (pb.RiskLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "":
+		return pb.RiskLevel_RISK_LEVEL_UNSPECIFIED, nil
+	case "low":
+		return pb.RiskLevel_RISK_LEVEL_LOW, nil
+	case "moderate", "medium":
+		return pb.RiskLevel_RISK_LEVEL_MODERATE, nil
+	case "high":
+		return pb.RiskLevel_RISK_LEVEL_HIGH, nil
+	default:
+		return 0, fmt.Errorf("неизвестный risk_level %q. Допустимо: low,moderate,high", s)
+	}
+}
+
+func parseDateArg(req mcp.CallToolRequest, key string) (time.Time, error) {
+	s := strings.TrimSpace(req.GetString(key, ""))
+	if s == "" {
+		return time.Time{}, nil
+	}
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("некорректный формат %s: %v", key, err)
+	}
+	return d, nil
+}
+
+// optionalFloat возвращает указатель на значение, если аргумент передан
+func optionalFloat(req mcp.CallToolRequest, key string) *float64 {
+	if _, ok := req.GetArguments()[key]; !ok {
+		return nil
+	}
+	v := req.GetFloat(key, 0)
+	return &v
+}
+
+func optionalBool(req mcp.CallToolRequest, key string) *bool {
+	if _, ok := req.GetArguments()[key]; !ok {
+		return nil
+	}
+	v := req.GetBool(key, false)
+	return &v
+}
+
+func bondScreenerHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	var f BondScreenerFilter
+	var err error
+	f.Currency = strings.TrimSpace(req.GetString("currency", ""))
+	f.Sector = strings.TrimSpace(req.GetString("sector", ""))
+	if f.MaturityFrom, err = parseDateArg(req, "maturity_from"); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if f.MaturityTo, err = parseDateArg(req, "maturity_to"); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	f.CouponType = strings.ToLower(strings.TrimSpace(req.GetString("coupon_type", "")))
+	if f.CouponType != "" && f.CouponType != "fixed" && f.CouponType != "floating" {
+		return mcp.NewToolResultError(fmt.Sprintf("неизвестный coupon_type %q. Допустимо: fixed,floating", f.CouponType)), nil
+	}
+	f.Amortization = optionalBool(req, "amortization")
+	if f.RiskLevel, err = parseRiskLevel(req.GetString("risk_level", "")); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if v := optionalFloat(req, "ytm_min"); v != nil {
+		p := *v / 100
+		f.YTMMin = &p
+	}
+	if v := optionalFloat(req, "ytm_max"); v != nil {
+		p := *v / 100
+		f.YTMMax = &p
+	}
+	page := req.GetInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	pageSize := req.GetInt("page_size", 20)
+	if pageSize < 1 {
+		pageSize = 1
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+
+	all, err := ic.bonds.list(ic)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка загрузки списка облигаций: %v", err)), nil
+	}
+	now := time.Now()
+	var candidates []*pb.Bond
+	for _, b := range all {
+		if b.GetMaturityDate().AsTime().Before(now) && !b.GetPerpetualFlag() {
+			continue
+		}
+		if f.match(b) {
+			candidates = append(candidates, b)
+		}
+	}
+	screened, pending, err := yieldsFor(ctx, ic, candidates, toolProgress(ctx, req))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	pendingNote := ""
+	if pending > 0 {
+		pendingNote = fmt.Sprintf("\nРезультат неполный: купонные графики загружаются порциями по %d, осталось %d — у этих облигаций YTM не рассчитана. "+
+			"Загруженные графики сохранены, повторите вызов", maxCouponFetches, pending)
+	}
+	var rows []screenedBond
+	for _, s := range screened {
+		if s.Yield.Err != "" {
+			if f.YTMMin != nil || f.YTMMax != nil {
+				continue
+			}
+		} else {
+			if f.YTMMin != nil && s.Yield.YTM < *f.YTMMin {
+				continue
+			}
+			if f.YTMMax != nil && s.Yield.YTM > *f.YTMMax {
+				continue
+			}
+		}
+		rows = append(rows, s)
+	}
+	// по убыванию доходности; облигации без рассчитанной доходности — в конце
+	sort.SliceStable(rows, func(i, j int) bool {
+		ei, ej := rows[i].Yield.Err != "", rows[j].Yield.Err != ""
+		if ei != ej {
+			return !ei
+		}
+		return rows[i].Yield.YTM > rows[j].Yield.YTM
+	})
+
+	if len(rows) == 0 {
+		return mcp.NewToolResultStructured(BondScreenerOutput{Page: 1, Bonds: []ScreenedBondJSON{}, CouponsPending: pending},
+			"Облигации по заданным критериям не найдены"+pendingNote), nil
+	}
+	pages := (len(rows) + pageSize - 1) / pageSize
+	if page > pages {
+		return mcp.NewToolResultError(fmt.Sprintf("Страница %d вне диапазона: всего страниц %d", page, pages)), nil
+	}
+	start := (page - 1) * pageSize
+	end := start + pageSize
+	if end > len(rows) {
+		end = len(rows)
+	}
+
+	result := BondScreenerOutput{Total: len(rows), Page: page, Pages: pages, Bonds: []ScreenedBondJSON{}, CouponsPending: pending}
+	var lines []string
+	for _, r := range rows[start:end] {
+		b := r.Bond
+		result.Bonds = append(result.Bonds, r.JSON())
+		coupon := "фикс."
+		if b.GetFloatingCouponFlag() {
+			coupon = "плав."
+		}
+		yield := "YTM: н/д (" + r.Yield.Err + ")"
+		if r.Yield.Err == "" {
+			yield = fmt.Sprintf("YTM: %.2f%%, тек. дох.: %.2f%%, дюрация: %.2f г.",
+				r.Yield.YTM*100, r.Yield.CurrentYield*100, r.Yield.Duration)
+		}
+		lines = append(lines, fmt.Sprintf("%s (%s) – FIGI: %s, %s, погашение %s, купон %s, амортизация: %s, сектор: %s, риск: %v, цена %.2f%%, %s",
+			b.GetName(), b.GetTicker(), b.GetFigi(), strings.ToUpper(b.GetCurrency()),
+			formatDate(b.GetMaturityDate()), coupon, yesNo(b.GetAmortizationFlag()), valueOrDash(b.GetSector()),
+			b.GetRiskLevel(), r.Yield.CleanPercent, yield))
+	}
+	header := fmt.Sprintf("Найдено облигаций: %d, страница %d из %d", len(rows), page, pages)
+	return mcp.NewToolResultStructured(result, header+pendingNote+"\n"+formatList(lines)), nil
+}
+
+func (r screenedBond) JSON() ScreenedBondJSON {
+	b := r.Bond
+	out := ScreenedBondJSON{
+		Instrument:   InstrumentJSON{Figi: b.GetFigi(), Uid: b.GetUid(), Ticker: b.GetTicker(), ClassCode: b.GetClassCode(), Name: b.GetName(), Kind: "bond"},
+		Currency:     strings.ToLower(b.GetCurrency()),
+		MaturityDate: dateJSON(b.GetMaturityDate()),
+		Floating:     b.GetFloatingCouponFlag(),
+		Amortization: b.GetAmortizationFlag(),
+		Sector:       b.GetSector(),
+		RiskLevel:    strings.ToLower(strings.TrimPrefix(b.GetRiskLevel().String(), "RISK_LEVEL_")),
+		CleanPercent: floatJSON(r.Yield.CleanPercent, 4),
+		YieldError:   r.Yield.Err,
+	}
+	if r.Yield.Err == "" {
+		ytm, cy, d := roundTo(r.Yield.YTM*100, 4), roundTo(r.Yield.CurrentYield*100, 4), roundTo(r.Yield.Duration, 4)
+		out.YTM, out.CurrentYield, out.Duration = &ytm, &cy, &d
+	}
+	return out
+}
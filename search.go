@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+)
+
+// instrumentKinds — короткие имена типов инструментов, принимаемые параметром kind
+var instrumentKinds = map[string]pb.InstrumentType{
+	"share":    pb.InstrumentType_INSTRUMENT_TYPE_SHARE,
+	"bond":     pb.InstrumentType_INSTRUMENT_TYPE_BOND,
+	"etf":      pb.InstrumentType_INSTRUMENT_TYPE_ETF,
+	"future":   pb.InstrumentType_INSTRUMENT_TYPE_FUTURES,
+	"option":   pb.InstrumentType_INSTRUMENT_TYPE_OPTION,
+	"currency": pb.InstrumentType_INSTRUMENT_TYPE_CURRENCY,
+}
+
+// kindLabels — подписи для текстового вывода: именительный и родительный падеж мн. числа
+var kindLabels = map[pb.InstrumentType][2]string{
+	pb.InstrumentType_INSTRUMENT_TYPE_SHARE:    {"Акции", "акций"},
+	pb.InstrumentType_INSTRUMENT_TYPE_BOND:     {"Облигации", "облигаций"},
+	pb.InstrumentType_INSTRUMENT_TYPE_ETF:      {"Фонды", "фондов"},
+	pb.InstrumentType_INSTRUMENT_TYPE_FUTURES:  {"Фьючерсы", "фьючерсов"},
+	pb.InstrumentType_INSTRUMENT_TYPE_OPTION:   {"Опционы", "опционов"},
+	pb.InstrumentType_INSTRUMENT_TYPE_CURRENCY: {"Валюты", "валют"},
+}
+
+func kindName(k pb.InstrumentType) string {
+	for name, v := range instrumentKinds {
+		if v == k {
+			return name
+		}
+	}
+	return strings.ToLower(strings.TrimPrefix(k.String(), "INSTRUMENT_TYPE_"))
+}
+
+func parseInstrumentKind(s string) (pb.InstrumentType, error) {
+	k, ok := instrumentKinds[strings.ToLower(strings.TrimSpace(s))]
+	if !ok {
+		return 0, fmt.Errorf("неизвестный kind %q. Допустимо: share,bond,etf,future,option,currency", s)
+	}
+	return k, nil
+}
+
+// SearchFilter — параметры поиска инструментов поверх FindInstrument
+type SearchFilter struct {
+	Query         string
+	Kinds         []pb.InstrumentType
+	ClassCode     string
+	Currency      string
+	TradeableOnly bool
+	Limit         int
+}
+
+// SearchRow — строка результата поиска в структурированном виде
+type SearchRow struct {
+	Figi              string `json:"figi"`
+	Uid               string `json:"uid"`
+	Ticker            string `json:"ticker"`
+	ClassCode         string `json:"class_code"`
+	Name              string `json:"name"`
+	Kind              string `json:"kind"`
+	ApiTradeAvailable bool   `json:"api_trade_available"`
+	Currency          string `json:"currency,omitempty"`
+}
+
+// SearchOutput — структурированный результат search и search_*
+type SearchOutput struct {
+	Instruments []SearchRow `json:"instruments"`
+	// CurrencyUnknown — сколько инструментов исключено фильтром currency, потому что их валюту не удалось определить
+	CurrencyUnknown int `json:"currency_unknown,omitempty"`
+}
+
+func (r SearchRow) String() string {
+	id := "FIGI: " + r.Figi
+	if r.Figi == "" {
+		// у опционов нет FIGI
+		id = "UID: " + r.Uid
+	}
+	return fmt.Sprintf("%s (%s) – %s", r.Name, r.Ticker, id)
+}
+
+// searchInstruments выполняет FindInstrument и применяет фильтры. Валюта не входит в
+// InstrumentShort, поэтому при фильтре по валюте она берётся из списка инструментов того же типа;
+// unknown — сколько инструментов исключено, потому что валюту определить не удалось.
+func searchInstruments(ic *InvestClient, f SearchFilter) (rows []SearchRow, unknown int, err error) {
+	resp, err := ic.sdk.NewInstrumentsServiceClient().FindInstrument(f.Query)
+	if err != nil {
+		return nil, 0, err
+	}
+	failedKinds := make(map[pb.InstrumentType]bool)
+	for _, it := range resp.GetInstruments() {
+		if f.Limit > 0 && len(rows) >= f.Limit {
+			break
+		}
+		if len(f.Kinds) > 0 && !containsKind(f.Kinds, it.GetInstrumentKind()) {
+			continue
+		}
+		if f.ClassCode != "" && !strings.EqualFold(it.GetClassCode(), f.ClassCode) {
+			continue
+		}
+		if f.TradeableOnly && !it.GetApiTradeAvailableFlag() {
+			continue
+		}
+		row := SearchRow{
+			Figi:              it.GetFigi(),
+			Uid:               it.GetUid(),
+			Ticker:            it.GetTicker(),
+			ClassCode:         it.GetClassCode(),
+			Name:              it.GetName(),
+			Kind:              kindName(it.GetInstrumentKind()),
+			ApiTradeAvailable: it.GetApiTradeAvailableFlag(),
+		}
+		if f.Currency != "" {
+			kind := it.GetInstrumentKind()
+			if failedKinds[kind] {
+				unknown++
+				continue
+			}
+			cur, ok, err := ic.catalog.currency(ic, kind, it.GetUid())
+			if err != nil {
+				log.Printf("Не удалось загрузить список инструментов %s: %v", kindName(kind), err)
+				failedKinds[kind] = true
+			}
+			if !ok {
+				unknown++
+				continue
+			}
+			row.Currency = cur
+			if !strings.EqualFold(row.Currency, f.Currency) {
+				continue
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, unknown, nil
+}
+
+func containsKind(kinds []pb.InstrumentType, k pb.InstrumentType) bool {
+	for _, v := range kinds {
+		if v == k {
+			return true
+		}
+	}
+	return false
+}
+
+// stringListArg читает аргумент-список: принимает как JSON-массив, так и строку через запятую
+func stringListArg(req mcp.CallToolRequest, key string) []string {
+	var raw []string
+	if s, ok := req.GetArguments()[key].(string); ok {
+		raw = strings.Split(s, ",")
+	} else {
+		raw = req.GetStringSlice(key, nil)
+	}
+	var out []string
+	for _, v := range raw {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// searchByKindHandler — общий обработчик search_stocks/search_bonds/... с фильтром по одному типу
+func searchByKindHandler(req mcp.CallToolRequest, ic *InvestClient, kind pb.InstrumentType) (*mcp.CallToolResult, error) {
+	query, _ := req.RequireString("query")
+	labels := kindLabels[kind]
+	rows, _, err := searchInstruments(ic, SearchFilter{Query: query, Kinds: []pb.InstrumentType{kind}})
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка поиска %s: %v", labels[1], err)), nil
+	}
+	result := SearchOutput{Instruments: rows}
+	if len(rows) == 0 {
+		result.Instruments = []SearchRow{}
+		return mcp.NewToolResultStructured(result, labels[0]+" по запросу не найдены"), nil
+	}
+	out := make([]string, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, r.String())
+	}
+	return mcp.NewToolResultStructured(result, fmt.Sprintf("Найдено %s:\n%s", labels[1], formatList(out))), nil
+}
+
+func searchStocksHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	return searchByKindHandler(req, ic, pb.InstrumentType_INSTRUMENT_TYPE_SHARE)
+}
+
+func searchBondsHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	return searchByKindHandler(req, ic, pb.InstrumentType_INSTRUMENT_TYPE_BOND)
+}
+
+func searchFundsHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	return searchByKindHandler(req, ic, pb.InstrumentType_INSTRUMENT_TYPE_ETF)
+}
+
+func searchFuturesHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	return searchByKindHandler(req, ic, pb.InstrumentType_INSTRUMENT_TYPE_FUTURES)
+}
+
+func searchOptionsHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	return searchByKindHandler(req, ic, pb.InstrumentType_INSTRUMENT_TYPE_OPTION)
+}
+
+func searchCurrenciesHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	return searchByKindHandler(req, ic, pb.InstrumentType_INSTRUMENT_TYPE_CURRENCY)
+}
+
+func searchHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	query, _ := req.RequireString("query")
+	f := SearchFilter{
+		Query:         query,
+		ClassCode:     strings.TrimSpace(req.GetString("class_code", "")),
+		Currency:      strings.TrimSpace(req.GetString("currency", "")),
+		TradeableOnly: req.GetBool("tradeable_only", false),
+		Limit:         req.GetInt("limit", 20),
+	}
+	if f.Limit < 1 {
+		f.Limit = 1
+	}
+	if f.Limit > 100 {
+		f.Limit = 100
+	}
+	for _, k := range stringListArg(req, "kind") {
+		kind, err := parseInstrumentKind(k)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		f.Kinds = append(f.Kinds, kind)
+	}
+
+	rows, unknown, err := searchInstruments(ic, f)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка поиска инструментов: %v", err)), nil
+	}
+	result := SearchOutput{Instruments: rows, CurrencyUnknown: unknown}
+	note := ""
+	if unknown > 0 {
+		note = fmt.Sprintf("\nВалюту не удалось определить для %d инструментов — они исключены фильтром currency", unknown)
+	}
+	if len(rows) == 0 {
+		result.Instruments = []SearchRow{}
+		return mcp.NewToolResultStructured(result, "Инструменты по запросу не найдены"+note), nil
+	}
+	out := make([]string, 0, len(rows))
+	for _, r := range rows {
+		line := fmt.Sprintf("%s [%s, %s], API: %s", r.String(), r.Kind, r.ClassCode, yesNo(r.ApiTradeAvailable))
+		if r.Currency != "" {
+			line += ", валюта: " + strings.ToUpper(r.Currency)
+		}
+		out = append(out, line)
+	}
+	return mcp.NewToolResultStructured(result, fmt.Sprintf("Найдено инструментов: %d\n%s", len(rows), formatList(out))+note), nil
+}
@@ -0,0 +1,853 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/tinkoff/invest-api-go-sdk/investgo"
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+)
+
+const (
+	// marketResourcePrefix — URI ресурса с живым состоянием инструмента: tinvest://market/{uid}
+	marketResourcePrefix = "tinvest://market/"
+	// streamNotifyInterval — как часто клиентам отправляются notifications/resources/updated
+	streamNotifyInterval = time.Second
+	// streamReconnectDelay — пауза перед первой попыткой переподключения упавшего стрима;
+	// после каждой неудачи пауза удваивается до streamReconnectMaxDelay
+	streamReconnectDelay    = 5 * time.Second
+	streamReconnectMaxDelay = 5 * time.Minute
+	// streamTradesKept — сколько последних сделок хранится по инструменту
+	streamTradesKept = 20
+)
+
+// Виды потоковых данных
+const (
+	streamLastPrice = "lastprice"
+	streamOrderBook = "orderbook"
+	streamTrades    = "trades"
+	streamCandles   = "candles"
+)
+
+var streamKinds = []string{streamLastPrice, streamOrderBook, streamTrades, streamCandles}
+
+// MarketState — последнее полученное из стрима состояние инструмента
+type MarketState struct {
+	Ref       *InstrumentRef
+	Kinds     map[string]bool
+	Depth     int32
+	Interval  pb.SubscriptionInterval
+	LastPrice *pb.LastPrice
+	OrderBook *pb.OrderBook
+	Trades    []*pb.Trade
+	Candle    *pb.Candle
+	Updated   time.Time
+}
+
+func (s *MarketState) uri() string { return marketResourcePrefix + s.Ref.Uid }
+
+// kindList — виды данных, на которые оформлена подписка, в стабильном порядке
+func (s *MarketState) kindList() []string {
+	kinds := make([]string, 0, len(s.Kinds))
+	for _, k := range streamKinds {
+		if s.Kinds[k] {
+			kinds = append(kinds, k)
+		}
+	}
+	return kinds
+}
+
+// snapshot — копия состояния, которую можно читать без блокировки
+func (s *MarketState) snapshot() MarketState {
+	cp := *s
+	cp.Kinds = make(map[string]bool, len(s.Kinds))
+	for k, v := range s.Kinds {
+		cp.Kinds[k] = v
+	}
+	cp.Trades = append([]*pb.Trade(nil), s.Trades...)
+	return cp
+}
+
+// marketStreamer держит один MarketDataStream на процесс, раскладывает ответы по MarketState
+// и уведомляет подписавшиеся MCP-сессии об изменении ресурсов tinvest://market/{uid}
+type marketStreamer struct {
+	mu       sync.Mutex
+	ic       *InvestClient
+	srv      *server.MCPServer
+	stream   *investgo.MarketDataStream
+	states   map[string]*MarketState    // по UID инструмента
+	byFigi   map[string]string          // FIGI → UID: часть ответов стрима приходит только с FIGI
+	sessions map[string]map[string]bool // UID → ID сессий, которые подписались
+	dirty    map[string]bool            // UID с изменениями, о которых ещё не уведомили
+	// listeners вызываются на обновления состояния (напр. движок алертов) из отдельной горутины,
+	// чтобы медленный обработчик не задерживал чтение стрима
+	listeners []func(MarketState)
+	pending   map[string]MarketState // UID → последнее состояние, ещё не переданное listeners
+	wake      chan struct{}
+	// resMu упорядочивает регистрацию и удаление ресурсов tinvest://market/{uid}: берётся до отпускания mu,
+	// поэтому ресурсы меняются в том же порядке, что и состояния подписок
+	resMu sync.Mutex
+}
+
+func newMarketStreamer(ic *InvestClient, srv *server.MCPServer) *marketStreamer {
+	ms := &marketStreamer{
+		ic:       ic,
+		srv:      srv,
+		states:   make(map[string]*MarketState),
+		byFigi:   make(map[string]string),
+		sessions: make(map[string]map[string]bool),
+		dirty:    make(map[string]bool),
+		pending:  make(map[string]MarketState),
+		wake:     make(chan struct{}, 1),
+	}
+	srv.AddResourceTemplate(
+		mcp.NewResourceTemplate(marketResourcePrefix+"{uid}", "Живое состояние инструмента",
+			mcp.WithTemplateDescription("Последняя цена, стакан, сделки и свеча из MarketDataStream; доступно после вызова subscribe"),
+			mcp.WithTemplateMIMEType("application/json")),
+		ms.readResource)
+	go ms.notifyLoop()
+	go ms.dispatchLoop()
+	return ms
+}
+
+// ensureStream открывает стрим, если он не открыт, и восстанавливает в нём все текущие подписки;
+// вызывается под ms.mu
+func (ms *marketStreamer) ensureStream() error {
+	if ms.stream != nil {
+		return nil
+	}
+	stream, err := ms.ic.sdk.NewMarketDataStreamClient().MarketDataStream()
+	if err != nil {
+		return fmt.Errorf("ошибка открытия MarketDataStream: %w", err)
+	}
+	ms.stream = stream
+	go ms.listen(stream)
+	for _, st := range ms.states {
+		if err := ms.sendSubscriptionsLocked(st, st.Kinds); err != nil {
+			ms.stream = nil
+			stream.Stop()
+			return fmt.Errorf("%s: %w", st.Ref.Ticker, err)
+		}
+	}
+	return nil
+}
+
+// listen читает стрим до его завершения; при обрыве запускает переподключение
+func (ms *marketStreamer) listen(stream *investgo.MarketDataStream) {
+	err := stream.Listen()
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.stream != stream {
+		return
+	}
+	ms.stream = nil
+	if err == nil || len(ms.states) == 0 {
+		return
+	}
+	log.Printf("MarketDataStream оборвался: %v", err)
+	ms.reportLocked(mcp.LoggingLevelWarning, fmt.Sprintf("MarketDataStream оборвался: %v; подписки будут восстановлены автоматически", err))
+	go ms.reconnect()
+}
+
+// reconnect переоткрывает стрим с нарастающей паузой, пока это не удастся
+// или пока не останется подписок
+func (ms *marketStreamer) reconnect() {
+	delay := streamReconnectDelay
+	for {
+		time.Sleep(delay)
+		ms.mu.Lock()
+		if ms.stream != nil || len(ms.states) == 0 {
+			ms.mu.Unlock()
+			return
+		}
+		err := ms.ensureStream()
+		if err == nil {
+			log.Printf("MarketDataStream восстановлен")
+			ms.reportLocked(mcp.LoggingLevelInfo, "MarketDataStream восстановлен, подписки возобновлены")
+			ms.mu.Unlock()
+			return
+		}
+		delay = min(delay*2, streamReconnectMaxDelay)
+		log.Printf("Не удалось восстановить MarketDataStream: %v; следующая попытка через %v", err, delay)
+		ms.reportLocked(mcp.LoggingLevelError, fmt.Sprintf("Не удалось восстановить MarketDataStream: %v; следующая попытка через %v", err, delay))
+		ms.mu.Unlock()
+	}
+}
+
+// reportLocked отправляет сообщение о состоянии стрима подписавшимся сессиям как notifications/message;
+// вызывается под ms.mu
+func (ms *marketStreamer) reportLocked(level mcp.LoggingLevel, message string) {
+	params := map[string]any{"level": level, "logger": "stream", "data": message}
+	sessions := make(map[string]bool)
+	for _, set := range ms.sessions {
+		for id := range set {
+			sessions[id] = true
+		}
+	}
+	go func() {
+		if len(sessions) == 0 {
+			ms.srv.SendNotificationToAllClients("notifications/message", params)
+			return
+		}
+		for id := range sessions {
+			if err := ms.srv.SendNotificationToSpecificClient(id, "notifications/message", params); err != nil {
+				ms.forgetSession(id)
+			}
+		}
+	}()
+}
+
+// subscribeLocked отправляет в стрим подписки kinds для инструмента, открывая стрим при необходимости;
+// вызывается под ms.mu
+func (ms *marketStreamer) subscribeLocked(st *MarketState, kinds map[string]bool) error {
+	if err := ms.ensureStream(); err != nil {
+		return err
+	}
+	return ms.sendSubscriptionsLocked(st, kinds)
+}
+
+// sendSubscriptionsLocked отправляет подписки kinds в уже открытый стрим; вызывается под ms.mu
+func (ms *marketStreamer) sendSubscriptionsLocked(st *MarketState, kinds map[string]bool) error {
+	ids := []string{st.Ref.Uid}
+	for _, kind := range streamKinds {
+		if !kinds[kind] {
+			continue
+		}
+		var err error
+		switch kind {
+		case streamLastPrice:
+			var ch <-chan *pb.LastPrice
+			if ch, err = ms.stream.SubscribeLastPrice(ids); err == nil {
+				ms.drain(kind, func() { forEach(ch, ms.onLastPrice) })
+			}
+		case streamOrderBook:
+			var ch <-chan *pb.OrderBook
+			if ch, err = ms.stream.SubscribeOrderBook(ids, st.Depth); err == nil {
+				ms.drain(kind, func() { forEach(ch, ms.onOrderBook) })
+			}
+		case streamTrades:
+			var ch <-chan *pb.Trade
+			if ch, err = ms.stream.SubscribeTrade(ids); err == nil {
+				ms.drain(kind, func() { forEach(ch, ms.onTrade) })
+			}
+		case streamCandles:
+			var ch <-chan *pb.Candle
+			if ch, err = ms.stream.SubscribeCandle(ids, st.Interval, false); err == nil {
+				ms.drain(kind, func() { forEach(ch, ms.onCandle) })
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("подписка %s: %w", kind, err)
+		}
+	}
+	return nil
+}
+
+// drained отмечает, для каких видов данных текущего стрима уже запущен читатель канала.
+// SDK отдаёт один канал на вид данных, и стрим блокируется, если канал никто не читает.
+var drained = struct {
+	sync.Mutex
+	streams map[*investgo.MarketDataStream]map[string]bool
+}{streams: make(map[*investgo.MarketDataStream]map[string]bool)}
+
+func (ms *marketStreamer) drain(kind string, read func()) {
+	drained.Lock()
+	defer drained.Unlock()
+	kinds, ok := drained.streams[ms.stream]
+	if !ok {
+		kinds = make(map[string]bool)
+		drained.streams[ms.stream] = kinds
+	}
+	if kinds[kind] {
+		return
+	}
+	kinds[kind] = true
+	stream := ms.stream
+	go func() {
+		read()
+		// канал закрыт — стрим завершён
+		drained.Lock()
+		delete(drained.streams, stream)
+		drained.Unlock()
+	}()
+}
+
+func forEach[T any](ch <-chan T, fn func(T)) {
+	for v := range ch {
+		fn(v)
+	}
+}
+
+// update находит состояние инструмента по UID/FIGI ответа и применяет к нему изменение
+func (ms *marketStreamer) update(uid, figi string, apply func(*MarketState)) {
+	ms.mu.Lock()
+	if uid == "" {
+		uid = ms.byFigi[figi]
+	}
+	st, ok := ms.states[uid]
+	if !ok {
+		ms.mu.Unlock()
+		return
+	}
+	apply(st)
+	st.Updated = time.Now()
+	ms.dirty[uid] = true
+	if len(ms.listeners) > 0 {
+		ms.pending[uid] = st.snapshot()
+		select {
+		case ms.wake <- struct{}{}:
+		default:
+		}
+	}
+	ms.mu.Unlock()
+}
+
+// dispatchLoop передаёт обновления listeners вне горутин чтения стрима. Пока обработчики заняты,
+// обновления одного инструмента схлопываются до последнего состояния.
+func (ms *marketStreamer) dispatchLoop() {
+	for range ms.wake {
+		ms.mu.Lock()
+		pending := ms.pending
+		ms.pending = make(map[string]MarketState)
+		listeners := ms.listeners
+		ms.mu.Unlock()
+		for _, snap := range pending {
+			for _, fn := range listeners {
+				fn(snap)
+			}
+		}
+	}
+}
+
+func (ms *marketStreamer) onLastPrice(lp *pb.LastPrice) {
+	ms.update(lp.GetInstrumentUid(), lp.GetFigi(), func(st *MarketState) { st.LastPrice = lp })
+}
+
+func (ms *marketStreamer) onOrderBook(ob *pb.OrderBook) {
+	ms.update(ob.GetInstrumentUid(), ob.GetFigi(), func(st *MarketState) { st.OrderBook = ob })
+}
+
+func (ms *marketStreamer) onTrade(t *pb.Trade) {
+	ms.update(t.GetInstrumentUid(), t.GetFigi(), func(st *MarketState) {
+		st.Trades = append(st.Trades, t)
+		if len(st.Trades) > streamTradesKept {
+			st.Trades = st.Trades[len(st.Trades)-streamTradesKept:]
+		}
+	})
+}
+
+func (ms *marketStreamer) onCandle(c *pb.Candle) {
+	ms.update(c.GetInstrumentUid(), c.GetFigi(), func(st *MarketState) { st.Candle = c })
+}
+
+// notifyLoop раз в streamNotifyInterval рассылает notifications/resources/updated по изменившимся ресурсам
+// сессиям, вызвавшим subscribe, чтобы частые обновления стакана не заваливали клиента. Подписка без
+// сессии (напр. только для алертов) уведомлений не порождает
+func (ms *marketStreamer) notifyLoop() {
+	ticker := time.NewTicker(streamNotifyInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ms.mu.Lock()
+		type target struct {
+			uri      string
+			sessions []string
+		}
+		var targets []target
+		for uid := range ms.dirty {
+			if len(ms.sessions[uid]) == 0 {
+				continue
+			}
+			t := target{uri: marketResourcePrefix + uid}
+			for id := range ms.sessions[uid] {
+				t.sessions = append(t.sessions, id)
+			}
+			targets = append(targets, t)
+		}
+		ms.dirty = make(map[string]bool)
+		ms.mu.Unlock()
+
+		for _, t := range targets {
+			params := map[string]any{"uri": t.uri}
+			for _, id := range t.sessions {
+				if err := ms.srv.SendNotificationToSpecificClient(id, string(mcp.MethodNotificationResourceUpdated), params); err != nil {
+					ms.forgetSession(id)
+				}
+			}
+		}
+	}
+}
+
+// forgetSession убирает отключившуюся сессию из получателей уведомлений
+func (ms *marketStreamer) forgetSession(id string) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, set := range ms.sessions {
+		delete(set, id)
+	}
+}
+
+// Subscribe подписывает инструменты на виды данных kinds; sessionID — кому слать уведомления.
+// При ошибке на одном из инструментов уже подписанные остаются подписанными и получают свои ресурсы.
+func (ms *marketStreamer) Subscribe(refs []*InstrumentRef, kinds []string, depth int32, interval pb.SubscriptionInterval, sessionID string) error {
+	ms.mu.Lock()
+	added, err := ms.subscribeRefsLocked(refs, kinds, depth, interval, sessionID)
+	ms.resMu.Lock()
+	ms.mu.Unlock()
+	defer ms.resMu.Unlock()
+	if len(added) > 0 {
+		ms.srv.AddResources(resourcesWithHandler(added, ms.readResource)...)
+	}
+	return err
+}
+
+// subscribeRefsLocked — Subscribe под ms.mu; возвращает ресурсы новых инструментов, подписанных до ошибки
+func (ms *marketStreamer) subscribeRefsLocked(refs []*InstrumentRef, kinds []string, depth int32, interval pb.SubscriptionInterval, sessionID string) ([]mcp.Resource, error) {
+	var added []mcp.Resource
+	for _, ref := range refs {
+		st, ok := ms.states[ref.Uid]
+		if !ok {
+			st = &MarketState{Ref: ref, Kinds: make(map[string]bool), Depth: depth, Interval: interval}
+			ms.states[ref.Uid] = st
+			ms.byFigi[ref.Figi] = ref.Uid
+		}
+		fresh := make(map[string]bool)
+		for _, k := range kinds {
+			// стакан другой глубины и свечи другого интервала переподписываются
+			if !st.Kinds[k] || (k == streamOrderBook && st.Depth != depth) || (k == streamCandles && st.Interval != interval) {
+				fresh[k] = true
+			}
+		}
+		st.Depth, st.Interval = depth, interval
+		if err := ms.subscribeLocked(st, fresh); err != nil {
+			if len(st.Kinds) == 0 {
+				delete(ms.states, ref.Uid)
+				delete(ms.byFigi, ref.Figi)
+			}
+			return added, fmt.Errorf("%s: %w", ref.Ticker, err)
+		}
+		for k := range fresh {
+			st.Kinds[k] = true
+		}
+		if !ok {
+			added = append(added, mcp.NewResource(st.uri(), fmt.Sprintf("%s (%s): живые данные", ref.Name, ref.Ticker),
+				mcp.WithMIMEType("application/json")))
+		}
+		if sessionID != "" {
+			if ms.sessions[ref.Uid] == nil {
+				ms.sessions[ref.Uid] = make(map[string]bool)
+			}
+			ms.sessions[ref.Uid][sessionID] = true
+		}
+	}
+	return added, nil
+}
+
+// Unsubscribe отписывает инструменты от kinds (пусто — от всего) и убирает их ресурсы, когда подписок не осталось;
+// ресурсы инструментов, отписанных до ошибки, тоже убираются
+func (ms *marketStreamer) Unsubscribe(refs []*InstrumentRef, kinds []string) error {
+	ms.mu.Lock()
+	removed, err := ms.unsubscribeLocked(refs, kinds)
+	ms.resMu.Lock()
+	ms.mu.Unlock()
+	defer ms.resMu.Unlock()
+	if len(removed) > 0 {
+		ms.srv.DeleteResources(removed...)
+	}
+	return err
+}
+
+// unsubscribeLocked — Unsubscribe под ms.mu; возвращает URI ресурсов, которые нужно убрать
+func (ms *marketStreamer) unsubscribeLocked(refs []*InstrumentRef, kinds []string) ([]string, error) {
+	if len(kinds) == 0 {
+		kinds = streamKinds
+	}
+	var removed []string
+	for _, ref := range refs {
+		st, ok := ms.states[ref.Uid]
+		if !ok {
+			continue
+		}
+		ids := []string{ref.Uid}
+		for _, k := range kinds {
+			if !st.Kinds[k] {
+				continue
+			}
+			var err error
+			if ms.stream != nil {
+				switch k {
+				case streamLastPrice:
+					err = ms.stream.UnSubscribeLastPrice(ids)
+				case streamOrderBook:
+					err = ms.stream.UnSubscribeOrderBook(ids)
+				case streamTrades:
+					err = ms.stream.UnSubscribeTrade(ids)
+				case streamCandles:
+					err = ms.stream.UnSubscribeCandle(ids, st.Interval, false)
+				}
+			}
+			if err != nil {
+				return removed, fmt.Errorf("%s: отписка %s: %w", ref.Ticker, k, err)
+			}
+			delete(st.Kinds, k)
+		}
+		if len(st.Kinds) == 0 {
+			delete(ms.states, ref.Uid)
+			delete(ms.byFigi, ref.Figi)
+			delete(ms.sessions, ref.Uid)
+			removed = append(removed, st.uri())
+		}
+	}
+	if len(ms.states) == 0 && ms.stream != nil {
+		ms.stream.Stop()
+		ms.stream = nil
+	}
+	return removed, nil
+}
+
+// Snapshot возвращает копию состояния инструмента, если на него есть подписка
+func (ms *marketStreamer) Snapshot(uid string) (MarketState, bool) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	st, ok := ms.states[uid]
+	if !ok {
+		return MarketState{}, false
+	}
+	return st.snapshot(), true
+}
+
+// Subscriptions — копии всех текущих состояний, упорядоченные по тикеру
+func (ms *marketStreamer) Subscriptions() []MarketState {
+	ms.mu.Lock()
+	uids := make([]string, 0, len(ms.states))
+	for uid := range ms.states {
+		uids = append(uids, uid)
+	}
+	ms.mu.Unlock()
+	var out []MarketState
+	for _, uid := range uids {
+		if st, ok := ms.Snapshot(uid); ok {
+			out = append(out, st)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Ref.Ticker < out[j].Ref.Ticker })
+	return out
+}
+
+// AddListener регистрирует обработчик обновлений состояния
+func (ms *marketStreamer) AddListener(fn func(MarketState)) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.listeners = append(ms.listeners, fn)
+}
+
+func resourcesWithHandler(resources []mcp.Resource, h server.ResourceHandlerFunc) []server.ServerResource {
+	out := make([]server.ServerResource, 0, len(resources))
+	for _, r := range resources {
+		out = append(out, server.ServerResource{Resource: r, Handler: h})
+	}
+	return out
+}
+
+func (ms *marketStreamer) readResource(ctx context.Context, req mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	uid := strings.TrimPrefix(req.Params.URI, marketResourcePrefix)
+	st, ok := ms.Snapshot(uid)
+	if !ok {
+		return nil, fmt.Errorf("нет подписки на инструмент %s: вызовите subscribe", uid)
+	}
+	data, err := json.MarshalIndent(marketStateJSON(st), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []mcp.ResourceContents{mcp.TextResourceContents{URI: req.Params.URI, MIMEType: "application/json", Text: string(data)}}, nil
+}
+
+// marketStateJSON — представление состояния для ресурса: цены точными строками, время в RFC3339 UTC
+func marketStateJSON(st MarketState) map[string]any {
+	ts := func(t time.Time) string { return t.UTC().Format(time.RFC3339Nano) }
+	out := map[string]any{
+		"figi": st.Ref.Figi, "uid": st.Ref.Uid, "ticker": st.Ref.Ticker, "name": st.Ref.Name,
+		"subscriptions": st.kindList(),
+	}
+	if !st.Updated.IsZero() {
+		out["updated"] = ts(st.Updated)
+	}
+	if lp := st.LastPrice; lp != nil {
+		out["last_price"] = map[string]any{"price": quotationToStr(lp.GetPrice()), "time": ts(lp.GetTime().AsTime())}
+	}
+	if ob := st.OrderBook; ob != nil {
+		levels := func(orders []*pb.Order) []map[string]any {
+			res := make([]map[string]any, 0, len(orders))
+			for _, o := range orders {
+				res = append(res, map[string]any{"price": quotationToStr(o.GetPrice()), "quantity": o.GetQuantity()})
+			}
+			return res
+		}
+		out["order_book"] = map[string]any{
+			"depth": ob.GetDepth(), "consistent": ob.GetIsConsistent(), "time": ts(ob.GetTime().AsTime()),
+			"bids": levels(ob.GetBids()), "asks": levels(ob.GetAsks()),
+			"limit_up": quotationToStr(ob.GetLimitUp()), "limit_down": quotationToStr(ob.GetLimitDown()),
+		}
+	}
+	if len(st.Trades) > 0 {
+		trades := make([]map[string]any, 0, len(st.Trades))
+		for _, t := range st.Trades {
+			trades = append(trades, map[string]any{
+				"direction": tradeDirectionName(t.GetDirection()), "price": quotationToStr(t.GetPrice()),
+				"quantity": t.GetQuantity(), "time": ts(t.GetTime().AsTime()),
+			})
+		}
+		out["trades"] = trades
+	}
+	if c := st.Candle; c != nil {
+		out["candle"] = map[string]any{
+			"interval": subscriptionIntervalName(c.GetInterval()), "time": ts(c.GetTime().AsTime()),
+			"open": quotationToStr(c.GetOpen()), "high": quotationToStr(c.GetHigh()),
+			"low": quotationToStr(c.GetLow()), "close": quotationToStr(c.GetClose()), "volume": c.GetVolume(),
+		}
+	}
+	return out
+}
+
+func tradeDirectionName(d pb.TradeDirection) string {
+	switch d {
+	case pb.TradeDirection_TRADE_DIRECTION_BUY:
+		return "buy"
+	case pb.TradeDirection_TRADE_DIRECTION_SELL:
+		return "sell"
+	}
+	return "unspecified"
+}
+
+func subscriptionIntervalName(i pb.SubscriptionInterval) string {
+	if i == pb.SubscriptionInterval_SUBSCRIPTION_INTERVAL_FIVE_MINUTES {
+		return "5m"
+	}
+	return "1m"
+}
+
+func parseSubscriptionInterval(s string) (pb.SubscriptionInterval, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "1m", "1min":
+		return pb.SubscriptionInterval_SUBSCRIPTION_INTERVAL_ONE_MINUTE, nil
+	case "5m", "5min":
+		return pb.SubscriptionInterval_SUBSCRIPTION_INTERVAL_FIVE_MINUTES, nil
+	}
+	return 0, fmt.Errorf("неизвестный candle_interval %q. Для стрима допустимо: 1m,5m", s)
+}
+
+func parseStreamKinds(req mcp.CallToolRequest) ([]string, error) {
+	kinds := stringListArg(req, "data")
+	for i, k := range kinds {
+		k = strings.ToLower(k)
+		switch k {
+		case "last_price", "price":
+			k = streamLastPrice
+		case "order_book", "book":
+			k = streamOrderBook
+		case "trade":
+			k = streamTrades
+		case "candle":
+			k = streamCandles
+		}
+		found := false
+		for _, known := range streamKinds {
+			found = found || k == known
+		}
+		if !found {
+			return nil, fmt.Errorf("неизвестный вид данных %q. Допустимо: lastprice,orderbook,trades,candles", kinds[i])
+		}
+		kinds[i] = k
+	}
+	return kinds, nil
+}
+
+// SubscriptionJSON — активная подписка на рыночные данные
+type SubscriptionJSON struct {
+	Instrument InstrumentJSON `json:"instrument"`
+	Kinds      []string       `json:"kinds"`
+	URI        string         `json:"uri"`
+	LastPrice  string         `json:"last_price,omitempty"`
+	Updated    string         `json:"updated,omitempty"`
+}
+
+// SubscriptionsOutput — структурированный результат subscribe и unsubscribe
+type SubscriptionsOutput struct {
+	Subscriptions []SubscriptionJSON `json:"subscriptions"`
+	Portfolios    []string           `json:"portfolios,omitempty"` // ресурсы портфелей, на которые подписана сессия
+	NotFound      []string           `json:"not_found,omitempty"`
+}
+
+func subscriptionsJSON(states []MarketState, failed []string) SubscriptionsOutput {
+	out := SubscriptionsOutput{Subscriptions: make([]SubscriptionJSON, 0, len(states)), NotFound: failed}
+	for _, st := range states {
+		sub := SubscriptionJSON{Instrument: st.Ref.JSON(), Kinds: st.kindList(), URI: st.uri(), Updated: timeJSON(st.Updated)}
+		if st.LastPrice != nil {
+			sub.LastPrice = quotationJSON(st.LastPrice.GetPrice())
+		}
+		out.Subscriptions = append(out.Subscriptions, sub)
+	}
+	return out
+}
+
+// formatSubscriptions — список текущих подписок для ответа инструментов
+func formatSubscriptions(states []MarketState) string {
+	if len(states) == 0 {
+		return "Активных подписок нет"
+	}
+	var lines []string
+	for _, st := range states {
+		line := fmt.Sprintf("%s (%s) – %s, ресурс %s", st.Ref.Name, st.Ref.Ticker, strings.Join(st.kindList(), ", "), st.uri())
+		if st.LastPrice != nil {
+			line += ", последняя цена " + quotationToStr(st.LastPrice.GetPrice())
+		}
+		lines = append(lines, line)
+	}
+	return "Подписки:\n" + formatList(lines)
+}
+
+// portfolioAccountArg — счёт из параметра portfolio: ID счёта или "selected" для TINKOFF_ACCOUNT_ID;
+// ID проверяется по списку счетов пользователя
+func portfolioAccountArg(ic *InvestClient, req mcp.CallToolRequest) (string, error) {
+	id := strings.TrimSpace(req.GetString("portfolio", ""))
+	if id == "" {
+		return "", nil
+	}
+	if strings.EqualFold(id, "selected") {
+		if ic.accountID == "" {
+			return "", fmt.Errorf("счёт не выбран: задайте TINKOFF_ACCOUNT_ID или передайте ID счёта")
+		}
+		return ic.accountID, nil
+	}
+	resp, err := ic.sdk.NewUsersServiceClient().GetAccounts()
+	if err != nil {
+		return "", fmt.Errorf("ошибка получения списка счетов: %w", err)
+	}
+	for _, acc := range resp.GetAccounts() {
+		if acc.GetId() == id {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("счёт %s не найден", id)
+}
+
+func portfolioURIs(accounts []string) []string {
+	out := make([]string, 0, len(accounts))
+	for _, id := range accounts {
+		out = append(out, portfolioResourcePrefix+id)
+	}
+	return out
+}
+
+func sessionIDFromContext(ctx context.Context) string {
+	if s := server.ClientSessionFromContext(ctx); s != nil {
+		return s.SessionID()
+	}
+	return ""
+}
+
+func subscribeHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient, ms *marketStreamer, pw *portfolioWatcher) (*mcp.CallToolResult, error) {
+	queries := stringListArg(req, "query")
+	account, err := portfolioAccountArg(ic, req)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if len(queries) == 0 && account == "" {
+		return mcp.NewToolResultError("Укажите инструменты (query) или счёт (portfolio)"), nil
+	}
+	sessionID := sessionIDFromContext(ctx)
+	if account != "" && sessionID == "" {
+		return mcp.NewToolResultError("Подписка на портфель доступна только в клиентской сессии"), nil
+	}
+
+	var lines, failed []string
+	if len(queries) > 0 {
+		kinds, err := parseStreamKinds(req)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if len(kinds) == 0 {
+			kinds = []string{streamLastPrice}
+		}
+		depth := req.GetInt("depth", 10)
+		if depth < 1 || depth > 50 {
+			return mcp.NewToolResultError("depth должен быть в диапазоне 1-50"), nil
+		}
+		interval, err := parseSubscriptionInterval(req.GetString("candle_interval", "1m"))
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		var refs []*InstrumentRef
+		refs, failed = findInstrumentRefs(ic, queries)
+		if len(refs) == 0 {
+			return mcp.NewToolResultError(strings.Join(failed, "\n")), nil
+		}
+		if err := ms.Subscribe(refs, kinds, int32(depth), interval, sessionID); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Ошибка подписки: %v", err)), nil
+		}
+		lines = append(lines, fmt.Sprintf("Подписка на рыночные данные оформлена (%s).", strings.Join(kinds, ", ")))
+	}
+	if account != "" {
+		pw.Watch(account, sessionID)
+		lines = append(lines, fmt.Sprintf("Подписка на изменения позиций оформлена: %s.", portfolioResourcePrefix+account))
+	}
+	return subscriptionsResult(ms, pw, sessionID, failed, strings.Join(lines, "\n")+
+		" Изменения приходят уведомлениями notifications/resources/updated, данные — через чтение ресурса."), nil
+}
+
+// subscriptionsResult — общий ответ subscribe и unsubscribe: рыночные подписки процесса и портфели сессии
+func subscriptionsResult(ms *marketStreamer, pw *portfolioWatcher, sessionID string, failed []string, head string) *mcp.CallToolResult {
+	subs := ms.Subscriptions()
+	out := subscriptionsJSON(subs, failed)
+	out.Portfolios = portfolioURIs(pw.Watched(sessionID))
+	text := head + "\n" + formatSubscriptions(subs)
+	if len(out.Portfolios) > 0 {
+		text = strings.TrimRight(text, "\n") + "\nПортфели:\n" + formatList(out.Portfolios)
+	}
+	if len(failed) > 0 {
+		text = strings.TrimRight(text, "\n") + "\nНе найдены:\n" + formatList(failed)
+	}
+	return mcp.NewToolResultStructured(out, text)
+}
+
+func unsubscribeHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient, ms *marketStreamer, pw *portfolioWatcher) (*mcp.CallToolResult, error) {
+	kinds, err := parseStreamKinds(req)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	account, err := portfolioAccountArg(ic, req)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	sessionID := sessionIDFromContext(ctx)
+	all := req.GetBool("all", false)
+	var refs []*InstrumentRef
+	var failed []string
+	if all {
+		for _, st := range ms.Subscriptions() {
+			refs = append(refs, st.Ref)
+		}
+		for _, id := range pw.Watched(sessionID) {
+			pw.Unwatch(id, sessionID)
+		}
+	} else {
+		refs, failed = findInstrumentRefs(ic, stringListArg(req, "query"))
+	}
+	if account != "" {
+		pw.Unwatch(account, sessionID)
+	}
+	if len(refs) == 0 && len(failed) > 0 {
+		return mcp.NewToolResultError(strings.Join(failed, "\n")), nil
+	}
+	if err := ms.Unsubscribe(refs, kinds); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка отписки: %v", err)), nil
+	}
+	return subscriptionsResult(ms, pw, sessionID, failed, "Отписка выполнена."), nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/shopspring/decimal"
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+)
+
+// lastTradesMaxWindow — GetLastTrades отдаёт обезличенные сделки только за последний час
+const lastTradesMaxWindow = time.Hour
+
+// tradeStats — агрегаты ленты сделок за окно
+type tradeStats struct {
+	Count      int
+	BuyLots    int64
+	SellLots   int64
+	OtherLots  int64
+	VWAP       decimal.Decimal
+	Low, High  decimal.Decimal
+	First, End time.Time
+}
+
+func (s tradeStats) totalLots() int64 { return s.BuyLots + s.SellLots + s.OtherLots }
+
+// summarizeTrades считает объёмы покупок/продаж и VWAP (средневзвешенная по лотам цена)
+func summarizeTrades(trades []*pb.Trade) tradeStats {
+	var s tradeStats
+	var turnover decimal.Decimal
+	for i, t := range trades {
+		price := quotationDecimal(t.GetPrice())
+		qty := t.GetQuantity()
+		switch t.GetDirection() {
+		case pb.TradeDirection_TRADE_DIRECTION_BUY:
+			s.BuyLots += qty
+		case pb.TradeDirection_TRADE_DIRECTION_SELL:
+			s.SellLots += qty
+		default:
+			s.OtherLots += qty
+		}
+		turnover = turnover.Add(price.Mul(decimal.NewFromInt(qty)))
+		if i == 0 || price.LessThan(s.Low) {
+			s.Low = price
+		}
+		if i == 0 || price.GreaterThan(s.High) {
+			s.High = price
+		}
+		ts := t.GetTime().AsTime()
+		if i == 0 || ts.Before(s.First) {
+			s.First = ts
+		}
+		if ts.After(s.End) {
+			s.End = ts
+		}
+	}
+	s.Count = len(trades)
+	if total := s.totalLots(); total > 0 {
+		s.VWAP = turnover.DivRound(decimal.NewFromInt(total), 9)
+	}
+	return s
+}
+
+func formatTradeStats(s tradeStats) string {
+	total := s.totalLots()
+	share := func(v int64) float64 { return float64(v) / float64(total) * 100 }
+	lines := []string{
+		fmt.Sprintf("Сделок: %d, объём: %d лот.", s.Count, total),
+		fmt.Sprintf("Покупки: %d лот. (%.1f%%), продажи: %d лот. (%.1f%%)", s.BuyLots, share(s.BuyLots), s.SellLots, share(s.SellLots)),
+		fmt.Sprintf("VWAP: %s, диапазон: %s – %s", s.VWAP.Round(6).String(), s.Low.String(), s.High.String()),
+		fmt.Sprintf("Первая сделка: %s, последняя: %s", s.First.UTC().Format(time.RFC3339), s.End.UTC().Format(time.RFC3339)),
+	}
+	if s.OtherLots > 0 {
+		lines = append(lines, fmt.Sprintf("Без направления: %d лот.", s.OtherLots))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// TradeJSON — обезличенная сделка
+type TradeJSON struct {
+	Time      string `json:"time"`
+	Direction string `json:"direction"`
+	Price     string `json:"price"`
+	Lots      int64  `json:"lots"`
+}
+
+// TradeStatsJSON — агрегаты ленты сделок
+type TradeStatsJSON struct {
+	Count     int    `json:"count"`
+	TotalLots int64  `json:"total_lots"`
+	BuyLots   int64  `json:"buy_lots"`
+	SellLots  int64  `json:"sell_lots"`
+	OtherLots int64  `json:"other_lots"`
+	VWAP      string `json:"vwap"`
+	Low       string `json:"low"`
+	High      string `json:"high"`
+	First     string `json:"first"`
+	Last      string `json:"last"`
+}
+
+// LastTradesOutput — структурированный результат last_trades
+type LastTradesOutput struct {
+	Instrument InstrumentJSON  `json:"instrument"`
+	From       string          `json:"from"`
+	To         string          `json:"to"`
+	Stats      *TradeStatsJSON `json:"stats,omitempty"`
+	Trades     []TradeJSON     `json:"trades"`
+}
+
+func (s tradeStats) JSON() *TradeStatsJSON {
+	return &TradeStatsJSON{
+		Count: s.Count, TotalLots: s.totalLots(), BuyLots: s.BuyLots, SellLots: s.SellLots, OtherLots: s.OtherLots,
+		VWAP: s.VWAP.Round(6).String(), Low: s.Low.String(), High: s.High.String(),
+		First: timeJSON(s.First), Last: timeJSON(s.End),
+	}
+}
+
+func lastTradesHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	q, _ := req.RequireString("query")
+	limit := req.GetInt("limit", 50)
+	if limit < 0 || limit > 500 {
+		return mcp.NewToolResultError("limit должен быть в диапазоне 0-500"), nil
+	}
+
+	to := time.Now().UTC()
+	if s := strings.TrimSpace(req.GetString("to", "")); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Некорректный формат to: %v", err)), nil
+		}
+		to = t
+	}
+	minutes := req.GetInt("minutes", 10)
+	if minutes < 1 || minutes > 60 {
+		return mcp.NewToolResultError("minutes должен быть в диапазоне 1-60"), nil
+	}
+	from := to.Add(-time.Duration(minutes) * time.Minute)
+	if s := strings.TrimSpace(req.GetString("from", "")); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Некорректный формат from: %v", err)), nil
+		}
+		from = t
+	}
+	// старше часа сделок нет, поэтому окно обрезается
+	if earliest := time.Now().Add(-lastTradesMaxWindow); from.Before(earliest) {
+		from = earliest
+	}
+	if !from.Before(to) {
+		return mcp.NewToolResultError("Окно пусто: обезличенные сделки доступны только за последний час"), nil
+	}
+
+	inst, err := findInstrumentRef(ic, q)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	resp, err := ic.sdk.NewMarketDataServiceClient().GetLastTrades(inst.Uid, from, to)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка получения сделок: %v", err)), nil
+	}
+	trades := resp.GetTrades()
+	head := fmt.Sprintf("Лента сделок %s (%s), FIGI %s, %s → %s (UTC)", inst.Name, inst.Ticker, inst.Figi,
+		from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339))
+	result := LastTradesOutput{Instrument: inst.JSON(), From: timeJSON(from), To: timeJSON(to), Trades: []TradeJSON{}}
+	if len(trades) == 0 {
+		return mcp.NewToolResultStructured(result, head+": сделок нет"), nil
+	}
+	sort.Slice(trades, func(i, j int) bool {
+		return trades[i].GetTime().AsTime().After(trades[j].GetTime().AsTime())
+	})
+
+	stats := summarizeTrades(trades)
+	result.Stats = stats.JSON()
+	text := head + "\n" + formatTradeStats(stats)
+	if limit > 0 {
+		shown := trades
+		if len(shown) > limit {
+			shown = shown[:limit]
+		}
+		lines := make([]string, 0, len(shown))
+		for _, t := range shown {
+			lines = append(lines, fmt.Sprintf("%s %s %s × %d",
+				t.GetTime().AsTime().UTC().Format("15:04:05.000"), tradeDirectionName(t.GetDirection()),
+				quotationToStr(t.GetPrice()), t.GetQuantity()))
+			result.Trades = append(result.Trades, TradeJSON{
+				Time: timestampJSON(t.GetTime()), Direction: tradeDirectionName(t.GetDirection()),
+				Price: quotationJSON(t.GetPrice()), Lots: t.GetQuantity(),
+			})
+		}
+		text += fmt.Sprintf("\nПоследние сделки (%d из %d):\n%s", len(shown), len(trades), formatList(lines))
+	}
+	return mcp.NewToolResultStructured(result, text), nil
+}
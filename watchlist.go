@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	pb "github.com/tinkoff/invest-api-go-sdk/proto"
+)
+
+// WatchlistItem — инструмент в локальном списке наблюдения
+type WatchlistItem struct {
+	Figi      string `json:"figi"`
+	Uid       string `json:"uid"`
+	Ticker    string `json:"ticker"`
+	ClassCode string `json:"class_code"`
+	Name      string `json:"name"`
+}
+
+func (w WatchlistItem) Ref() *InstrumentRef {
+	return &InstrumentRef{Figi: w.Figi, Uid: w.Uid, Ticker: w.Ticker, ClassCode: w.ClassCode, Name: w.Name}
+}
+
+// watchlistMu сериализует чтение-изменение-запись файла списков
+var watchlistMu sync.Mutex
+
+func watchlistPath(ic *InvestClient) string {
+	return filepath.Join(ic.dataDir, "watchlists.json")
+}
+
+func loadWatchlists(ic *InvestClient) (map[string][]WatchlistItem, error) {
+	lists := make(map[string][]WatchlistItem)
+	if err := readJSONFile(watchlistPath(ic), &lists); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+// updateWatchlists применяет изменение к спискам под блокировкой и сохраняет результат
+func updateWatchlists(ic *InvestClient, fn func(lists map[string][]WatchlistItem) error) error {
+	watchlistMu.Lock()
+	defer watchlistMu.Unlock()
+	lists, err := loadWatchlists(ic)
+	if err != nil {
+		return err
+	}
+	if err := fn(lists); err != nil {
+		return err
+	}
+	return writeJSONFile(watchlistPath(ic), lists)
+}
+
+// FavoriteJSON — инструмент в избранном брокера
+type FavoriteJSON struct {
+	Figi              string `json:"figi"`
+	Ticker            string `json:"ticker"`
+	ClassCode         string `json:"class_code"`
+	Kind              string `json:"kind"`
+	ApiTradeAvailable bool   `json:"api_trade_available"`
+}
+
+// FavoritesOutput — структурированный результат favorites и favorites_edit
+type FavoritesOutput struct {
+	Action   string         `json:"action,omitempty"`
+	Changed  int            `json:"changed,omitempty"`
+	Items    []FavoriteJSON `json:"items"`
+	NotFound []string       `json:"not_found,omitempty"`
+}
+
+// WatchlistJSON — локальный список наблюдения
+type WatchlistJSON struct {
+	Name        string           `json:"name"`
+	Instruments []InstrumentJSON `json:"instruments"`
+}
+
+// WatchlistsOutput — структурированный результат watchlists
+type WatchlistsOutput struct {
+	Watchlists []WatchlistJSON `json:"watchlists"`
+}
+
+// WatchlistChangeOutput — структурированный результат watchlist_add и watchlist_remove
+type WatchlistChangeOutput struct {
+	Name     string   `json:"name"`
+	Added    int      `json:"added,omitempty"`
+	Removed  int      `json:"removed,omitempty"`
+	Deleted  bool     `json:"deleted,omitempty"`
+	NotFound []string `json:"not_found,omitempty"`
+}
+
+// WatchlistQuotesOutput — структурированный результат watchlist_quotes
+type WatchlistQuotesOutput struct {
+	Source     string      `json:"source"`
+	Quotes     []QuoteJSON `json:"quotes"`
+	CloseError string      `json:"close_error,omitempty"` // цены закрытия не получены — изменение не рассчитано
+}
+
+func favoritesJSON(favs []*pb.FavoriteInstrument) []FavoriteJSON {
+	out := make([]FavoriteJSON, 0, len(favs))
+	for _, f := range favs {
+		out = append(out, FavoriteJSON{Figi: f.GetFigi(), Ticker: f.GetTicker(), ClassCode: f.GetClassCode(),
+			Kind: kindName(f.GetInstrumentKind()), ApiTradeAvailable: f.GetApiTradeAvailableFlag()})
+	}
+	return out
+}
+
+func watchlistName(req mcp.CallToolRequest) (string, error) {
+	name := strings.TrimSpace(req.GetString("name", ""))
+	if name == "" {
+		return "", fmt.Errorf("не указано имя списка (name)")
+	}
+	return name, nil
+}
+
+func favoritesHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	resp, err := ic.sdk.NewInstrumentsServiceClient().GetFavorites()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка получения избранного: %v", err)), nil
+	}
+	favs := resp.GetFavoriteInstruments()
+	result := FavoritesOutput{Items: favoritesJSON(favs)}
+	if len(favs) == 0 {
+		return mcp.NewToolResultStructured(result, "Избранное пусто"), nil
+	}
+	return mcp.NewToolResultStructured(result, "Избранное:\n"+formatList(formatFavorites(favs))), nil
+}
+
+func formatFavorites(favs []*pb.FavoriteInstrument) []string {
+	lines := make([]string, 0, len(favs))
+	for _, f := range favs {
+		lines = append(lines, fmt.Sprintf("%s [%s, %s] – FIGI: %s, API: %s",
+			f.GetTicker(), kindName(f.GetInstrumentKind()), f.GetClassCode(), f.GetFigi(), yesNo(f.GetApiTradeAvailableFlag())))
+	}
+	return lines
+}
+
+// favoritesEditHandler добавляет/удаляет инструменты в избранном брокера.
+// Инструменты задаются через query и/или берутся целиком из локального списка watchlist.
+func favoritesEditHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	action, _ := req.RequireString("action")
+	var actionType pb.EditFavoritesActionType
+	switch strings.ToLower(strings.TrimSpace(action)) {
+	case "add":
+		actionType = pb.EditFavoritesActionType_EDIT_FAVORITES_ACTION_TYPE_ADD
+	case "remove":
+		actionType = pb.EditFavoritesActionType_EDIT_FAVORITES_ACTION_TYPE_DEL
+	default:
+		return mcp.NewToolResultError(fmt.Sprintf("неизвестный action %q. Допустимо: add,remove", action)), nil
+	}
+
+	refs, failed := findInstrumentRefs(ic, stringListArg(req, "query"))
+	if name := strings.TrimSpace(req.GetString("watchlist", "")); name != "" {
+		lists, err := loadWatchlists(ic)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Ошибка чтения списков наблюдения: %v", err)), nil
+		}
+		items, ok := lists[name]
+		if !ok {
+			return mcp.NewToolResultError(fmt.Sprintf("Список %q не найден", name)), nil
+		}
+		for _, it := range items {
+			refs = append(refs, it.Ref())
+		}
+	}
+	var figis []string
+	for _, r := range refs {
+		if r.Figi != "" {
+			figis = append(figis, r.Figi)
+		}
+	}
+	if len(figis) == 0 {
+		msg := "Не указаны инструменты: передайте query или watchlist"
+		if len(failed) > 0 {
+			msg = strings.Join(failed, "\n")
+		}
+		return mcp.NewToolResultError(msg), nil
+	}
+
+	resp, err := ic.sdk.NewInstrumentsServiceClient().EditFavorites(figis, actionType)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка изменения избранного: %v", err)), nil
+	}
+	text := fmt.Sprintf("Избранное обновлено (%s, инструментов: %d). Текущий список:\n%s",
+		action, len(figis), formatList(formatFavorites(resp.GetFavoriteInstruments())))
+	if len(failed) > 0 {
+		text += "Не найдены:\n" + formatList(failed)
+	}
+	result := FavoritesOutput{
+		Action: strings.ToLower(strings.TrimSpace(action)), Changed: len(figis),
+		Items: favoritesJSON(resp.GetFavoriteInstruments()), NotFound: failed,
+	}
+	return mcp.NewToolResultStructured(result, text), nil
+}
+
+func watchlistsHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	lists, err := loadWatchlists(ic)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка чтения списков наблюдения: %v", err)), nil
+	}
+	result := WatchlistsOutput{Watchlists: make([]WatchlistJSON, 0, len(lists))}
+	if len(lists) == 0 {
+		return mcp.NewToolResultStructured(result, "Локальных списков наблюдения нет"), nil
+	}
+	names := make([]string, 0, len(lists))
+	for n := range lists {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var lines []string
+	for _, n := range names {
+		tickers := make([]string, 0, len(lists[n]))
+		list := WatchlistJSON{Name: n, Instruments: make([]InstrumentJSON, 0, len(lists[n]))}
+		for _, it := range lists[n] {
+			tickers = append(tickers, it.Ticker)
+			list.Instruments = append(list.Instruments, it.Ref().JSON())
+		}
+		lines = append(lines, fmt.Sprintf("%s (%d): %s", n, len(tickers), strings.Join(tickers, ", ")))
+		result.Watchlists = append(result.Watchlists, list)
+	}
+	return mcp.NewToolResultStructured(result, "Списки наблюдения:\n"+formatList(lines)), nil
+}
+
+// watchlistAddHandler добавляет инструменты в локальный список (создаёт его при необходимости);
+// from_favorites импортирует всё избранное брокера
+func watchlistAddHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	name, err := watchlistName(req)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	refs, failed := findInstrumentRefs(ic, stringListArg(req, "query"))
+	if req.GetBool("from_favorites", false) {
+		resp, err := ic.sdk.NewInstrumentsServiceClient().GetFavorites()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Ошибка получения избранного: %v", err)), nil
+		}
+		for _, f := range resp.GetFavoriteInstruments() {
+			ref, err := findInstrumentRef(ic, f.GetFigi())
+			if err != nil {
+				failed = append(failed, err.Error())
+				continue
+			}
+			refs = append(refs, ref)
+		}
+	}
+	if len(refs) == 0 {
+		msg := "Не указаны инструменты: передайте query или from_favorites"
+		if len(failed) > 0 {
+			msg = strings.Join(failed, "\n")
+		}
+		return mcp.NewToolResultError(msg), nil
+	}
+
+	added := 0
+	err = updateWatchlists(ic, func(lists map[string][]WatchlistItem) error {
+		items := lists[name]
+		seen := make(map[string]bool)
+		for _, it := range items {
+			seen[it.Uid] = true
+		}
+		for _, r := range refs {
+			if seen[r.Uid] {
+				continue
+			}
+			seen[r.Uid] = true
+			items = append(items, WatchlistItem{Figi: r.Figi, Uid: r.Uid, Ticker: r.Ticker, ClassCode: r.ClassCode, Name: r.Name})
+			added++
+		}
+		lists[name] = items
+		return nil
+	})
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ошибка сохранения списка: %v", err)), nil
+	}
+	text := fmt.Sprintf("В список %q добавлено инструментов: %d", name, added)
+	if len(failed) > 0 {
+		text += "\nНе найдены:\n" + formatList(failed)
+	}
+	result := WatchlistChangeOutput{Name: name, Added: added, NotFound: failed}
+	return mcp.NewToolResultStructured(result, text), nil
+}
+
+// watchlistRemoveHandler удаляет инструменты из списка, а без query — весь список
+func watchlistRemoveHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	name, err := watchlistName(req)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	queries := stringListArg(req, "query")
+	removed := 0
+	err = updateWatchlists(ic, func(lists map[string][]WatchlistItem) error {
+		items, ok := lists[name]
+		if !ok {
+			return fmt.Errorf("список %q не найден", name)
+		}
+		if len(queries) == 0 {
+			removed = len(items)
+			delete(lists, name)
+			return nil
+		}
+		var kept []WatchlistItem
+		for _, it := range items {
+			if matchesAny(it, queries) {
+				removed++
+				continue
+			}
+			kept = append(kept, it)
+		}
+		lists[name] = kept
+		return nil
+	})
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	result := WatchlistChangeOutput{Name: name, Removed: removed, Deleted: len(queries) == 0}
+	if len(queries) == 0 {
+		return mcp.NewToolResultStructured(result, fmt.Sprintf("Список %q удалён (инструментов: %d)", name, removed)), nil
+	}
+	return mcp.NewToolResultStructured(result, fmt.Sprintf("Из списка %q удалено инструментов: %d", name, removed)), nil
+}
+
+func matchesAny(it WatchlistItem, queries []string) bool {
+	for _, q := range queries {
+		if strings.EqualFold(it.Ticker, q) || strings.EqualFold(it.Figi, q) || strings.EqualFold(it.Uid, q) {
+			return true
+		}
+	}
+	return false
+}
+
+// watchlistQuotesHandler — котировки всех инструментов списка одним пакетным запросом
+func watchlistQuotesHandler(ctx context.Context, req mcp.CallToolRequest, ic *InvestClient) (*mcp.CallToolResult, error) {
+	var refs []*InstrumentRef
+	title, source := "", "favorites"
+	if req.GetBool("favorites", false) {
+		resp, err := ic.sdk.NewInstrumentsServiceClient().GetFavorites()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Ошибка получения избранного: %v", err)), nil
+		}
+		for _, f := range resp.GetFavoriteInstruments() {
+			refs = append(refs, &InstrumentRef{Figi: f.GetFigi(), Ticker: f.GetTicker(), ClassCode: f.GetClassCode(), Name: f.GetTicker()})
+		}
+		title = "Избранное"
+	} else {
+		name, err := watchlistName(req)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		lists, err := loadWatchlists(ic)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Ошибка чтения списков наблюдения: %v", err)), nil
+		}
+		items, ok := lists[name]
+		if !ok {
+			return mcp.NewToolResultError(fmt.Sprintf("Список %q не найден", name)), nil
+		}
+		for _, it := range items {
+			refs = append(refs, it.Ref())
+		}
+		title, source = fmt.Sprintf("Список %q", name), name
+	}
+	if len(refs) == 0 {
+		return mcp.NewToolResultStructured(WatchlistQuotesOutput{Source: source, Quotes: []QuoteJSON{}}, title+": пусто"), nil
+	}
+
+	// для избранного UID неизвестен — запрашиваем по FIGI
+	for _, r := range refs {
+		if r.Uid == "" {
+			r.Uid = r.Figi
+		}
+	}
+	rows, closeErr, err := loadQuotes(ic, refs)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	lines := make([]string, 0, len(rows))
+	for _, r := range rows {
+		lines = append(lines, formatQuoteRow(r))
+	}
+	q := quotesJSON(rows, closeErr)
+	result := WatchlistQuotesOutput{Source: source, Quotes: q.Quotes, CloseError: q.CloseError}
+	text := strings.TrimRight(fmt.Sprintf("%s — котировки:\n%s", title, formatList(lines)), "\n") + closeErrorNote(closeErr)
+	return mcp.NewToolResultStructured(result, text), nil
+}